@@ -0,0 +1,166 @@
+// Command checkout-bench measures POST /api/checkout latency for carts of
+// different sizes against a running API.
+//
+// It creates enough test products (with plenty of stock) for the largest
+// cart, then sends sequential checkouts for every cart size and prints
+// average, p50, p95 and max latency. Pass -compare with the URL of another
+// deployment (e.g. the previous release) to benchmark both side by side.
+//
+//	go run ./cmd/checkout-bench -base http://localhost:8080 -sizes 1,10,40 -n 50
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type result struct {
+	avg, p50, p95, max time.Duration
+}
+
+func main() {
+	base := flag.String("base", "http://localhost:8080", "base URL of the API to benchmark")
+	compare := flag.String("compare", "", "optional base URL of a second API to compare against")
+	sizesFlag := flag.String("sizes", "1,10,40", "comma separated cart sizes (number of lines)")
+	n := flag.Int("n", 50, "checkouts per cart size")
+	flag.Parse()
+
+	sizes := make([]int, 0)
+	for _, v := range strings.Split(*sizesFlag, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || size <= 0 {
+			log.Fatalf("invalid cart size %q", v)
+		}
+		sizes = append(sizes, size)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	targets := []string{*base}
+	if *compare != "" {
+		targets = append(targets, *compare)
+	}
+
+	results := make(map[string]map[int]result)
+	for _, target := range targets {
+		ids, err := setup(client, target, slices.Max(sizes), *n)
+		if err != nil {
+			log.Fatalf("%s: setup: %v", target, err)
+		}
+		results[target] = make(map[int]result)
+		for _, size := range sizes {
+			r, err := bench(client, target, ids[:size], *n)
+			if err != nil {
+				log.Fatalf("%s: cart of %d: %v", target, size, err)
+			}
+			results[target][size] = r
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "target\tlines\tavg\tp50\tp95\tmax")
+	for _, size := range sizes {
+		for _, target := range targets {
+			r := results[target][size]
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", target, size,
+				r.avg.Round(time.Microsecond*100), r.p50.Round(time.Microsecond*100),
+				r.p95.Round(time.Microsecond*100), r.max.Round(time.Microsecond*100))
+		}
+	}
+	tw.Flush()
+}
+
+// setup creates count products with enough stock for every benchmark run.
+func setup(client *http.Client, base string, count, n int) ([]int, error) {
+	run := time.Now().Format("150405")
+	ids := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		body := map[string]interface{}{
+			"name":  fmt.Sprintf("checkout-bench %s #%d", run, i+1),
+			"price": 1000,
+			"stock": n * 10,
+		}
+		var created struct {
+			ID int `json:"id"`
+		}
+		if err := call(client, http.MethodPost, base+"/api/produk", body, &created); err != nil {
+			return nil, err
+		}
+		ids = append(ids, created.ID)
+	}
+	return ids, nil
+}
+
+func bench(client *http.Client, base string, ids []int, n int) (result, error) {
+	items := make([]map[string]int, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, map[string]int{"product_id": id, "quantity": 1})
+	}
+	body := map[string]interface{}{"items": items}
+
+	latencies := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		if err := call(client, http.MethodPost, base+"/api/checkout", body, nil); err != nil {
+			return result{}, err
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+
+	slices.Sort(latencies)
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return result{
+		avg: total / time.Duration(len(latencies)),
+		p50: latencies[len(latencies)/2],
+		p95: latencies[(len(latencies)*95)/100],
+		max: latencies[len(latencies)-1],
+	}, nil
+}
+
+func call(client *http.Client, method, url string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %d %s", method, url, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
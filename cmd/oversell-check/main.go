@@ -0,0 +1,151 @@
+// Command oversell-check is a concurrency harness for POST /api/checkout.
+//
+// It creates a few products with a small stock on a running API, then lets
+// many workers check out baskets containing all of them in random order at
+// the same time. Afterwards it verifies that exactly the available stock was
+// sold, that no product ended with negative stock and that no request failed
+// with a deadlock. It exits non-zero when any check fails.
+//
+//	go run ./cmd/oversell-check -base http://localhost:8080 -stock 50 -workers 20
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type product struct {
+	ID    int         `json:"id"`
+	Name  string      `json:"name"`
+	Price int64       `json:"price"`
+	Stock json.Number `json:"stock"`
+}
+
+func main() {
+	base := flag.String("base", "http://localhost:8080", "base URL of the running API")
+	stock := flag.Int("stock", 50, "initial stock of each test product")
+	products := flag.Int("products", 3, "number of test products per basket")
+	workers := flag.Int("workers", 20, "concurrent checkout workers")
+	flag.Parse()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	run := time.Now().Format("150405")
+
+	ids := make([]int, 0, *products)
+	for i := 0; i < *products; i++ {
+		p := product{Name: fmt.Sprintf("oversell-check %s #%d", run, i+1), Price: 1000, Stock: json.Number(fmt.Sprint(*stock))}
+		var created product
+		if err := call(client, http.MethodPost, *base+"/api/produk", p, &created); err != nil {
+			log.Fatalf("create product: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+	log.Printf("created products %v with stock %d each", ids, *stock)
+
+	var sold, rejected, deadlocks, failed int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < *workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for {
+				order := rng.Perm(len(ids))
+				items := make([]map[string]int, 0, len(ids))
+				for _, i := range order {
+					items = append(items, map[string]int{"product_id": ids[i], "quantity": 1})
+				}
+
+				err := call(client, http.MethodPost, *base+"/api/checkout", map[string]interface{}{"items": items}, nil)
+				switch {
+				case err == nil:
+					atomic.AddInt64(&sold, 1)
+				case strings.Contains(err.Error(), "stock not enough"):
+					atomic.AddInt64(&rejected, 1)
+					return
+				case strings.Contains(err.Error(), "deadlock"):
+					atomic.AddInt64(&deadlocks, 1)
+				default:
+					atomic.AddInt64(&failed, 1)
+					log.Printf("checkout failed: %v", err)
+					return
+				}
+			}
+		}(int64(w) + start.UnixNano())
+	}
+	wg.Wait()
+	log.Printf("%d baskets sold, %d rejected for stock, %d deadlocks, %d other failures in %s",
+		sold, rejected, deadlocks, failed, time.Since(start).Round(time.Millisecond))
+
+	ok := true
+	if sold != int64(*stock) {
+		log.Printf("FAIL: sold %d baskets but only %d were in stock", sold, *stock)
+		ok = false
+	}
+	if deadlocks > 0 || failed > 0 {
+		log.Printf("FAIL: %d deadlocks and %d unexpected failures", deadlocks, failed)
+		ok = false
+	}
+	for _, id := range ids {
+		var p product
+		if err := call(client, http.MethodGet, fmt.Sprintf("%s/api/produk/%d", *base, id), nil, &p); err != nil {
+			log.Fatalf("get product %d: %v", id, err)
+		}
+		if p.Stock.String() != "0" {
+			log.Printf("FAIL: product %d ended with stock %s, expected 0", id, p.Stock)
+			ok = false
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+	log.Println("OK: no overselling")
+}
+
+func call(client *http.Client, method, url string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %d %s", method, url, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
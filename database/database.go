@@ -299,6 +299,602 @@ func runMigrations(db *sql.DB) error {
 		return err
 	}
 
+	// Units of measure - stock is always kept in the product's base unit
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS base_unit VARCHAR(20) NOT NULL DEFAULT 'pcs'
+	`)
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS product_units (
+			id BIGSERIAL PRIMARY KEY,
+			product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			name VARCHAR(20) NOT NULL,
+			conversion_factor INT NOT NULL CHECK (conversion_factor > 0),
+			price INT NOT NULL,
+			UNIQUE (product_id, name)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transaction_details ADD COLUMN IF NOT EXISTS unit VARCHAR(20)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transaction_details ADD COLUMN IF NOT EXISTS base_quantity INT
+	`)
+	_, _ = db.ExecContext(ctx, `
+		UPDATE transaction_details SET base_quantity = quantity WHERE base_quantity IS NULL
+	`)
+
+	// Fractional quantities (3 decimals) for products sold by weight
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE products ALTER COLUMN stock TYPE NUMERIC(14,3)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS sold_by_weight BOOLEAN NOT NULL DEFAULT FALSE
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS barcode VARCHAR(32)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS products_barcode_key ON products (barcode) WHERE barcode IS NOT NULL
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE product_units ALTER COLUMN conversion_factor TYPE NUMERIC(14,3)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transaction_details ALTER COLUMN quantity TYPE NUMERIC(14,3)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transaction_details ALTER COLUMN base_quantity TYPE NUMERIC(14,3)
+	`)
+
+	// Money columns are BIGINT so large wholesale totals cannot overflow INT
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE products ALTER COLUMN price TYPE BIGINT
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE product_units ALTER COLUMN price TYPE BIGINT
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ALTER COLUMN total_amount TYPE BIGINT
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transaction_details ALTER COLUMN subtotal TYPE BIGINT
+	`)
+
+	// Stock batches with expiry dates, consumed FEFO at checkout
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS stock_batches (
+			id BIGSERIAL PRIMARY KEY,
+			product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			batch_code VARCHAR(50) NOT NULL DEFAULT '',
+			quantity NUMERIC(14,3) NOT NULL CHECK (quantity >= 0),
+			initial_quantity NUMERIC(14,3) NOT NULL,
+			expiry_date DATE,
+			received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			written_off_at TIMESTAMP WITH TIME ZONE
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS stock_batches_fefo_idx ON stock_batches (product_id, expiry_date) WHERE quantity > 0
+	`)
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS stock_writeoffs (
+			id BIGSERIAL PRIMARY KEY,
+			batch_id BIGINT REFERENCES stock_batches(id) ON DELETE SET NULL,
+			product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			quantity NUMERIC(14,3) NOT NULL,
+			reason TEXT,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Outlets - the default store keeps using products.stock
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS stores (
+			id BIGSERIAL PRIMARY KEY,
+			code VARCHAR(20) NOT NULL UNIQUE,
+			name VARCHAR(255) NOT NULL,
+			address TEXT NOT NULL DEFAULT '',
+			npwp VARCHAR(32) NOT NULL DEFAULT '',
+			is_default BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS stores_single_default ON stores (is_default) WHERE is_default
+	`)
+	_, _ = db.ExecContext(ctx, `
+		INSERT INTO stores (code, name, is_default)
+		SELECT 'UTAMA', 'Toko Utama', TRUE
+		WHERE NOT EXISTS (SELECT 1 FROM stores WHERE is_default)
+	`)
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS store_stock (
+			store_id BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+			product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			stock NUMERIC(14,3) NOT NULL DEFAULT 0 CHECK (stock >= 0),
+			PRIMARY KEY (store_id, product_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS store_prices (
+			store_id BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+			product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			price BIGINT NOT NULL,
+			PRIMARY KEY (store_id, product_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS store_id BIGINT REFERENCES stores(id)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		UPDATE transactions SET store_id = (SELECT id FROM stores WHERE is_default) WHERE store_id IS NULL
+	`)
+
+	// Stock transfers between outlets
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS stock_transfers (
+			id BIGSERIAL PRIMARY KEY,
+			source_store_id BIGINT NOT NULL REFERENCES stores(id),
+			destination_store_id BIGINT NOT NULL REFERENCES stores(id),
+			status VARCHAR(20) NOT NULL DEFAULT 'draft',
+			note TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			sent_at TIMESTAMP WITH TIME ZONE,
+			received_at TIMESTAMP WITH TIME ZONE,
+			CHECK (source_store_id <> destination_store_id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS stock_transfer_items (
+			id BIGSERIAL PRIMARY KEY,
+			transfer_id BIGINT NOT NULL REFERENCES stock_transfers(id) ON DELETE CASCADE,
+			product_id BIGINT NOT NULL REFERENCES products(id),
+			quantity NUMERIC(14,3) NOT NULL CHECK (quantity > 0),
+			quantity_received NUMERIC(14,3),
+			note TEXT NOT NULL DEFAULT ''
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Idempotent checkout - retries with the same key return the original sale
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS request_hash CHAR(64)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS transactions_idempotency_key ON transactions (idempotency_key) WHERE idempotency_key IS NOT NULL
+	`)
+
+	// Server-side carts that can be held (parked) and resumed
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS carts (
+			id BIGSERIAL PRIMARY KEY,
+			store_id BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'open',
+			transaction_id BIGINT REFERENCES transactions(id),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_carts_status_expiry ON carts (status, expires_at)
+	`)
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS cart_items (
+			id BIGSERIAL PRIMARY KEY,
+			cart_id BIGINT NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+			product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			unit VARCHAR(30) NOT NULL,
+			quantity NUMERIC(14,3) NOT NULL CHECK (quantity > 0),
+			price BIGINT NOT NULL,
+			UNIQUE (cart_id, product_id, unit)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Soft stock reservations of open carts and pending orders
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS stock_reservations (
+			id BIGSERIAL PRIMARY KEY,
+			store_id BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+			product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			quantity NUMERIC(14,3) NOT NULL CHECK (quantity > 0),
+			cart_id BIGINT REFERENCES carts(id) ON DELETE CASCADE,
+			reference VARCHAR(100) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_stock_reservations_product ON stock_reservations (product_id, store_id, expires_at)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_stock_reservations_cart ON stock_reservations (cart_id) WHERE cart_id IS NOT NULL
+	`)
+
+	// Payment of a sale (method, amount tendered and change)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_method VARCHAR(20) NOT NULL DEFAULT 'cash'
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS paid_amount BIGINT
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS change_amount BIGINT NOT NULL DEFAULT 0
+	`)
+
+	// Human-readable invoice numbers, counted per store per period
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS invoice_counters (
+			store_id BIGINT NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+			period VARCHAR(10) NOT NULL,
+			last_number BIGINT NOT NULL,
+			PRIMARY KEY (store_id, period)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS invoice_number VARCHAR(100)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS transactions_store_invoice_key ON transactions (store_id, invoice_number)
+		WHERE invoice_number IS NOT NULL
+	`)
+
+	// Sales paid through a payment gateway wait in pending_payment with their
+	// stock reserved until the gateway confirms the payment
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'paid'
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_gateway VARCHAR(20)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_order_id VARCHAR(64)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_reference VARCHAR(100)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_qr TEXT
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_qr_url TEXT
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE transactions ADD COLUMN IF NOT EXISTS payment_expires_at TIMESTAMP WITH TIME ZONE
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS transactions_payment_order_key ON transactions (payment_gateway, payment_order_id) WHERE payment_order_id IS NOT NULL
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_transactions_pending_payment ON transactions (payment_expires_at) WHERE status = 'pending_payment'
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE stock_reservations ADD COLUMN IF NOT EXISTS transaction_id BIGINT REFERENCES transactions(id) ON DELETE CASCADE
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_stock_reservations_transaction ON stock_reservations (transaction_id) WHERE transaction_id IS NOT NULL
+	`)
+
+	// Outbound webhooks: subscriptions and the log of every delivery
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			id BIGSERIAL PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret VARCHAR(128) NOT NULL,
+			events TEXT[] NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+			event_id VARCHAR(40) NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			payload TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			last_status_code INT,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			replay_of BIGINT REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP WITH TIME ZONE
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, id)
+	`)
+
+	// Transactional outbox: events stored with the change they describe and
+	// delivered by the dispatcher; a redelivered event queues no second webhook
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			event_id VARCHAR(40) NOT NULL UNIQUE,
+			event_type VARCHAR(50) NOT NULL,
+			payload TEXT NOT NULL,
+			delivered_to TEXT[] NOT NULL DEFAULT '{}',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			dispatched_at TIMESTAMP WITH TIME ZONE
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox (next_attempt_at) WHERE dispatched_at IS NULL
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_event_key ON webhook_deliveries (subscription_id, event_id) WHERE replay_of IS NULL
+	`)
+
+	// Offline sync: every catalog change takes the next catalog version (stock
+	// moves with sales and is left out); deletions leave tombstones. Versions
+	// are taken under a lock held until commit, so they become visible in order
+	// and a sync token never skips a change that was still committing
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS sync_version BIGINT NOT NULL DEFAULT 0
+	`)
+	_, _ = db.ExecContext(ctx, `
+		ALTER TABLE categories ADD COLUMN IF NOT EXISTS sync_version BIGINT NOT NULL DEFAULT 0
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE SEQUENCE IF NOT EXISTS catalog_version_seq
+	`)
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS catalog_tombstones (
+			id BIGSERIAL PRIMARY KEY,
+			entity VARCHAR(20) NOT NULL,
+			entity_id BIGINT NOT NULL,
+			sync_version BIGINT NOT NULL,
+			deleted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_catalog_tombstones_version ON catalog_tombstones (sync_version)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_products_sync_version ON products (sync_version)
+	`)
+	_, _ = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_categories_sync_version ON categories (sync_version)
+	`)
+	_, err = db.ExecContext(ctx, `
+		CREATE OR REPLACE FUNCTION catalog_next_version() RETURNS BIGINT AS $$
+		BEGIN
+			PERFORM pg_advisory_xact_lock(hashtext('catalog_sync_version'));
+			RETURN nextval('catalog_version_seq');
+		END $$ LANGUAGE plpgsql
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE OR REPLACE FUNCTION catalog_bump_version() RETURNS TRIGGER AS $$
+		BEGIN
+			IF TG_OP = 'UPDATE' AND to_jsonb(NEW) - 'stock' - 'sync_version' = to_jsonb(OLD) - 'stock' - 'sync_version' THEN
+				RETURN NEW;
+			END IF;
+			NEW.sync_version := catalog_next_version();
+			RETURN NEW;
+		END $$ LANGUAGE plpgsql
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE OR REPLACE FUNCTION catalog_touch_product() RETURNS TRIGGER AS $$
+		DECLARE
+			pid BIGINT;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				pid := OLD.product_id;
+			ELSE
+				pid := NEW.product_id;
+			END IF;
+			UPDATE products SET sync_version = catalog_next_version() WHERE id = pid;
+			RETURN NULL;
+		END $$ LANGUAGE plpgsql
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE OR REPLACE FUNCTION catalog_tombstone() RETURNS TRIGGER AS $$
+		BEGIN
+			INSERT INTO catalog_tombstones (entity, entity_id, sync_version)
+			VALUES (TG_TABLE_NAME, OLD.id, catalog_next_version());
+			RETURN NULL;
+		END $$ LANGUAGE plpgsql
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'products_sync_version') THEN
+				CREATE TRIGGER products_sync_version BEFORE INSERT OR UPDATE ON products
+					FOR EACH ROW EXECUTE FUNCTION catalog_bump_version();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'categories_sync_version') THEN
+				CREATE TRIGGER categories_sync_version BEFORE INSERT OR UPDATE ON categories
+					FOR EACH ROW EXECUTE FUNCTION catalog_bump_version();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'product_units_sync_version') THEN
+				CREATE TRIGGER product_units_sync_version AFTER INSERT OR UPDATE OR DELETE ON product_units
+					FOR EACH ROW EXECUTE FUNCTION catalog_touch_product();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'store_prices_sync_version') THEN
+				CREATE TRIGGER store_prices_sync_version AFTER INSERT OR UPDATE OR DELETE ON store_prices
+					FOR EACH ROW EXECUTE FUNCTION catalog_touch_product();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'products_tombstone') THEN
+				CREATE TRIGGER products_tombstone AFTER DELETE ON products
+					FOR EACH ROW EXECUTE FUNCTION catalog_tombstone();
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'categories_tombstone') THEN
+				CREATE TRIGGER categories_tombstone AFTER DELETE ON categories
+					FOR EACH ROW EXECUTE FUNCTION catalog_tombstone();
+			END IF;
+		END $$
+	`)
+	if err != nil {
+		return err
+	}
+
+	// SKU is the shop's own product code, used to match rows on import
+	_, err = db.ExecContext(ctx, `
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(64)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE UNIQUE INDEX IF NOT EXISTS products_sku_key ON products (sku) WHERE sku IS NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_products_lower_name ON products (lower(name))
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_categories_lower_name ON categories (lower(name))
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Product listing sorted by name, paged with a cursor
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_products_name_id ON products (name, id)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Product search: trigram matching for typos (and indexed ILIKE), full
+	// text for words and prefixes. pg_trgm may need to be enabled by the
+	// database owner; until then search matches names without typos.
+	_, err = db.ExecContext(ctx, `
+		CREATE EXTENSION IF NOT EXISTS pg_trgm
+	`)
+	if err != nil {
+		log.Printf("WARNING: pg_trgm not available, product search will not match typos: %v\n", err)
+	} else {
+		_, err = db.ExecContext(ctx, `
+			CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN ((
+			setweight(to_tsvector('simple', name), 'A') ||
+			setweight(to_tsvector('simple', COALESCE(sku, '') || ' ' || COALESCE(barcode, '')), 'B')
+		))
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_products_category_id ON products (category_id)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Category tree. The reference is deferrable so a backup can restore
+	// children before their parent.
+	_, err = db.ExecContext(ctx, `
+		ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id BIGINT
+			REFERENCES categories(id) ON DELETE SET NULL DEFERRABLE
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id)
+	`)
+	if err != nil {
+		return err
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
\ No newline at end of file
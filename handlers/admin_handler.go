@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"kasir-api/services"
+)
+
+type AdminHandler struct {
+	service *services.BackupService
+	token   string
+}
+
+// NewAdminHandler serves the admin endpoints to requests bearing token; with
+// no token configured they are disabled.
+func NewAdminHandler(service *services.BackupService, token string) *AdminHandler {
+	return &AdminHandler{service: service, token: token}
+}
+
+// HandleBackup - GET /api/admin/backup
+func (h *AdminHandler) HandleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(w, r) {
+		return
+	}
+
+	filename := "kasir-backup-" + time.Now().Format("20060102-150405") + ".jsonl"
+	out := &exportResponse{w: w, contentType: "application/x-ndjson", filename: filename}
+	err := h.service.Backup(out)
+	if err == nil {
+		return
+	}
+	if out.started {
+		abortExport(filename, err)
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (h *AdminHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.token == "" {
+		http.Error(w, "Admin endpoints disabled (set ADMIN_TOKEN)", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kasir-api admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/services"
+	"kasir-api/spreadsheet"
+)
+
+type BatchHandler struct {
+	service *services.BatchService
+}
+
+func NewBatchHandler(service *services.BatchService) *BatchHandler {
+	return &BatchHandler{service: service}
+}
+
+// HandleBatches - GET /api/batches?product_id={id}
+func (h *BatchHandler) HandleBatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	productID, err := strconv.Atoi(r.URL.Query().Get("product_id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	batches, err := h.service.GetByProduct(productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batches)
+}
+
+// HandleBatchByID - POST /api/batches/{id}/write-off and POST /api/batches/write-off-expired
+func (h *BatchHandler) HandleBatchByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/batches/"), "/")
+	if path == "write-off-expired" {
+		writeOffs, err := h.service.WriteOffExpired()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(writeOffs)
+		return
+	}
+
+	idStr, action, _ := strings.Cut(path, "/")
+	if action != "write-off" {
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	writeOff, err := h.service.WriteOff(id, req.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(writeOff)
+}
+
+// HandleExpiringReport - GET /api/report/kadaluarsa?hari=7&format=json|csv|xlsx
+func (h *BatchHandler) HandleExpiringReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	days := 7
+	if v := r.URL.Query().Get("hari"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid hari parameter", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	batches, err := h.service.GetExpiring(days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format != "" {
+		exportBatches(w, format, batches)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batches)
+}
+
+func exportBatches(w http.ResponseWriter, format string, batches []models.StockBatch) {
+	header := []string{"batch_id", "product_id", "product_name", "batch_code", "quantity", "initial_quantity",
+		"expiry_date", "days_left", "received_at"}
+	err := writeExport(w, format, "kadaluarsa", header, func(write func(...spreadsheet.Cell) error) error {
+		for _, b := range batches {
+			expiry, daysLeft := spreadsheet.Text(""), spreadsheet.Text("")
+			if b.ExpiryDate != nil {
+				expiry = spreadsheet.Text(*b.ExpiryDate)
+			}
+			if b.DaysLeft != nil {
+				daysLeft = spreadsheet.Int(int64(*b.DaysLeft))
+			}
+			err := write(
+				spreadsheet.Int(int64(b.ID)),
+				spreadsheet.Int(int64(b.ProductID)),
+				spreadsheet.Text(b.ProductName),
+				spreadsheet.Text(b.BatchCode),
+				spreadsheet.Number(b.Quantity.String()),
+				spreadsheet.Number(b.InitialQuantity.String()),
+				expiry,
+				daysLeft,
+				spreadsheet.Text(b.ReceivedAt),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/repositories"
+	"kasir-api/services"
+)
+
+type CartHandler struct {
+	service *services.CartService
+}
+
+func NewCartHandler(service *services.CartService) *CartHandler {
+	return &CartHandler{service: service}
+}
+
+// HandleCarts - GET /api/carts?status= and POST /api/carts (for the store in X-Store-ID)
+func (h *CartHandler) HandleCarts(w http.ResponseWriter, r *http.Request) {
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		carts, err := h.service.GetAll(storeID, r.URL.Query().Get("status"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(carts)
+	case http.MethodPost:
+		var cart models.Cart
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&cart); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		cart.StoreID = storeID
+		if err := h.service.Create(&cart); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(cart)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleCartByID - GET/DELETE /api/carts/{id}, POST /api/carts/{id}/items,
+// PUT/DELETE /api/carts/{id}/items/{itemId} and
+// POST /api/carts/{id}/{hold|resume|recalculate|checkout}
+func (h *CartHandler) HandleCartByID(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/carts/"), "/")
+	idStr, action, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid cart ID", http.StatusBadRequest)
+		return
+	}
+
+	itemID := 0
+	if rest, ok := strings.CutPrefix(action, "items/"); ok {
+		itemID, err = strconv.Atoi(rest)
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+		action = "items/{itemId}"
+	}
+
+	var cart *models.Cart
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		cart, err = h.service.GetByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	case action == "" && r.Method == http.MethodDelete:
+		if err := h.service.Delete(id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Cart deleted successfully",
+		})
+		return
+	case action == "items" && r.Method == http.MethodPost:
+		var item models.CheckoutItem
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		cart, err = h.service.AddItem(id, item)
+	case action == "items/{itemId}" && r.Method == http.MethodPut:
+		var req struct {
+			Quantity models.Quantity `json:"quantity"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		cart, err = h.service.UpdateItem(id, itemID, req.Quantity)
+	case action == "items/{itemId}" && r.Method == http.MethodDelete:
+		cart, err = h.service.RemoveItem(id, itemID)
+	case action == "hold" && r.Method == http.MethodPost:
+		cart, err = h.service.Hold(id)
+	case action == "resume" && r.Method == http.MethodPost:
+		cart, err = h.service.Resume(id)
+	case action == "recalculate" && r.Method == http.MethodPost:
+		cart, err = h.service.Recalculate(id)
+	case action == "checkout" && r.Method == http.MethodPost:
+		var payment models.CheckoutRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		payment.IdempotencyKey = strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+		if len(payment.IdempotencyKey) > 255 {
+			http.Error(w, "Idempotency-Key too long (max 255)", http.StatusBadRequest)
+			return
+		}
+		h.checkout(w, id, payment)
+		return
+	case action == "" || action == "items" || action == "items/{itemId}" ||
+		action == "hold" || action == "resume" || action == "recalculate" || action == "checkout":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrQuantityOverflow) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cart)
+}
+
+// checkout - POST /api/carts/{id}/checkout with optional payment_method and paid_amount,
+// and the Idempotency-Key header as for POST /api/checkout
+func (h *CartHandler) checkout(w http.ResponseWriter, id int, payment models.CheckoutRequest) {
+	transaction, err := h.service.Checkout(id, payment)
+	var stockErr *repositories.StockConflictError
+	if errors.Is(err, repositories.ErrIdempotencyConflict) || errors.As(err, &stockErr) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrMoneyOverflow) || errors.Is(err, models.ErrQuantityOverflow) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if transaction.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	json.NewEncoder(w).Encode(transaction)
+}
@@ -29,10 +29,30 @@ func (h *CategoryHandler) HandleCategories(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// GetAll - GET /categories?name=, paged and sorted like the product listing,
+// or GET /categories?tree=true, all categories nested under their parents
 func (h *CategoryHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.categoryService.GetAll()
+	if v := r.URL.Query().Get("tree"); v != "" {
+		tree, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid tree", http.StatusBadRequest)
+			return
+		}
+		if tree {
+			h.tree(w, r)
+			return
+		}
+	}
+
+	list, err := listQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	categories, page, err := h.categoryService.GetAll(models.CategoryQuery{ListQuery: list, Name: r.URL.Query().Get("name")})
+	if err != nil {
+		http.Error(w, err.Error(), listErrorStatus(err))
 		return
 	}
 
@@ -41,10 +61,29 @@ func (h *CategoryHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 		categories = make([]models.Category, 0)
 	}
 
+	writePageHeaders(w, r, page)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(categories)
 }
 
+func (h *CategoryHandler) tree(w http.ResponseWriter, r *http.Request) {
+	for _, param := range []string{"name", "sort", "limit", "offset", "after"} {
+		if r.URL.Query().Has(param) {
+			http.Error(w, "Invalid "+param+" (the tree is never paged or filtered)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tree, err := h.categoryService.Tree()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
 func (h *CategoryHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var category models.Category
 	err := json.NewDecoder(r.Body).Decode(&category)
@@ -64,8 +103,23 @@ func (h *CategoryHandler) Create(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(category)
 }
 
-// HandleCategoryByID - GET/PUT/DELETE /categories/{id}
+// HandleCategoryByID - GET/PUT/DELETE /categories/{id} and POST
+// /categories/{id}/move
 func (h *CategoryHandler) HandleCategoryByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/categories/"), "/"), "/")
+	if len(parts) > 1 {
+		if len(parts) != 2 || parts[1] != "move" {
+			http.Error(w, "Endpoint not found", http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Move(w, r, parts[0])
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.GetByID(w, r)
@@ -141,3 +195,34 @@ func (h *CategoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		"message": "Category deleted successfully",
 	})
 }
+
+// Move - POST /categories/{id}/move with {"parent_id": id or null}
+func (h *CategoryHandler) Move(w http.ResponseWriter, r *http.Request, idStr string) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var move models.CategoryMove
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryService.Move(id, move)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "tidak ditemukan"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "tidak valid"):
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
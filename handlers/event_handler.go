@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kasir-api/services"
+)
+
+const (
+	// eventHeartbeat keeps idle streams from being cut by proxies
+	eventHeartbeat = 15 * time.Second
+	// eventRetry is the reconnect delay suggested to clients, in milliseconds
+	eventRetry = 3000
+)
+
+type EventHandler struct {
+	service *services.EventStreamService
+}
+
+func NewEventHandler(service *services.EventStreamService) *EventHandler {
+	return &EventHandler{service: service}
+}
+
+// HandleEvents - GET /api/events?types=transaction,stock,totals (for the
+// store in X-Store-ID, or all stores), streamed as Server-Sent Events. A
+// reconnecting client gets what it missed after Last-Event-ID.
+func (h *EventHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	filter := services.StreamFilter{StoreID: storeID}
+	if v := r.URL.Query().Get("types"); v != "" {
+		filter.Types = strings.Split(v, ",")
+	}
+
+	// EventSource sends the header; the query parameter is for clients that
+	// cannot set headers
+	var lastID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" || r.URL.Query().Get("last_event_id") != "" {
+		if v == "" {
+			v = r.URL.Query().Get("last_event_id")
+		}
+		lastID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lastID < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub, err := h.service.Subscribe(filter)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.Contains(err.Error(), "tidak ditemukan") {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer h.service.Unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+
+	// Events replayed here may also arrive live; they are sent once
+	replayed := make(map[int64]bool)
+	if lastID > 0 {
+		err := h.service.Replay(sub, lastID, func(m services.StreamMessage) error {
+			replayed[m.ID] = true
+			return writeEvent(w, m)
+		})
+		if err != nil {
+			log.Printf("event stream: replay after %d: %v\n", lastID, err)
+			return
+		}
+	}
+	totals, err := h.service.Totals(sub)
+	if err != nil {
+		log.Printf("event stream: totals: %v\n", err)
+		return
+	}
+	if totals != nil {
+		if err := writeEvent(w, *totals); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m, ok := <-sub.C:
+			if !ok {
+				// Fell behind; the client reconnects with Last-Event-ID
+				return
+			}
+			if replayed[m.ID] {
+				continue
+			}
+			if err := writeEvent(w, m); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, m services.StreamMessage) error {
+	if m.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", m.ID); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.Event, m.Data)
+	return err
+}
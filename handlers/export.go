@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"kasir-api/spreadsheet"
+)
+
+// exportFormat returns the spreadsheet format asked for with
+// ?format=csv|xlsx, or "" for the usual JSON.
+func exportFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		return "", nil
+	case spreadsheet.CSV, spreadsheet.XLSX:
+		return format, nil
+	}
+	return "", errors.New("Invalid format (use json, csv or xlsx)")
+}
+
+// exportName is the file name of an export made today, without extension.
+func exportName(name string) string {
+	return name + "-" + time.Now().Format("20060102")
+}
+
+// exportResponse sends the download headers with the first bytes of the
+// file, so an export failing before it produced anything can still be
+// answered with an error status.
+type exportResponse struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", e.contentType)
+		e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, e.filename))
+	}
+	return e.w.Write(p)
+}
+
+// abortExport ends a response that failed halfway through a download, so
+// the client gets a broken download rather than a file silently missing
+// rows.
+func abortExport(filename string, err error) {
+	log.Printf("export %s: %v\n", filename, err)
+	panic(http.ErrAbortHandler)
+}
+
+// writeExport streams a sheet with the header row and the rows passed to
+// write as a download. An error is returned only while nothing was sent
+// yet; a failure halfway through aborts the response.
+func writeExport(w http.ResponseWriter, format, name string, header []string, rows func(write func(...spreadsheet.Cell) error) error) error {
+	out := &exportResponse{w: w, contentType: spreadsheet.ContentType(format), filename: exportName(name) + "." + format}
+	sheet, err := spreadsheet.NewWriter(out, format, name)
+	if err != nil {
+		return err
+	}
+
+	cells := make([]spreadsheet.Cell, len(header))
+	for i, h := range header {
+		cells[i] = spreadsheet.Text(h)
+	}
+	err = sheet.WriteRow(cells...)
+	if err == nil {
+		err = rows(sheet.WriteRow)
+	}
+	if err == nil {
+		err = sheet.Close()
+	}
+	if err == nil || !out.started {
+		return err
+	}
+	abortExport(out.filename, err)
+	return nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kasir-api/models"
+)
+
+// listQuery reads the paging of a listing: ?limit=&offset= or
+// ?limit=&after={cursor}, and ?sort=field or ?sort=-field.
+func listQuery(r *http.Request) (models.ListQuery, error) {
+	q := r.URL.Query()
+	query := models.ListQuery{Sort: q.Get("sort"), After: q.Get("after")}
+
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return query, errors.New("Invalid limit")
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			return query, errors.New("Invalid offset")
+		}
+	}
+	return query, nil
+}
+
+// writePageHeaders sends the page metadata of a listing: X-Total-Count, and
+// when there is a next page its cursor in X-Next-Cursor and a Link to it.
+func writePageHeaders(w http.ResponseWriter, r *http.Request, page *models.PageInfo) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor == "" {
+		return
+	}
+	w.Header().Set("X-Next-Cursor", page.NextCursor)
+
+	next := r.URL.Query()
+	next.Del("offset")
+	next.Set("after", page.NextCursor)
+	w.Header().Set("Link", "<"+r.URL.Path+"?"+next.Encode()+`>; rel="next"`)
+}
+
+// listErrorStatus is the status of an error listing a page.
+func listErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "tidak valid"):
+		return http.StatusBadRequest
+	case strings.Contains(err.Error(), "tidak ditemukan"):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
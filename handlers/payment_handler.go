@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"kasir-api/payment"
+	"kasir-api/services"
+)
+
+type PaymentHandler struct {
+	service *services.TransactionService
+}
+
+func NewPaymentHandler(service *services.TransactionService) *PaymentHandler {
+	return &PaymentHandler{service: service}
+}
+
+// HandleWebhook - POST /api/payments/webhook/{gateway} (payment notifications)
+func (h *PaymentHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gateway := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/payments/webhook/"), "/")
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// A verified payment is always recorded, also one that cannot complete
+	// its sale (refund_required), and answered 2xx. Only failures that may
+	// pass, such as the database being unreachable, answer 5xx, so the
+	// gateway delivers the notification again later.
+	transaction, err := h.service.HandlePaymentNotification(gateway, body, r.Header)
+	if errors.Is(err, payment.ErrInvalidSignature) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, payment.ErrInvalidNotification) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, services.ErrUnknownGateway) || (err != nil && strings.Contains(err.Error(), "tidak ditemukan")) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "ok",
+		"transaction_id": transaction.ID,
+		"payment_status": transaction.Status,
+	})
+}
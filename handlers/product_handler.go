@@ -2,13 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"kasir-api/models"
 	"kasir-api/services"
+	"kasir-api/spreadsheet"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
+// maxImportSize bounds an uploaded import file
+const maxImportSize = 10 << 20
+
 type ProductHandler struct {
 	service *services.ProductService
 }
@@ -29,11 +37,68 @@ func (h *ProductHandler) HandleProducts(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// productQuery reads the listing's paging and filters: ?name=,
+// ?category_id=, ?min_price=, ?max_price=, ?in_stock=true|false, and the
+// store in X-Store-ID.
+func productQuery(r *http.Request) (models.ProductQuery, error) {
+	list, err := listQuery(r)
+	if err != nil {
+		return models.ProductQuery{}, err
+	}
+	q := r.URL.Query()
+	query := models.ProductQuery{ListQuery: list, Name: q.Get("name")}
+
+	if query.StoreID, err = storeIDFromRequest(r); err != nil {
+		return query, errors.New("Invalid store ID")
+	}
+	if v := q.Get("category_id"); v != "" {
+		if query.CategoryID, err = strconv.Atoi(v); err != nil {
+			return query, errors.New("Invalid category_id")
+		}
+	}
+	for _, bound := range []struct {
+		name  string
+		price **models.Money
+	}{{"min_price", &query.MinPrice}, {"max_price", &query.MaxPrice}} {
+		if v := q.Get(bound.name); v != "" {
+			price, err := models.ParseMoney(v)
+			if err != nil {
+				return query, errors.New("Invalid " + bound.name)
+			}
+			*bound.price = &price
+		}
+	}
+	if v := q.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, errors.New("Invalid in_stock")
+		}
+		query.InStock = &inStock
+	}
+	return query, nil
+}
+
+// GetAll - GET /api/produk, a page of products (all of them without
+// ?limit=); the total and the next page are sent in headers.
 func (h *ProductHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	name := r.URL.Query().Get("name")
-	products, err := h.service.GetAll(name)
+	query, err := productQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format != "" {
+		h.export(w, format, query)
+		return
+	}
+
+	products, page, err := h.service.GetAll(query)
+	if err != nil {
+		http.Error(w, err.Error(), listErrorStatus(err))
 		return
 	}
 
@@ -42,10 +107,37 @@ func (h *ProductHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 		products = make([]models.Product, 0)
 	}
 
+	writePageHeaders(w, r, page)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(products)
 }
 
+// export - GET /api/produk?format=csv|xlsx, every product matching the
+// filters. The columns are the ones an import reads, so an edited export can
+// be imported again.
+func (h *ProductHandler) export(w http.ResponseWriter, format string, query models.ProductQuery) {
+	header := []string{"id", "sku", "name", "category", "price", "stock", "available", "base_unit", "sold_by_weight", "barcode"}
+	err := writeExport(w, format, "produk", header, func(write func(...spreadsheet.Cell) error) error {
+		return h.service.Export(query, func(p models.Product) error {
+			return write(
+				spreadsheet.Int(int64(p.ID)),
+				spreadsheet.Text(p.SKU),
+				spreadsheet.Text(p.Name),
+				spreadsheet.Text(p.CategoryName),
+				spreadsheet.Int(int64(p.Price)),
+				spreadsheet.Number(p.Stock.String()),
+				spreadsheet.Number(p.Available.String()),
+				spreadsheet.Text(p.BaseUnit),
+				spreadsheet.Bool(p.SoldByWeight),
+				spreadsheet.Text(p.Barcode),
+			)
+		})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), listErrorStatus(err))
+	}
+}
+
 func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var product models.Product
 	err := json.NewDecoder(r.Body).Decode(&product)
@@ -67,6 +159,27 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 // HandleProductByID - GET/PUT/DELETE /api/produk/{id}
 func (h *ProductHandler) HandleProductByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/produk/"), "/"), "/")
+	if len(parts) == 1 && parts[0] == "import" {
+		h.HandleImport(w, r)
+		return
+	}
+	if len(parts) == 1 && parts[0] == "search" {
+		h.HandleSearch(w, r)
+		return
+	}
+	if len(parts) > 1 {
+		switch parts[1] {
+		case "units":
+			h.HandleProductUnits(w, r)
+		case "stok":
+			h.HandleReceiveStock(w, r)
+		default:
+			http.Error(w, "Endpoint not found", http.StatusNotFound)
+		}
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.GetByID(w, r)
@@ -79,6 +192,30 @@ func (h *ProductHandler) HandleProductByID(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// HandleSearch - GET /api/produk/search?q=, ranked products with the listing's
+// filters and offset paging (20 results without ?limit=)
+func (h *ProductHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query, err := productQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, page, err := h.service.Search(query, r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), listErrorStatus(err))
+		return
+	}
+
+	writePageHeaders(w, r, page)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
 // GetByID - GET /api/produk/{id}
 func (h *ProductHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/produk/")
@@ -144,3 +281,203 @@ func (h *ProductHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		"message": "Product deleted successfully",
 	})
 }
+
+// HandleProductUnits - GET/POST /api/produk/{id}/units and DELETE /api/produk/{id}/units/{unitId}
+func (h *ProductHandler) HandleProductUnits(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/produk/"), "/"), "/")
+	productID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	if len(parts) == 3 {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		unitID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.Error(w, "Invalid unit ID", http.StatusBadRequest)
+			return
+		}
+		if err := h.service.DeleteUnit(productID, unitID); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Unit deleted successfully",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		units, err := h.service.GetUnits(productID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(units)
+	case http.MethodPost:
+		var unit models.ProductUnit
+		if err := json.NewDecoder(r.Body).Decode(&unit); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		unit.ProductID = productID
+		if err := h.service.CreateUnit(&unit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(unit)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleReceiveStock - POST /api/produk/{id}/stok
+func (h *ProductHandler) HandleReceiveStock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/produk/"), "/")[0]
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var receipt models.StockReceipt
+	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.service.ReceiveStock(id, receipt)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrQuantityOverflow) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// HandleImport - POST /api/produk/import?dry_run=true&match=sku|name
+// The file is sent as the "file" field of a multipart form, with an optional
+// "mapping" field, or as the raw request body with the mapping in the query.
+// Mapping is a JSON object from field to header, e.g. {"name":"Nama Barang"}.
+func (h *ProductHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	query := r.URL.Query()
+	format := query.Get("format")
+	mappingJSON := query.Get("mapping")
+
+	var data []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			http.Error(w, "Invalid import file", http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Field file wajib diisi", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		if err != nil {
+			http.Error(w, "Invalid import file", http.StatusBadRequest)
+			return
+		}
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		if v := r.FormValue("mapping"); v != "" {
+			mappingJSON = v
+		}
+	default:
+		var err error
+		data, err = io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid import file", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if format == "" {
+			switch mediaType {
+			case "text/csv":
+				format = "csv"
+			case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+				format = "xlsx"
+			}
+		}
+	}
+	if format != "" && format != "csv" && format != "xlsx" {
+		http.Error(w, "Format harus csv atau xlsx", http.StatusBadRequest)
+		return
+	}
+
+	var mapping map[string]string
+	if mappingJSON != "" {
+		if err := json.Unmarshal([]byte(mappingJSON), &mapping); err != nil {
+			http.Error(w, "Invalid mapping", http.StatusBadRequest)
+			return
+		}
+	}
+	dryRun := query.Get("dry_run") == "true" || query.Get("dry_run") == "1"
+
+	result, err := h.service.Import(data, format, mapping, query.Get("match"), dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	if len(result.Errors) > 0 && !dryRun {
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleBarcode - GET /api/barcode/{code}
+func (h *ProductHandler) HandleBarcode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/api/barcode/")
+	if code == "" {
+		http.Error(w, "Invalid barcode", http.StatusBadRequest)
+		return
+	}
+
+	scan, err := h.service.ScanBarcode(code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scan)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/services"
+)
+
+type ReservationHandler struct {
+	service *services.ReservationService
+}
+
+func NewReservationHandler(service *services.ReservationService) *ReservationHandler {
+	return &ReservationHandler{service: service}
+}
+
+// HandleReservations - GET /api/reservations?product_id= and POST /api/reservations (for the store in X-Store-ID)
+func (h *ReservationHandler) HandleReservations(w http.ResponseWriter, r *http.Request) {
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		productID := 0
+		if v := r.URL.Query().Get("product_id"); v != "" {
+			productID, err = strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid product ID", http.StatusBadRequest)
+				return
+			}
+		}
+		reservations, err := h.service.GetAll(storeID, productID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reservations)
+	case http.MethodPost:
+		var res models.StockReservation
+		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		res.StoreID = storeID
+		if err := h.service.Create(&res); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, models.ErrQuantityOverflow) {
+				status = http.StatusUnprocessableEntity
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(res)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleReservationByID - GET/DELETE /api/reservations/{id}
+func (h *ReservationHandler) HandleReservationByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/reservations/"), "/"))
+	if err != nil {
+		http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		res, err := h.service.GetByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	case http.MethodDelete:
+		if err := h.service.Release(id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Reservation released successfully",
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
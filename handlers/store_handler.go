@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/services"
+)
+
+// StoreHeader selects the outlet a request is made for. When absent the
+// store_id query parameter is used; 0 means no store was selected.
+const StoreHeader = "X-Store-ID"
+
+func storeIDFromRequest(r *http.Request) (int, error) {
+	v := r.Header.Get(StoreHeader)
+	if v == "" {
+		v = r.URL.Query().Get("store_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+type StoreHandler struct {
+	service *services.StoreService
+}
+
+func NewStoreHandler(service *services.StoreService) *StoreHandler {
+	return &StoreHandler{service: service}
+}
+
+// HandleStores - GET /api/stores and POST /api/stores
+func (h *StoreHandler) HandleStores(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stores, err := h.service.GetAll()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stores)
+	case http.MethodPost:
+		var store models.Store
+		if err := json.NewDecoder(r.Body).Decode(&store); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := h.service.Create(&store); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(store)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleStoreByID - GET/PUT/DELETE /api/stores/{id}, GET/POST /api/stores/{id}/stok, PUT /api/stores/{id}/harga
+func (h *StoreHandler) HandleStoreByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/stores/"), "/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	if len(parts) > 1 {
+		switch parts[1] {
+		case "stok":
+			h.handleStock(w, r, id)
+		case "harga":
+			h.handlePrice(w, r, id)
+		default:
+			http.Error(w, "Endpoint not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		store, err := h.service.GetByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(store)
+	case http.MethodPut:
+		var store models.Store
+		if err := json.NewDecoder(r.Body).Decode(&store); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		store.ID = id
+		if err := h.service.Update(&store); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(store)
+	case http.MethodDelete:
+		if err := h.service.Delete(id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Store deleted successfully",
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *StoreHandler) handleStock(w http.ResponseWriter, r *http.Request, storeID int) {
+	switch r.Method {
+	case http.MethodGet:
+		stock, err := h.service.GetStock(storeID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stock)
+	case http.MethodPost:
+		var receipt models.StoreStockReceipt
+		if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := h.service.ReceiveStock(storeID, receipt); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, models.ErrQuantityOverflow) {
+				status = http.StatusUnprocessableEntity
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Stock received successfully",
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *StoreHandler) handlePrice(w http.ResponseWriter, r *http.Request, storeID int) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var price models.StorePrice
+	if err := json.NewDecoder(r.Body).Decode(&price); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.SetPrice(storeID, price); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(price)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/services"
+)
+
+type SyncHandler struct {
+	service *services.SyncService
+}
+
+func NewSyncHandler(service *services.SyncService) *SyncHandler {
+	return &SyncHandler{service: service}
+}
+
+// HandleSync - GET /api/sync/catalog?since= and POST /api/sync/sales (for
+// the store in X-Store-ID)
+func (h *SyncHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sync/"), "/")
+
+	switch {
+	case action == "catalog" && r.Method == http.MethodGet:
+		h.catalog(w, r)
+	case action == "sales" && r.Method == http.MethodPost:
+		h.uploadSales(w, r)
+	case action == "catalog" || action == "sales":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
+	}
+}
+
+func (h *SyncHandler) catalog(w http.ResponseWriter, r *http.Request) {
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	catalog, err := h.service.Catalog(storeID, r.URL.Query().Get("since"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case strings.Contains(err.Error(), "tidak ditemukan"):
+			status = http.StatusNotFound
+		case strings.Contains(err.Error(), "tidak valid"):
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(catalog)
+}
+
+// uploadSales answers 200 with a result per sale; the terminal keeps the
+// sales reported as error and uploads them again later.
+func (h *SyncHandler) uploadSales(w http.ResponseWriter, r *http.Request) {
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	var upload models.SyncSalesUpload
+	if err := json.NewDecoder(r.Body).Decode(&upload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.UploadSales(storeID, upload)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.Contains(err.Error(), "tidak ditemukan") {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
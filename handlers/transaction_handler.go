@@ -1,13 +1,25 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"kasir-api/models"
+	"kasir-api/receipt"
+	"kasir-api/repositories"
 	"kasir-api/services"
+	"kasir-api/spreadsheet"
 )
 
+// IdempotencyKeyHeader lets clients retry a checkout safely: a retry with the
+// same key returns the original transaction instead of selling twice.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type TransactionHandler struct {
 	service *services.TransactionService
 }
@@ -34,29 +46,390 @@ func (h *TransactionHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	transaction, err := h.service.Checkout(req.Items)
+	req.StoreID, err = storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	req.IdempotencyKey = strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+	if len(req.IdempotencyKey) > 255 {
+		http.Error(w, "Idempotency-Key too long (max 255)", http.StatusBadRequest)
+		return
+	}
+
+	transaction, err := h.service.Checkout(req)
+	var stockErr *repositories.StockConflictError
+	if errors.Is(err, repositories.ErrIdempotencyConflict) || errors.As(err, &stockErr) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrMoneyOverflow) || errors.Is(err, models.ErrQuantityOverflow) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if transaction.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 	json.NewEncoder(w).Encode(transaction)
 }
 
-// HandleReportToday - GET /api/report/hari-ini
+// HandleTransactions - GET /api/transactions?invoice=INV/UTAMA/2026/10&limit=20 (of
+// the store in X-Store-ID, or all stores), or
+// GET /api/transactions?format=csv|xlsx&from=2026-10-01&to=2026-10-31&status=paid
+// to export the transaction history
+func (h *TransactionHandler) HandleTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format != "" {
+		h.export(w, r, format, storeID)
+		return
+	}
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	transactions, err := h.service.SearchByInvoice(storeID, r.URL.Query().Get("invoice"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transactions)
+}
+
+// export streams one row per line item; a transaction without items is a
+// row of its own.
+func (h *TransactionHandler) export(w http.ResponseWriter, r *http.Request, format string, storeID int) {
+	filter := models.TransactionExportFilter{
+		StoreID: storeID,
+		From:    r.URL.Query().Get("from"),
+		To:      r.URL.Query().Get("to"),
+		Status:  r.URL.Query().Get("status"),
+	}
+	header := []string{"transaction_id", "invoice_number", "created_at", "store", "status", "payment_method",
+		"total_amount", "paid_amount", "change", "product_id", "sku", "product_name", "unit", "quantity",
+		"base_quantity", "subtotal"}
+	err := writeExport(w, format, "transaksi", header, func(write func(...spreadsheet.Cell) error) error {
+		return h.service.ExportLines(filter, func(l models.TransactionLine) error {
+			cells := []spreadsheet.Cell{
+				spreadsheet.Int(int64(l.TransactionID)),
+				spreadsheet.Text(l.InvoiceNumber),
+				spreadsheet.Text(l.CreatedAt),
+				spreadsheet.Text(l.StoreCode),
+				spreadsheet.Text(l.Status),
+				spreadsheet.Text(l.Method),
+				spreadsheet.Int(int64(l.TotalAmount)),
+				spreadsheet.Int(int64(l.PaidAmount)),
+				spreadsheet.Int(int64(l.Change)),
+			}
+			if l.ProductID != 0 {
+				cells = append(cells,
+					spreadsheet.Int(int64(l.ProductID)),
+					spreadsheet.Text(l.SKU),
+					spreadsheet.Text(l.ProductName),
+					spreadsheet.Text(l.Unit),
+					spreadsheet.Number(l.Quantity.String()),
+					spreadsheet.Number(l.BaseQuantity.String()),
+					spreadsheet.Int(int64(l.Subtotal)),
+				)
+			}
+			return write(cells...)
+		})
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.Contains(err.Error(), "tidak ditemukan") {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+	}
+}
+
+// HandleTransactionByID - GET /api/transactions/{id},
+// GET /api/transactions/{id}/receipt?format=txt|html|pdf|escpos&width=58|80 and
+// POST /api/transactions/{id}/cancel (a sale awaiting payment)
+func (h *TransactionHandler) HandleTransactionByID(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/transactions/"), "/")
+	idStr, action, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		transaction, err := h.service.GetByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transaction)
+	case action == "receipt" && r.Method == http.MethodGet:
+		h.receipt(w, r, id)
+	case action == "cancel" && r.Method == http.MethodPost:
+		transaction, err := h.service.CancelPayment(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transaction)
+	case action == "" || action == "receipt" || action == "cancel":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
+	}
+}
+
+// receipt - GET /api/transactions/{id}/receipt (text for 80mm paper by default)
+func (h *TransactionHandler) receipt(w http.ResponseWriter, r *http.Request, id int) {
+	paperMM := receipt.Paper80
+	if v := r.URL.Query().Get("width"); v != "" {
+		var err error
+		paperMM, err = strconv.Atoi(strings.TrimSuffix(v, "mm"))
+		if err != nil {
+			http.Error(w, "Invalid width", http.StatusBadRequest)
+			return
+		}
+	}
+	cols, err := receipt.Columns(paperMM)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "txt" && format != "html" && format != "pdf" && format != "escpos" {
+		http.Error(w, "Invalid format (use txt, html, pdf or escpos)", http.StatusBadRequest)
+		return
+	}
+
+	rcpt, err := h.service.GetReceipt(id)
+	if errors.Is(err, services.ErrReceiptNotPaid) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	switch format {
+	case "html":
+		// Rendered in full first, so a failure can still answer 500
+		var html bytes.Buffer
+		if err := receipt.HTML(&html, rcpt, paperMM); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(html.Bytes())
+	case "escpos":
+		// Raw printer bytes for a local print agent. The drawer opens for cash
+		// sales unless drawer=false; cut and qr default to true.
+		opts := receipt.ESCPOSOptions{Cut: true, QR: true, KickDrawer: rcpt.Payment.Method == models.PaymentCash}
+		for name, opt := range map[string]*bool{"cut": &opts.Cut, "qr": &opts.QR, "drawer": &opts.KickDrawer} {
+			if v := r.URL.Query().Get(name); v != "" {
+				if *opt, err = strconv.ParseBool(v); err != nil {
+					http.Error(w, "Invalid "+name+" (use true or false)", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="struk-%d.bin"`, id))
+		w.Write(receipt.ESCPOS(rcpt, cols, opts))
+	case "pdf":
+		pdf, err := receipt.PDF(rcpt, paperMM)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="struk-%d.pdf"`, id))
+		w.Write(pdf)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(receipt.Text(rcpt, cols)))
+	}
+}
+
+// HandleReportToday - GET /api/report/hari-ini?format=json|csv|xlsx
+// (consolidated unless a store is selected)
 func (h *TransactionHandler) HandleReportToday(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		summary, err := h.service.GetTodaySummary()
+		storeID, err := storeIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Invalid store ID", http.StatusBadRequest)
+			return
+		}
+		format, err := exportFormat(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		summary, err := h.service.GetTodaySummary(storeID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		if format != "" {
+			exportSummaries(w, format, "laporan-hari-ini", []models.ReportSummary{*summary})
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(summary)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+// HandleReportTodayPerStore - GET /api/report/hari-ini/per-toko?format=json|csv|xlsx
+func (h *TransactionHandler) HandleReportTodayPerStore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summaries, err := h.service.GetTodaySummaryPerStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format != "" {
+		exportSummaries(w, format, "laporan-per-toko", summaries)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// HandleReportTodayPerCategory - GET /api/report/hari-ini/per-kategori?category_id=&format=json|csv|xlsx
+// (for the store in X-Store-ID, or all stores)
+func (h *TransactionHandler) HandleReportTodayPerCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+	categoryID := 0
+	if v := r.URL.Query().Get("category_id"); v != "" {
+		if categoryID, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid category_id", http.StatusBadRequest)
+			return
+		}
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sales, err := h.service.GetTodaySalesPerCategory(storeID, categoryID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "tidak ditemukan") {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if format != "" {
+		header := []string{"category_id", "parent_id", "name", "total_revenue", "total_transaksi"}
+		err := writeExport(w, format, "laporan-per-kategori", header, func(write func(...spreadsheet.Cell) error) error {
+			for _, cs := range sales {
+				parent := spreadsheet.Text("")
+				if cs.ParentID != nil {
+					parent = spreadsheet.Int(int64(*cs.ParentID))
+				}
+				err := write(
+					spreadsheet.Int(int64(cs.CategoryID)),
+					parent,
+					spreadsheet.Text(cs.Name),
+					spreadsheet.Int(int64(cs.TotalRevenue)),
+					spreadsheet.Int(int64(cs.TotalTransaksi)),
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sales)
+}
+
+func exportSummaries(w http.ResponseWriter, format, name string, summaries []models.ReportSummary) {
+	header := []string{"store_id", "store_name", "total_revenue", "total_transaksi", "produk_terlaris", "qty_terjual"}
+	err := writeExport(w, format, name, header, func(write func(...spreadsheet.Cell) error) error {
+		for _, s := range summaries {
+			// A consolidated summary has no store
+			store := spreadsheet.Text("")
+			if s.StoreID != nil {
+				store = spreadsheet.Int(int64(*s.StoreID))
+			}
+			err := write(
+				store,
+				spreadsheet.Text(s.StoreName),
+				spreadsheet.Int(int64(s.TotalRevenue)),
+				spreadsheet.Int(int64(s.TotalTransaksi)),
+				spreadsheet.Text(s.ProdukTerlaris.Nama),
+				spreadsheet.Number(s.ProdukTerlaris.QtyTerjual.String()),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
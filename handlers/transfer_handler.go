@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/repositories"
+	"kasir-api/services"
+)
+
+type TransferHandler struct {
+	service *services.TransferService
+}
+
+func NewTransferHandler(service *services.TransferService) *TransferHandler {
+	return &TransferHandler{service: service}
+}
+
+// HandleTransfers - GET /api/transfers?status= and POST /api/transfers
+func (h *TransferHandler) HandleTransfers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		transfers, err := h.service.GetAll(r.URL.Query().Get("status"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transfers)
+	case http.MethodPost:
+		var transfer models.StockTransfer
+		if err := json.NewDecoder(r.Body).Decode(&transfer); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := h.service.Create(&transfer); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, models.ErrQuantityOverflow) {
+				status = http.StatusUnprocessableEntity
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(transfer)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleTransferByID - GET/PUT /api/transfers/{id}, POST /api/transfers/{id}/{send|receive|cancel}
+// and GET /api/transfers/in-transit
+func (h *TransferHandler) HandleTransferByID(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/transfers/"), "/")
+	if path == "in-transit" {
+		h.handleInTransit(w, r)
+		return
+	}
+
+	idStr, action, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+		return
+	}
+
+	var transfer *models.StockTransfer
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		transfer, err = h.service.GetByID(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	case action == "" && r.Method == http.MethodPut:
+		var req models.StockTransfer
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		transfer, err = h.service.UpdateItems(id, req.Items)
+	case action == "send" && r.Method == http.MethodPost:
+		transfer, err = h.service.Send(id)
+	case action == "receive" && r.Method == http.MethodPost:
+		var receipt models.TransferReceipt
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		transfer, err = h.service.Receive(id, receipt)
+	case action == "cancel" && r.Method == http.MethodPost:
+		transfer, err = h.service.Cancel(id)
+	case action == "" || action == "send" || action == "receive" || action == "cancel":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
+		return
+	}
+	var stockErr *repositories.StockConflictError
+	if errors.As(err, &stockErr) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrQuantityOverflow) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// handleInTransit - GET /api/transfers/in-transit (optionally for the store in X-Store-ID)
+func (h *TransferHandler) handleInTransit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	storeID, err := storeIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	stock, err := h.service.GetInTransit(storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stock)
+}
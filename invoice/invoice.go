@@ -0,0 +1,119 @@
+// Package invoice formats the human-readable invoice numbers of sales, such as
+// INV/UTAMA/2026/10/00042.
+package invoice
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFormat numbers sales per store per month.
+const DefaultFormat = "INV/{STORE}/{YYYY}/{MM}/{SEQ:5}"
+
+// Format is an invoice number pattern. Tokens:
+//
+//	{STORE}  store code
+//	{YYYY}   year, {YY} two-digit year
+//	{MM}     month
+//	{DD}     day
+//	{SEQ}    sequence number, {SEQ:n} zero-padded to n digits
+//
+// The sequence restarts every period, which is the smallest date unit in the
+// pattern: daily with {DD}, monthly with {MM}, yearly with {YYYY} or {YY} and
+// never without any of them. Every store counts its own sequence, so without
+// {STORE} two stores hand out the same numbers.
+type Format string
+
+var tokenPattern = regexp.MustCompile(`\{([A-Z]+)(?::(\d+))?\}`)
+
+// ParseFormat checks a pattern for a business with the given number of
+// stores; empty means DefaultFormat. With more than one store the pattern
+// must contain {STORE}.
+func ParseFormat(s string, stores int) (Format, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultFormat, nil
+	}
+
+	seq := false
+	for _, m := range tokenPattern.FindAllStringSubmatch(s, -1) {
+		switch m[1] {
+		case "SEQ":
+			seq = true
+			if m[2] != "" {
+				if width, _ := strconv.Atoi(m[2]); width < 1 || width > 12 {
+					return "", fmt.Errorf("invalid sequence width in invoice format %q (use 1 to 12)", s)
+				}
+			}
+		case "STORE", "YYYY", "YY", "MM", "DD":
+			if m[2] != "" {
+				return "", fmt.Errorf("invalid token %s in invoice format %q", m[0], s)
+			}
+		default:
+			return "", fmt.Errorf("unknown token %s in invoice format %q", m[0], s)
+		}
+	}
+	if !seq {
+		return "", fmt.Errorf("invoice format %q has no {SEQ} token", s)
+	}
+	if len(s) > 40 {
+		return "", fmt.Errorf("invoice format %q too long (max 40)", s)
+	}
+	if stores > 1 && !Format(s).PerStore() {
+		return "", fmt.Errorf("invoice format %q has no {STORE} token, so the %d stores would issue the same numbers", s, stores)
+	}
+
+	return Format(s), nil
+}
+
+// Period is the key the sequence is counted under for a sale made at t.
+func (f Format) Period(t time.Time) string {
+	switch {
+	case f.has("DD"):
+		return t.Format("2006-01-02")
+	case f.has("MM"):
+		return t.Format("2006-01")
+	case f.has("YYYY"), f.has("YY"):
+		return t.Format("2006")
+	default:
+		return ""
+	}
+}
+
+// Number formats the invoice number of the seq'th sale of a store in the
+// period of t.
+func (f Format) Number(storeCode string, t time.Time, seq int64) string {
+	return tokenPattern.ReplaceAllStringFunc(string(f), func(token string) string {
+		m := tokenPattern.FindStringSubmatch(token)
+		switch m[1] {
+		case "STORE":
+			return storeCode
+		case "YYYY":
+			return t.Format("2006")
+		case "YY":
+			return t.Format("06")
+		case "MM":
+			return t.Format("01")
+		case "DD":
+			return t.Format("02")
+		case "SEQ":
+			width, _ := strconv.Atoi(m[2])
+			return fmt.Sprintf("%0*d", width, seq)
+		default:
+			return token
+		}
+	})
+}
+
+// PerStore reports whether numbers of different stores differ, that is
+// whether the pattern contains {STORE}.
+func (f Format) PerStore() bool {
+	return f.has("STORE")
+}
+
+func (f Format) has(token string) bool {
+	return strings.Contains(string(f), "{"+token+"}")
+}
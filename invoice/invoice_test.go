@@ -0,0 +1,94 @@
+package invoice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		stores  int
+		want    Format
+		wantErr bool
+	}{
+		{"empty is default", "", 1, DefaultFormat, false},
+		{"blank is default", "  ", 3, DefaultFormat, false},
+		{"default with several stores", string(DefaultFormat), 3, DefaultFormat, false},
+		{"daily", "{STORE}-{YY}{MM}{DD}-{SEQ:4}", 2, "{STORE}-{YY}{MM}{DD}-{SEQ:4}", false},
+		{"no store, one store", "INV/{YYYY}/{SEQ}", 1, "INV/{YYYY}/{SEQ}", false},
+		{"no store, several stores", "INV/{YYYY}/{SEQ}", 2, "", true},
+		{"no sequence", "INV/{STORE}/{YYYY}", 1, "", true},
+		{"unknown token", "INV/{STORE}/{HH}/{SEQ}", 1, "", true},
+		{"width on a date", "INV/{STORE}/{MM:2}/{SEQ}", 1, "", true},
+		{"zero width", "{STORE}{SEQ:0}", 1, "", true},
+		{"too wide", "{STORE}{SEQ:13}", 1, "", true},
+		{"too long", "INVOICE-OF-THE-STORE/{STORE}/{YYYY}/{MM}/{SEQ:5}", 1, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormat(tt.format, tt.stores)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseFormat(%q, %d) = %q, want an error", tt.format, tt.stores, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFormat(%q, %d): %v", tt.format, tt.stores, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat(%q, %d) = %q, want %q", tt.format, tt.stores, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatPeriod(t *testing.T) {
+	at := time.Date(2026, 10, 5, 23, 59, 0, 0, time.UTC)
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{DefaultFormat, "2026-10"},
+		{"{STORE}/{YYYY}/{MM}/{DD}/{SEQ}", "2026-10-05"},
+		{"{STORE}/{YY}/{SEQ}", "2026"},
+		{"{STORE}/{YYYY}/{SEQ}", "2026"},
+		{"{STORE}/{SEQ:8}", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.format.Period(at); got != tt.want {
+			t.Errorf("%q.Period() = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	at := time.Date(2026, 1, 7, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		format Format
+		seq    int64
+		want   string
+	}{
+		{DefaultFormat, 42, "INV/UTAMA/2026/01/00042"},
+		{"{STORE}-{YY}{MM}{DD}-{SEQ:4}", 7, "UTAMA-260107-0007"},
+		{"{STORE}/{SEQ}", 123, "UTAMA/123"},
+		{"{STORE}/{SEQ:3}", 12345, "UTAMA/12345"},
+		{"{STORE}/{YYYY}/{SEQ}", 1, "UTAMA/2026/1"},
+	}
+	for _, tt := range tests {
+		if got := tt.format.Number("UTAMA", at, tt.seq); got != tt.want {
+			t.Errorf("%q.Number(%d) = %q, want %q", tt.format, tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestFormatPerStore(t *testing.T) {
+	if !Format(DefaultFormat).PerStore() {
+		t.Error("DefaultFormat does not tell stores apart")
+	}
+	if Format("INV/{YYYY}/{SEQ}").PerStore() {
+		t.Error("format without {STORE} reported per store")
+	}
+}
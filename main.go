@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"kasir-api/database"
 	"kasir-api/handlers"
+	"kasir-api/invoice"
+	"kasir-api/models"
+	"kasir-api/outbox"
+	"kasir-api/payment"
+	"kasir-api/receipt"
 	"kasir-api/repositories"
 	"kasir-api/services"
 
@@ -28,6 +35,128 @@ func maskConnectionString(connStr string) string {
 	return connStr[:20] + "***MASKED***" + connStr[len(connStr)-20:]
 }
 
+// receiptConfig reads the receipt header, footer and tax settings
+func receiptConfig() receipt.Config {
+	taxRate, err := receipt.ParseRate(viper.GetString("RECEIPT_TAX_RATE"))
+	if err != nil {
+		log.Printf("WARNING: %v, printing receipts without tax\n", err)
+	}
+	return receipt.Config{
+		StoreName:    viper.GetString("RECEIPT_STORE_NAME"),
+		StoreAddress: viper.GetString("RECEIPT_STORE_ADDRESS"),
+		StoreNPWP:    viper.GetString("RECEIPT_STORE_NPWP"),
+		Footer:       strings.ReplaceAll(viper.GetString("RECEIPT_FOOTER"), `\n`, "\n"),
+		TaxLabel:     viper.GetString("RECEIPT_TAX_LABEL"),
+		TaxRate:      taxRate,
+	}
+}
+
+// invoiceFormat reads the invoice number pattern, which must tell the
+// existing stores apart
+func invoiceFormat(storeRepo *repositories.StoreRepository) invoice.Format {
+	stores, err := storeRepo.GetAll()
+	if err != nil {
+		log.Printf("WARNING: counting stores for INVOICE_FORMAT: %v\n", err)
+	}
+	format, err := invoice.ParseFormat(viper.GetString("INVOICE_FORMAT"), len(stores))
+	if err != nil {
+		log.Printf("WARNING: %v, using %s\n", err, invoice.DefaultFormat)
+		return invoice.DefaultFormat
+	}
+	return format
+}
+
+// paymentGateway reads the gateway taking QRIS payments; nil records QRIS
+// sales as paid at checkout
+func paymentGateway() payment.Gateway {
+	switch gateway := strings.ToLower(viper.GetString("PAYMENT_GATEWAY")); gateway {
+	case "":
+		return nil
+	case "midtrans":
+		if viper.GetString("MIDTRANS_SERVER_KEY") == "" {
+			log.Println("WARNING: MIDTRANS_SERVER_KEY not set, payment notifications will be rejected")
+		}
+		return payment.NewMidtrans(viper.GetString("MIDTRANS_SERVER_KEY"), viper.GetString("MIDTRANS_BASE_URL"))
+	case "fake":
+		if viper.GetString("PAYMENT_CALLBACK_TOKEN") == "" {
+			log.Println("WARNING: PAYMENT_CALLBACK_TOKEN not set, payment notifications will be rejected")
+		}
+		return payment.NewFake(viper.GetString("PAYMENT_CALLBACK_TOKEN"))
+	default:
+		log.Printf("WARNING: unknown PAYMENT_GATEWAY %q, QRIS sales are recorded as paid\n", gateway)
+		return nil
+	}
+}
+
+// paymentTTL reads how long a QRIS code stays payable
+func paymentTTL() time.Duration {
+	ttl := 15 * time.Minute
+	if v := viper.GetString("PAYMENT_QRIS_TTL"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < time.Minute {
+			log.Printf("WARNING: invalid PAYMENT_QRIS_TTL %q, using %s\n", v, ttl)
+			return ttl
+		}
+		ttl = parsed
+	}
+	return ttl
+}
+
+// lowStockThreshold reads the stock level (in base units) at which a sale
+// queues stock.low; 0 disables it
+func lowStockThreshold() models.Quantity {
+	threshold := models.NewQuantity(5)
+	if v := viper.GetString("LOW_STOCK_THRESHOLD"); v != "" {
+		parsed, err := models.ParseQuantity(v)
+		if err != nil || parsed < 0 {
+			log.Printf("WARNING: invalid LOW_STOCK_THRESHOLD %q, using %s\n", v, threshold)
+			return threshold
+		}
+		threshold = parsed
+	}
+	return threshold
+}
+
+// outboxSinks reads where outbox events go: a comma-separated list of
+// webhook (the subscriptions), log, http (OUTBOX_HTTP_URL) and nats (NATS_URL)
+func outboxSinks(webhooks *services.WebhookService) []outbox.Sink {
+	names := viper.GetString("OUTBOX_SINKS")
+	if names == "" {
+		names = "webhook"
+	}
+
+	sinks := make([]outbox.Sink, 0)
+	for _, name := range strings.Split(names, ",") {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "":
+		case "webhook":
+			sinks = append(sinks, webhooks)
+		case "log":
+			sinks = append(sinks, outbox.LogSink{})
+		case "http":
+			if viper.GetString("OUTBOX_HTTP_URL") == "" {
+				log.Println("WARNING: OUTBOX_HTTP_URL not set, http sink disabled")
+				continue
+			}
+			sinks = append(sinks, outbox.NewHTTPSink(viper.GetString("OUTBOX_HTTP_URL")))
+		case "nats":
+			prefix := viper.GetString("NATS_SUBJECT_PREFIX")
+			if prefix == "" {
+				prefix = "kasir."
+			}
+			sink, err := outbox.NewNATSSink(viper.GetString("NATS_URL"), prefix)
+			if err != nil {
+				log.Printf("WARNING: %v, nats sink disabled\n", err)
+				continue
+			}
+			sinks = append(sinks, sink)
+		default:
+			log.Printf("WARNING: unknown outbox sink %q ignored\n", name)
+		}
+	}
+	return sinks
+}
+
 func main() {
 	// Load environment variables
 	viper.AutomaticEnv()
@@ -96,22 +225,101 @@ func main() {
   "endpoints": {
     "health": "GET /health - Check API status",
     "categories": {
-      "list": "GET /categories - List all categories",
-      "create": "POST /categories - Create new category",
+      "list": "GET /categories?name=&sort=name|-name&limit=&offset=|after= - List categories (paged like products)",
+      "tree": "GET /categories?tree=true - All categories nested under their parents",
+      "create": "POST /categories - Create new category (parent_id optional)",
       "detail": "GET /categories/{id} - Get category by ID",
       "update": "PUT /categories/{id} - Update category",
-      "delete": "DELETE /categories/{id} - Delete category"
+      "delete": "DELETE /categories/{id} - Delete category (subcategories move up to its parent)",
+      "move": "POST /categories/{id}/move - Move a category and its subcategories under parent_id (null: top level)"
     },
     "products": {
-			"list": "GET /api/produk?name=indom - Search products by name",
+			"list": "GET /api/produk?name=indom&category_id=&min_price=&max_price=&in_stock=true&sort=name|price|stock|-price&limit=50&offset=|after={cursor} - List products (category_id includes subcategories); X-Total-Count and X-Next-Cursor headers",
+      "export": "GET /api/produk?format=csv|xlsx - Export products as CSV or Excel (same filters and sort)",
+      "search": "GET /api/produk/search?q=indomi&limit=20&offset= - Ranked search by name, SKU, barcode and category; prefixes and typos match, results carry score and highlight (same filters as list)",
       "create": "POST /api/produk - Create new product",
       "detail": "GET /api/produk/{id} - Get product by ID",
       "update": "PUT /api/produk/{id} - Update product",
-      "delete": "DELETE /api/produk/{id} - Delete product"
+      "delete": "DELETE /api/produk/{id} - Delete product",
+      "units": "GET/POST /api/produk/{id}/units - List or add units of measure (e.g. pack, karton)",
+      "delete_unit": "DELETE /api/produk/{id}/units/{unitId} - Delete unit of measure",
+      "receive_stock": "POST /api/produk/{id}/stok - Receive stock in any unit (stored in base unit)",
+      "import": "POST /api/produk/import?dry_run=true&match=sku - Bulk create/update products from CSV or XLSX, all or nothing",
+      "barcode": "GET /api/barcode/{code} - Resolve barcode, incl. 2x scale labels with weight/price"
 		},
 		"transactions": {
-			"checkout": "POST /api/checkout - Create transaction from cart items",
-			"report_hari_ini": "GET /api/report/hari-ini - Sales summary today"
+			"checkout": "POST /api/checkout - Create transaction from cart items (reservation_ids converts reservations, payment_method, paid_amount)",
+			"search": "GET /api/transactions?invoice=INV/UTAMA/2026/10 - Find transactions by invoice number",
+			"export": "GET /api/transactions?format=csv|xlsx&from=2026-10-01&to=2026-10-31&status=paid - Export transaction line items",
+			"detail": "GET /api/transactions/{id} - Get transaction with items, invoice number and payment",
+			"receipt": "GET /api/transactions/{id}/receipt?format=txt|html|pdf|escpos&width=58|80 - Printable receipt of a paid sale (escpos: raw printer bytes, cut/qr/drawer=true|false)",
+			"cancel": "POST /api/transactions/{id}/cancel - Cancel a sale awaiting QRIS payment, releasing its stock",
+			"payment_webhook": "POST /api/payments/webhook/{gateway} - Payment notifications (midtrans, fake); a payment finalizes a pending_payment sale, or marks it refund_required",
+			"report_hari_ini": "GET /api/report/hari-ini?format=json|csv|xlsx - Sales summary today (all stores, or the store in X-Store-ID)",
+			"report_per_toko": "GET /api/report/hari-ini/per-toko?format=json|csv|xlsx - Sales summary today per store",
+			"report_per_kategori": "GET /api/report/hari-ini/per-kategori?category_id=&format=json|csv|xlsx - Sales today per category, including subcategories"
+    },
+    "carts": {
+      "list": "GET /api/carts?status=open|held|checked_out|expired - Server-side carts (of the store in X-Store-ID)",
+      "create": "POST /api/carts - Open a cart for the store in X-Store-ID",
+      "detail": "GET/DELETE /api/carts/{id} - Get or discard a cart",
+      "add_item": "POST /api/carts/{id}/items - Add product_id or barcode with quantity and unit",
+      "item": "PUT/DELETE /api/carts/{id}/items/{itemId} - Change quantity or remove a line",
+      "hold": "POST /api/carts/{id}/hold - Park the cart to serve the next customer",
+      "resume": "POST /api/carts/{id}/resume - Reopen a held cart, repricing its lines",
+      "recalculate": "POST /api/carts/{id}/recalculate - Reprice lines at current prices",
+      "checkout": "POST /api/carts/{id}/checkout - Finalize the cart as a transaction"
+    },
+    "reservations": {
+      "note": "Open carts reserve their lines automatically; products report available = stock - reserved",
+      "list": "GET /api/reservations?product_id={id} - Active reservations (of the store in X-Store-ID)",
+      "create": "POST /api/reservations - Reserve stock for a pending order (product_id, quantity, unit, reference, ttl_minutes)",
+      "detail": "GET /api/reservations/{id} - Get reservation",
+      "release": "DELETE /api/reservations/{id} - Release (cancel) a reservation"
+    },
+    "events": {
+      "note": "Server-Sent Events; kinds: transaction (transaction.created|paid), stock (stock.changed|low), totals (running daily totals); heartbeat every 15s",
+      "stream": "GET /api/events?types=transaction,stock,totals - Live stream for the store in X-Store-ID (or all stores); reconnect with Last-Event-ID to get missed events"
+    },
+    "sync": {
+      "note": "Offline terminals: download the catalog, sell offline, upload sales with client UUIDs (idempotent)",
+      "catalog": "GET /api/sync/catalog?since={token} - Catalog of the store in X-Store-ID; all of it without since, else changes and deleted ids",
+      "sales": "POST /api/sync/sales - Upload offline sales (client_id, sold_at, items, payment_method, paid_amount, total_amount); result per sale: created, duplicate, conflict, rejected or error"
+    },
+    "webhooks": {
+      "note": "Events: transaction.created, transaction.paid, transaction.refund_required, product.created|updated|deleted, category.created|updated|deleted, stock.low (or *); signed with X-Kasir-Signature; written to the outbox with the change, delivered at least once",
+      "list": "GET /api/webhooks - List subscriptions",
+      "create": "POST /api/webhooks - Subscribe a URL to events (url, events, secret optional)",
+      "detail": "GET/PUT/DELETE /api/webhooks/{id} - Get, update or delete a subscription",
+      "deliveries": "GET /api/webhooks/{id}/deliveries?status=pending|delivered|failed - Delivery log",
+      "replay": "POST /api/webhooks/{id}/deliveries/{deliveryId}/replay - Send a delivery again"
+    },
+    "stores": {
+      "note": "Select the outlet per request with header X-Store-ID (or ?store_id=); default is the main store",
+      "list": "GET /api/stores - List stores",
+      "create": "POST /api/stores - Create store",
+      "detail": "GET/PUT/DELETE /api/stores/{id} - Get, update or delete store",
+      "stock": "GET/POST /api/stores/{id}/stok - Stock and prices at a store / receive stock into a store",
+      "price": "PUT /api/stores/{id}/harga - Set or clear (price null) a per-store price override"
+    },
+    "transfers": {
+      "list": "GET /api/transfers?status=draft|sent|received|cancelled - List stock transfers",
+      "create": "POST /api/transfers - Create draft transfer between stores",
+      "detail": "GET/PUT /api/transfers/{id} - Get transfer / replace items of a draft",
+      "send": "POST /api/transfers/{id}/send - Take stock out of the source store",
+      "receive": "POST /api/transfers/{id}/receive - Add received stock to destination, recording discrepancies",
+      "cancel": "POST /api/transfers/{id}/cancel - Cancel a draft",
+      "in_transit": "GET /api/transfers/in-transit - Stock sent but not yet received"
+    },
+    "batches": {
+      "list": "GET /api/batches?product_id={id} - Stock batches of a product (FEFO order)",
+      "write_off": "POST /api/batches/{id}/write-off - Write off remaining stock of a batch",
+      "write_off_expired": "POST /api/batches/write-off-expired - Write off all expired batches",
+      "report_kadaluarsa": "GET /api/report/kadaluarsa?hari=7&format=json|csv|xlsx - Batches expiring within N days"
+    },
+    "admin": {
+      "note": "Requires Authorization: Bearer {ADMIN_TOKEN}; disabled when ADMIN_TOKEN is not set",
+      "backup": "GET /api/admin/backup - Versioned JSON-lines archive of stores, catalog, stock, transactions and details; restore into an empty database with go run ./cmd/restore"
     }
   },
   "repository": "https://github.com/DarmawanKristiaji/go-kasir",
@@ -154,6 +362,28 @@ func main() {
 	if db != nil {
 		// defer db.Close()  // Don't close immediately, keep connection open for server lifetime
 
+		// Dependency Injection - Store (outlet)
+		storeRepo := repositories.NewStoreRepository(db)
+		numbering := invoiceFormat(storeRepo)
+		storeService := services.NewStoreService(storeRepo, numbering)
+		storeHandler := handlers.NewStoreHandler(storeService)
+
+		http.HandleFunc("/api/stores", storeHandler.HandleStores)
+		http.HandleFunc("/api/stores/", storeHandler.HandleStoreByID)
+
+		// Dependency Injection - Outbound webhooks (sent in the background)
+		webhookRepo := repositories.NewWebhookRepository(db)
+		webhookService := services.NewWebhookService(webhookRepo)
+		webhookHandler := handlers.NewWebhookHandler(webhookService)
+
+		http.HandleFunc("/api/webhooks", webhookHandler.HandleWebhooks)
+		http.HandleFunc("/api/webhooks/", webhookHandler.HandleWebhookByID)
+		go webhookService.Run(context.Background())
+
+		// Events committed to the outbox are handed to the sinks in the background
+		outboxRepo := repositories.NewOutboxRepository(db)
+		go outbox.NewDispatcher(outboxRepo, outboxSinks(webhookService)...).Run(context.Background())
+
 		// Dependency Injection - Product
 		productRepo := repositories.NewProductRepository(db)
 		productService := services.NewProductService(productRepo)
@@ -169,6 +399,7 @@ func main() {
 		}
 		http.HandleFunc("/api/produk", productRouter)
 		http.HandleFunc("/api/produk/", productRouter)
+		http.HandleFunc("/api/barcode/", productHandler.HandleBarcode)
 
 		// Dependency Injection - Category
 		categoryRepo := repositories.NewCategoryRepository(db)
@@ -187,45 +418,110 @@ func main() {
 		http.HandleFunc("/categories/", categoryRouter)
 
 		// Dependency Injection - Transaction
-		transactionRepo := repositories.NewTransactionRepository(db)
-		transactionService := services.NewTransactionService(transactionRepo)
+		transactionRepo := repositories.NewTransactionRepository(db, numbering, lowStockThreshold())
+		transactionService := services.NewTransactionService(transactionRepo, storeRepo, productService, receiptConfig(),
+			paymentGateway(), paymentTTL())
 		transactionHandler := handlers.NewTransactionHandler(transactionService)
 
 		http.HandleFunc("/api/checkout", transactionHandler.HandleCheckout)
+		http.HandleFunc("/api/transactions", transactionHandler.HandleTransactions)
+		http.HandleFunc("/api/transactions/", transactionHandler.HandleTransactionByID)
 		http.HandleFunc("/api/report/hari-ini", transactionHandler.HandleReportToday)
+		http.HandleFunc("/api/report/hari-ini/per-toko", transactionHandler.HandleReportTodayPerStore)
+		http.HandleFunc("/api/report/hari-ini/per-kategori", transactionHandler.HandleReportTodayPerCategory)
+
+		// Payment gateway notifications
+		paymentHandler := handlers.NewPaymentHandler(transactionService)
+
+		http.HandleFunc("/api/payments/webhook/", paymentHandler.HandleWebhook)
+
+		// Live event stream (Server-Sent Events) read from the outbox
+		eventStreamService := services.NewEventStreamService(outboxRepo, storeRepo, transactionService)
+		eventHandler := handlers.NewEventHandler(eventStreamService)
+
+		http.HandleFunc("/api/events", eventHandler.HandleEvents)
+		go eventStreamService.Run(context.Background())
+
+		// Dependency Injection - Stock batches
+		batchRepo := repositories.NewBatchRepository(db)
+		batchService := services.NewBatchService(batchRepo)
+		batchHandler := handlers.NewBatchHandler(batchService)
+
+		http.HandleFunc("/api/batches", batchHandler.HandleBatches)
+		http.HandleFunc("/api/batches/", batchHandler.HandleBatchByID)
+		http.HandleFunc("/api/report/kadaluarsa", batchHandler.HandleExpiringReport)
+
+		// Dependency Injection - Stock transfers between stores
+		transferRepo := repositories.NewTransferRepository(db)
+		transferService := services.NewTransferService(transferRepo)
+		transferHandler := handlers.NewTransferHandler(transferService)
+
+		http.HandleFunc("/api/transfers", transferHandler.HandleTransfers)
+		http.HandleFunc("/api/transfers/", transferHandler.HandleTransferByID)
+
+		// Dependency Injection - Offline sync for cashier terminals
+		syncRepo := repositories.NewSyncRepository(db)
+		syncService := services.NewSyncService(syncRepo, storeRepo, transactionService, productService)
+		syncHandler := handlers.NewSyncHandler(syncService)
+
+		http.HandleFunc("/api/sync/", syncHandler.HandleSync)
+
+		// Dependency Injection - Server-side carts (hold / resume)
+		cartRepo := repositories.NewCartRepository(db)
+		cartService := services.NewCartService(cartRepo, transactionService, productService)
+		cartHandler := handlers.NewCartHandler(cartService)
+
+		http.HandleFunc("/api/carts", cartHandler.HandleCarts)
+		http.HandleFunc("/api/carts/", cartHandler.HandleCartByID)
+
+		// Dependency Injection - Stock reservations (pending orders)
+		reservationRepo := repositories.NewReservationRepository(db)
+		reservationService := services.NewReservationService(reservationRepo)
+		reservationHandler := handlers.NewReservationHandler(reservationService)
+
+		http.HandleFunc("/api/reservations", reservationHandler.HandleReservations)
+		http.HandleFunc("/api/reservations/", reservationHandler.HandleReservationByID)
+
+		// Dependency Injection - Backup (restore runs offline: cmd/restore)
+		backupRepo := repositories.NewBackupRepository(db)
+		backupService := services.NewBackupService(backupRepo)
+		if viper.GetString("ADMIN_TOKEN") == "" {
+			log.Println("WARNING: ADMIN_TOKEN not set, admin endpoints are disabled")
+		}
+		adminHandler := handlers.NewAdminHandler(backupService, viper.GetString("ADMIN_TOKEN"))
+
+		http.HandleFunc("/api/admin/backup", adminHandler.HandleBackup)
 	} else {
 		log.Println("WARNING: No database connection - routes disabled")
 		// Still register placeholder endpoints for debugging
-		http.HandleFunc("/api/produk", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, `{"status":"error","message":"Database not connected"}`)
-		})
-		http.HandleFunc("/api/produk/", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, `{"status":"error","message":"Database not connected"}`)
-		})
-		http.HandleFunc("/categories", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, `{"status":"error","message":"Database not connected"}`)
-		})
-		http.HandleFunc("/categories/", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, `{"status":"error","message":"Database not connected"}`)
-		})
-		http.HandleFunc("/api/checkout", func(w http.ResponseWriter, r *http.Request) {
+		dbNotConnected := func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusServiceUnavailable)
 			fmt.Fprintf(w, `{"status":"error","message":"Database not connected"}`)
-		})
-		http.HandleFunc("/api/report/hari-ini", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, `{"status":"error","message":"Database not connected"}`)
-		})
+		}
+		for _, path := range []string{
+			"/api/produk", "/api/produk/",
+			"/categories", "/categories/",
+			"/api/barcode/",
+			"/api/checkout",
+			"/api/transactions", "/api/transactions/",
+			"/api/report/hari-ini",
+			"/api/batches", "/api/batches/",
+			"/api/report/kadaluarsa",
+			"/api/stores", "/api/stores/",
+			"/api/report/hari-ini/per-toko",
+			"/api/report/hari-ini/per-kategori",
+			"/api/transfers", "/api/transfers/",
+			"/api/carts", "/api/carts/",
+			"/api/reservations", "/api/reservations/",
+			"/api/payments/webhook/",
+			"/api/webhooks", "/api/webhooks/",
+			"/api/events",
+			"/api/sync/",
+			"/api/admin/backup",
+		} {
+			http.HandleFunc(path, dbNotConnected)
+		}
 	}
 
 	// Start server
@@ -1,52 +1,724 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Product struct {
-	ID           int    `json:"id"`
-	Name         string `json:"name"`
-	Price        int    `json:"price"`
-	Stock        int    `json:"stock"`
-	CategoryID   *int   `json:"category_id"`
-	CategoryName string `json:"category_name"`
+	ID           int           `json:"id"`
+	Name         string        `json:"name"`
+	Price        Money         `json:"price"`
+	Stock        Quantity      `json:"stock"`
+	Available    Quantity      `json:"available"`
+	BaseUnit     string        `json:"base_unit"`
+	SoldByWeight bool          `json:"sold_by_weight"`
+	SKU          string        `json:"sku"`
+	Barcode      string        `json:"barcode"`
+	CategoryID   *int          `json:"category_id"`
+	CategoryName string        `json:"category_name"`
+	Units        []ProductUnit `json:"units,omitempty"`
+}
+
+// ProductUnit is an alternative selling/receiving unit of a product.
+// ConversionFactor is the number of base units contained in one of this unit
+// (e.g. 1 karton = 24 pcs).
+type ProductUnit struct {
+	ID               int      `json:"id"`
+	ProductID        int      `json:"product_id"`
+	Name             string   `json:"name"`
+	ConversionFactor Quantity `json:"conversion_factor"`
+	Price            Money    `json:"price"`
+}
+
+// StockReceipt is stock received into the shop, expressed in any defined unit.
+// Every receipt becomes a batch; ExpiryDate (YYYY-MM-DD) is set for perishables.
+type StockReceipt struct {
+	Quantity   Quantity `json:"quantity"`
+	Unit       string   `json:"unit"`
+	BatchCode  string   `json:"batch_code,omitempty"`
+	ExpiryDate *string  `json:"expiry_date,omitempty"`
+}
+
+// StockBatch is a received lot of a product. Quantity is what remains of it
+// in the base unit; batches are consumed first-expiry-first-out at checkout.
+type StockBatch struct {
+	ID              int      `json:"id"`
+	ProductID       int      `json:"product_id"`
+	ProductName     string   `json:"product_name,omitempty"`
+	BatchCode       string   `json:"batch_code"`
+	Quantity        Quantity `json:"quantity"`
+	InitialQuantity Quantity `json:"initial_quantity"`
+	ExpiryDate      *string  `json:"expiry_date"`
+	DaysLeft        *int     `json:"days_left,omitempty"`
+	ReceivedAt      string   `json:"received_at"`
+	WrittenOffAt    *string  `json:"written_off_at,omitempty"`
+}
+
+// StockWriteOff records stock removed from a batch, e.g. because it expired.
+type StockWriteOff struct {
+	ID        int      `json:"id"`
+	BatchID   int      `json:"batch_id"`
+	ProductID int      `json:"product_id"`
+	Quantity  Quantity `json:"quantity"`
+	Reason    string   `json:"reason"`
+	CreatedAt string   `json:"created_at"`
 }
 
+// Category is a product category; ParentID is nil for a top-level one.
 type Category struct {
 	ID          int    `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	ParentID    *int   `json:"parent_id"`
+}
+
+// CategoryNode is a category in the category tree, with its subcategories.
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+// CategoryMove moves a category, with everything below it, under another
+// category, or to the top level when ParentID is nil.
+type CategoryMove struct {
+	ParentID *int `json:"parent_id"`
+}
+
+// CategorySales is a category's paid sales, including those of all its
+// subcategories.
+type CategorySales struct {
+	CategoryID     int    `json:"category_id"`
+	ParentID       *int   `json:"parent_id"`
+	Name           string `json:"name"`
+	TotalRevenue   Money  `json:"total_revenue"`
+	TotalTransaksi int    `json:"total_transaksi"`
+}
+
+// Payment methods
+const (
+	PaymentCash     = "cash"
+	PaymentDebit    = "debit"
+	PaymentCredit   = "credit"
+	PaymentQRIS     = "qris"
+	PaymentTransfer = "transfer"
+	PaymentEWallet  = "ewallet"
+)
+
+// Payment is how a sale was paid: the amount tendered and the change handed
+// back.
+type Payment struct {
+	Method     string `json:"payment_method"`
+	PaidAmount Money  `json:"paid_amount"`
+	Change     Money  `json:"change"`
+}
+
+// Transaction statuses. A sale paid through a payment gateway stays pending,
+// with its stock reserved, until the gateway confirms the payment. A payment
+// that arrives but cannot complete the sale (wrong amount, or stock gone
+// after the sale expired) leaves it refund_required: the money was received
+// and must be given back.
+const (
+	TransactionPaid           = "paid"
+	TransactionPendingPayment = "pending_payment"
+	TransactionCancelled      = "cancelled"
+	TransactionRefundRequired = "refund_required"
+)
+
+// Why a received payment could not complete its sale
+const (
+	RefundAmountMismatch = "amount_mismatch"
+	RefundOutOfStock     = "out_of_stock"
+)
+
+// RefundRequired is the payload of a transaction.refund_required event.
+type RefundRequired struct {
+	Transaction *Transaction `json:"transaction"`
+	PaidAmount  Money        `json:"paid_amount"`
+	Reason      string       `json:"reason"`
+}
+
+// GatewayPayment is the QRIS code a payment gateway issued for a sale.
+type GatewayPayment struct {
+	Gateway    string `json:"gateway"`
+	OrderID    string `json:"order_id"`
+	Reference  string `json:"reference,omitempty"`
+	QRString   string `json:"qr_string,omitempty"`
+	QRImageURL string `json:"qr_image_url,omitempty"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
 }
 
 type Transaction struct {
-	ID          int                 `json:"id"`
-	TotalAmount int                 `json:"total_amount"`
-	CreatedAt   string              `json:"created_at,omitempty"`
-	Details     []TransactionDetail `json:"details"`
+	ID            int    `json:"id"`
+	InvoiceNumber string `json:"invoice_number,omitempty"`
+	StoreID       int    `json:"store_id"`
+	Status        string `json:"status"`
+	TotalAmount   Money  `json:"total_amount"`
+	Payment
+	Gateway   *GatewayPayment     `json:"gateway_payment,omitempty"`
+	CreatedAt string              `json:"created_at,omitempty"`
+	Details   []TransactionDetail `json:"details"`
+	// Replayed is set when an Idempotency-Key retry returned an earlier transaction
+	Replayed bool `json:"-"`
 }
 
 type TransactionDetail struct {
-	ID            int    `json:"id"`
-	TransactionID int    `json:"transaction_id"`
-	ProductID     int    `json:"product_id"`
-	ProductName   string `json:"product_name,omitempty"`
-	Quantity      int    `json:"quantity"`
-	Subtotal      int    `json:"subtotal"`
+	ID            int      `json:"id"`
+	TransactionID int      `json:"transaction_id"`
+	ProductID     int      `json:"product_id"`
+	ProductName   string   `json:"product_name,omitempty"`
+	Unit          string   `json:"unit"`
+	Quantity      Quantity `json:"quantity"`
+	BaseQuantity  Quantity `json:"base_quantity"`
+	Subtotal      Money    `json:"subtotal"`
+}
+
+// TransactionExportFilter selects the transactions to export: of one store
+// (all when 0), created From through To (YYYY-MM-DD, open when empty), with
+// Status when set.
+type TransactionExportFilter struct {
+	StoreID int
+	From    string
+	To      string
+	Status  string
 }
 
+// TransactionLine is a transaction line item flattened for export, with the
+// transaction it belongs to. A transaction without items is one line with
+// only the transaction fields.
+type TransactionLine struct {
+	TransactionID int
+	InvoiceNumber string
+	CreatedAt     string
+	StoreCode     string
+	Status        string
+	TotalAmount   Money
+	Payment
+	ProductID    int
+	SKU          string
+	ProductName  string
+	Unit         string
+	Quantity     Quantity
+	BaseQuantity Quantity
+	Subtotal     Money
+}
+
+// CheckoutItem is one line of a cart. Instead of product_id a scanned
+// barcode may be sent; scale barcodes carry their own weight or price.
+// LineTotal is the price printed on a scale label, charged for the line
+// instead of price × quantity; it only ever comes from the barcode.
 type CheckoutItem struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
+	ProductID int      `json:"product_id"`
+	Quantity  Quantity `json:"quantity"`
+	Unit      string   `json:"unit,omitempty"`
+	Barcode   string   `json:"barcode,omitempty"`
+	LineTotal *Money   `json:"-"`
 }
 
+// CheckoutRequest is the body of POST /api/checkout. StoreID comes from the
+// outlet selected for the request and IdempotencyKey from the Idempotency-Key
+// header; RequestHash fingerprints the payload stored with that key. When
+// CartID is set the items and store are taken from that server-side cart.
+// ReservationIDs are reservations (e.g. of a pending order) that this sale
+// turns into stock decrements. PaymentMethod defaults to cash and PaidAmount
+// to the exact total.
 type CheckoutRequest struct {
-	Items []CheckoutItem `json:"items"`
+	StoreID        int            `json:"-"`
+	CartID         int            `json:"-"`
+	IdempotencyKey string         `json:"-"`
+	RequestHash    string         `json:"-"`
+	Items          []CheckoutItem `json:"items"`
+	ReservationIDs []int64        `json:"reservation_ids,omitempty"`
+	PaymentMethod  string         `json:"payment_method,omitempty"`
+	PaidAmount     *Money         `json:"paid_amount,omitempty"`
+	// PaymentTTL, when set, leaves the sale pending payment with its stock
+	// reserved for that long instead of taking it out of stock
+	PaymentTTL time.Duration `json:"-"`
+	// SoldAt (RFC 3339) records a sale made earlier, e.g. offline; empty is now
+	SoldAt string `json:"-"`
+	// ExpectedTotal, when set, rejects the sale if current prices give
+	// another total
+	ExpectedTotal *Money `json:"-"`
 }
 
 type ReportTopProduct struct {
-	Nama       string `json:"nama"`
-	QtyTerjual int    `json:"qty_terjual"`
+	Nama       string   `json:"nama"`
+	QtyTerjual Quantity `json:"qty_terjual"`
 }
 
 type ReportSummary struct {
-	TotalRevenue   int              `json:"total_revenue"`
+	StoreID        *int             `json:"store_id,omitempty"`
+	StoreName      string           `json:"store_name,omitempty"`
+	TotalRevenue   Money            `json:"total_revenue"`
 	TotalTransaksi int              `json:"total_transaksi"`
 	ProdukTerlaris ReportTopProduct `json:"produk_terlaris"`
 }
+
+// BarcodeScan is the result of resolving a scanned barcode. For scale labels
+// (EAN-13 starting with 2) the weight or price embedded in the code is decoded.
+type BarcodeScan struct {
+	Barcode       string   `json:"barcode"`
+	ItemCode      string   `json:"item_code"`
+	Product       *Product `json:"product"`
+	Quantity      Quantity `json:"quantity"`
+	EmbeddedPrice *Money   `json:"embedded_price,omitempty"`
+	Subtotal      Money    `json:"subtotal"`
+}
+
+// Store is an outlet. The default store keeps its stock in products.stock;
+// other outlets keep theirs in store_stock.
+type Store struct {
+	ID        int    `json:"id"`
+	Code      string `json:"code"`
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	NPWP      string `json:"npwp"`
+	IsDefault bool   `json:"is_default"`
+}
+
+// StoreProduct is a product's stock and effective price at one outlet.
+type StoreProduct struct {
+	StoreID       int      `json:"store_id"`
+	ProductID     int      `json:"product_id"`
+	ProductName   string   `json:"product_name"`
+	Stock         Quantity `json:"stock"`
+	Available     Quantity `json:"available"`
+	Price         Money    `json:"price"`
+	PriceOverride *Money   `json:"price_override"`
+}
+
+// StorePrice sets (or with a nil Price clears) a per-store price override.
+type StorePrice struct {
+	ProductID int    `json:"product_id"`
+	Price     *Money `json:"price"`
+}
+
+// StoreStockReceipt is stock received directly into an outlet.
+type StoreStockReceipt struct {
+	ProductID int `json:"product_id"`
+	StockReceipt
+}
+
+// Transfer statuses
+const (
+	TransferDraft     = "draft"
+	TransferSent      = "sent"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// StockTransfer moves stock between outlets. Source stock is taken out when
+// the transfer is sent, destination stock is added when it is received.
+type StockTransfer struct {
+	ID                 int                 `json:"id"`
+	SourceStoreID      int                 `json:"source_store_id"`
+	DestinationStoreID int                 `json:"destination_store_id"`
+	Status             string              `json:"status"`
+	Note               string              `json:"note"`
+	CreatedAt          string              `json:"created_at,omitempty"`
+	SentAt             *string             `json:"sent_at,omitempty"`
+	ReceivedAt         *string             `json:"received_at,omitempty"`
+	Items              []StockTransferItem `json:"items"`
+}
+
+// StockTransferItem is one product on a transfer. Quantities are in the base
+// unit; Unit is only used when creating the draft. Discrepancy is what was
+// sent but not received.
+type StockTransferItem struct {
+	ID               int       `json:"id"`
+	ProductID        int       `json:"product_id"`
+	ProductName      string    `json:"product_name,omitempty"`
+	Quantity         Quantity  `json:"quantity"`
+	Unit             string    `json:"unit,omitempty"`
+	QuantityReceived *Quantity `json:"quantity_received,omitempty"`
+	Discrepancy      *Quantity `json:"discrepancy,omitempty"`
+	Note             string    `json:"note,omitempty"`
+}
+
+// TransferReceipt confirms what arrived. Items not listed are taken as fully
+// received.
+type TransferReceipt struct {
+	Items []TransferReceiptItem `json:"items"`
+}
+
+// TransferReceiptItem names the transfer item it confirms by ItemID, or by
+// ProductID when the product is on only one item of the transfer.
+type TransferReceiptItem struct {
+	ItemID           int      `json:"item_id,omitempty"`
+	ProductID        int      `json:"product_id"`
+	QuantityReceived Quantity `json:"quantity_received"`
+	Note             string   `json:"note"`
+}
+
+// InTransitStock is stock that has left a store but not yet arrived.
+type InTransitStock struct {
+	ProductID          int      `json:"product_id"`
+	ProductName        string   `json:"product_name"`
+	SourceStoreID      int      `json:"source_store_id"`
+	DestinationStoreID int      `json:"destination_store_id"`
+	Quantity           Quantity `json:"quantity"`
+	TransferIDs        []int64  `json:"transfer_ids"`
+}
+
+// Cart statuses
+const (
+	CartOpen       = "open"
+	CartHeld       = "held"
+	CartCheckedOut = "checked_out"
+	CartExpired    = "expired"
+)
+
+// Cart is a basket kept on the server so a cashier can park it and serve the
+// next customer. Open and held carts expire when untouched until ExpiresAt.
+type Cart struct {
+	ID            int        `json:"id"`
+	StoreID       int        `json:"store_id"`
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	TransactionID *int       `json:"transaction_id,omitempty"`
+	TotalAmount   Money      `json:"total_amount"`
+	CreatedAt     string     `json:"created_at,omitempty"`
+	UpdatedAt     string     `json:"updated_at,omitempty"`
+	ExpiresAt     string     `json:"expires_at,omitempty"`
+	Items         []CartItem `json:"items"`
+}
+
+// CartItem is one line of a cart. Price is the unit price when the line was
+// added or last recalculated; PreviousPrice is set by a recalculation that
+// changed it.
+type CartItem struct {
+	ID            int      `json:"id"`
+	ProductID     int      `json:"product_id"`
+	ProductName   string   `json:"product_name,omitempty"`
+	Unit          string   `json:"unit"`
+	Quantity      Quantity `json:"quantity"`
+	Price         Money    `json:"price"`
+	PreviousPrice *Money   `json:"previous_price,omitempty"`
+	Subtotal      Money    `json:"subtotal"`
+}
+
+// StockReservation holds stock for an open cart or a pending order until it
+// is checked out, released or expires. Quantity is in the base unit; Unit and
+// TTLMinutes are only used when creating it.
+type StockReservation struct {
+	ID          int      `json:"id"`
+	StoreID     int      `json:"store_id"`
+	ProductID   int      `json:"product_id"`
+	ProductName string   `json:"product_name,omitempty"`
+	Quantity    Quantity `json:"quantity"`
+	Unit        string   `json:"unit,omitempty"`
+	CartID      *int     `json:"cart_id,omitempty"`
+	// TransactionID is set on the reservations of a sale awaiting payment
+	TransactionID *int   `json:"transaction_id,omitempty"`
+	Reference     string `json:"reference"`
+	TTLMinutes    int    `json:"ttl_minutes,omitempty"`
+	CreatedAt     string `json:"created_at,omitempty"`
+	ExpiresAt     string `json:"expires_at"`
+}
+
+// Webhook event types
+const (
+	EventTransactionCreated        = "transaction.created"
+	EventTransactionPaid           = "transaction.paid"
+	EventTransactionRefundRequired = "transaction.refund_required"
+	EventProductCreated            = "product.created"
+	EventProductUpdated            = "product.updated"
+	EventProductDeleted            = "product.deleted"
+	EventCategoryCreated           = "category.created"
+	EventCategoryUpdated           = "category.updated"
+	EventCategoryDeleted           = "category.deleted"
+	EventStockChanged              = "stock.changed"
+	EventStockLow                  = "stock.low"
+)
+
+// EventTypes lists every webhook event type; "*" subscribes to all of them.
+var EventTypes = []string{
+	EventTransactionCreated, EventTransactionPaid, EventTransactionRefundRequired,
+	EventProductCreated, EventProductUpdated, EventProductDeleted,
+	EventCategoryCreated, EventCategoryUpdated, EventCategoryDeleted,
+	EventStockChanged, EventStockLow,
+}
+
+// WebhookSubscription sends the events it lists to URL, signed with Secret.
+// The secret is only returned when the subscription is created.
+type WebhookSubscription struct {
+	ID        int      `json:"id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	CreatedAt string   `json:"created_at,omitempty"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event sent (or to be sent) to one subscription.
+// Every delivery of the same event shares its EventID.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    string          `json:"delivered_at,omitempty"`
+	ReplayOf       *int            `json:"replay_of,omitempty"`
+	// URL and Secret of the subscription, for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// StockAlert is the payload of a stock.low event: a sale took a product's
+// stock at a store down to the threshold or below.
+type StockAlert struct {
+	StoreID     int      `json:"store_id"`
+	ProductID   int      `json:"product_id"`
+	ProductName string   `json:"product_name"`
+	Stock       Quantity `json:"stock"`
+	Available   Quantity `json:"available"`
+	Threshold   Quantity `json:"threshold"`
+}
+
+// StockChange is the payload of a stock.changed event: the stock a sale or
+// received stock left at a store.
+type StockChange struct {
+	StoreID  int          `json:"store_id"`
+	Products []StockLevel `json:"products"`
+}
+
+type StockLevel struct {
+	ProductID   int      `json:"product_id"`
+	ProductName string   `json:"product_name"`
+	Stock       Quantity `json:"stock"`
+	Available   Quantity `json:"available"`
+}
+
+// CatalogSync is what a terminal downloads to sell offline: the whole catalog
+// when Full, otherwise what changed since the token it sent. Prices and
+// stock are the selected store's; stock is as of the download and does not
+// change the token. The terminal sends Token back as since next time.
+type CatalogSync struct {
+	Token      string           `json:"token"`
+	Full       bool             `json:"full"`
+	Categories []Category       `json:"categories"`
+	Products   []Product        `json:"products"`
+	Deleted    CatalogDeletions `json:"deleted"`
+}
+
+// CatalogDeletions lists the ids deleted since the token.
+type CatalogDeletions struct {
+	Categories []int `json:"categories"`
+	Products   []int `json:"products"`
+}
+
+// SyncSale is a sale a terminal recorded offline. ClientID is a UUID the
+// terminal generated for it, so uploading the same sale again records it only
+// once. TotalAmount, when sent, is the total the terminal charged; the sale is
+// not recorded if current prices give another total.
+type SyncSale struct {
+	ClientID      string         `json:"client_id"`
+	SoldAt        string         `json:"sold_at,omitempty"`
+	Items         []CheckoutItem `json:"items"`
+	PaymentMethod string         `json:"payment_method,omitempty"`
+	PaidAmount    *Money         `json:"paid_amount,omitempty"`
+	TotalAmount   *Money         `json:"total_amount,omitempty"`
+}
+
+type SyncSalesUpload struct {
+	Sales []SyncSale `json:"sales"`
+}
+
+// Outcomes of an uploaded sale. A conflict or rejection is final until the
+// terminal changes the sale; an error (e.g. the database was unreachable)
+// should be retried unchanged.
+const (
+	SyncSaleCreated   = "created"
+	SyncSaleDuplicate = "duplicate"
+	SyncSaleConflict  = "conflict"
+	SyncSaleRejected  = "rejected"
+	SyncSaleError     = "error"
+)
+
+// Sync conflict reasons
+const (
+	ConflictInsufficientStock = "insufficient_stock"
+	ConflictPriceMismatch     = "price_mismatch"
+	ConflictClientIDReused    = "client_id_reused"
+)
+
+type SyncConflict struct {
+	Reason        string    `json:"reason"`
+	ProductID     int       `json:"product_id,omitempty"`
+	Requested     *Quantity `json:"requested,omitempty"`
+	Available     *Quantity `json:"available,omitempty"`
+	ExpectedTotal *Money    `json:"expected_total,omitempty"`
+	ActualTotal   *Money    `json:"actual_total,omitempty"`
+}
+
+type SyncSaleResult struct {
+	ClientID    string        `json:"client_id"`
+	Status      string        `json:"status"`
+	Transaction *Transaction  `json:"transaction,omitempty"`
+	Conflict    *SyncConflict `json:"conflict,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// SyncSalesResult reports every uploaded sale, in upload order.
+type SyncSalesResult struct {
+	Created    int              `json:"created"`
+	Duplicates int              `json:"duplicates"`
+	Conflicts  int              `json:"conflicts"`
+	Rejected   int              `json:"rejected"`
+	Errors     int              `json:"errors"`
+	Results    []SyncSaleResult `json:"results"`
+}
+
+// ProductImportRow is one parsed row of a product import; Row is its row
+// number in the file. Nil fields were not in the file or left empty there
+// and keep the product's current value.
+type ProductImportRow struct {
+	Row          int
+	SKU          *string
+	Name         *string
+	Price        *Money
+	Stock        *Quantity
+	BaseUnit     *string
+	SoldByWeight *bool
+	Barcode      *string
+	Category     *string
+}
+
+// What import rows are matched to existing products on
+const (
+	ImportMatchSKU  = "sku"
+	ImportMatchName = "name"
+)
+
+// Import row actions
+const (
+	ImportCreate = "create"
+	ImportUpdate = "update"
+)
+
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportedProduct struct {
+	Row       int    `json:"row"`
+	Action    string `json:"action"`
+	ProductID int    `json:"product_id,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ImportResult reports a product import. An import is applied whole or not
+// at all: Applied is false on a dry run and whenever a row has errors, and
+// then the counts tell what the import would have done.
+type ImportResult struct {
+	DryRun            bool              `json:"dry_run"`
+	Applied           bool              `json:"applied"`
+	Match             string            `json:"match"`
+	Rows              int               `json:"rows"`
+	Created           int               `json:"created"`
+	Updated           int               `json:"updated"`
+	CategoriesCreated []string          `json:"categories_created"`
+	Products          []ImportedProduct `json:"products"`
+	Errors            []ImportError     `json:"errors"`
+}
+
+// BackupFormat names backup archives; BackupVersion is the version of the
+// archive layout this build writes and restores.
+const (
+	BackupFormat  = "kasir-api-backup"
+	BackupVersion = 1
+)
+
+// A backup archive is JSON lines: a BackupHeader, then one BackupRecord per
+// row, table by table in the order of the header, then a BackupTrailer.
+type BackupHeader struct {
+	Format    string        `json:"format"`
+	Version   int           `json:"version"`
+	CreatedAt string        `json:"created_at"`
+	Tables    []BackupTable `json:"tables"`
+}
+
+// BackupTable lists the columns a table had when it was backed up.
+type BackupTable struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+type BackupRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// BackupTrailer ends an archive with the rows written per table, so a
+// truncated archive is never restored.
+type BackupTrailer struct {
+	End  bool           `json:"end"`
+	Rows map[string]int `json:"rows"`
+}
+
+type RestoreResult struct {
+	Version   int            `json:"version"`
+	CreatedAt string         `json:"created_at"`
+	Rows      map[string]int `json:"rows"`
+	DryRun    bool           `json:"dry_run"`
+}
+
+// ListQuery pages and sorts a listing. Sort is a field name, prefixed with
+// "-" for descending order. A page either skips Offset rows or starts after
+// the row a cursor from a previous page points to; Limit 0 lists everything.
+type ListQuery struct {
+	Limit  int
+	Offset int
+	Sort   string
+	After  string
+}
+
+// PageInfo is sent with a page of a listing: Total counts every row matching
+// the filters, NextCursor is empty on the last page.
+type PageInfo struct {
+	Total      int
+	NextCursor string
+}
+
+// ProductQuery filters the product listing. CategoryID includes all its
+// subcategories. Prices and stock are those at StoreID (0 for the default
+// store); InStock compares available stock.
+type ProductQuery struct {
+	ListQuery
+	Name       string
+	CategoryID int
+	MinPrice   *Money
+	MaxPrice   *Money
+	InStock    *bool
+	StoreID    int
+}
+
+type CategoryQuery struct {
+	ListQuery
+	Name string
+}
+
+// ProductSearchResult is a product found by a search. Score ranks the
+// results; Highlight has the fields the search terms were found in, with
+// the matches in <mark> tags and the rest HTML-escaped.
+type ProductSearchResult struct {
+	Product
+	Score     float64           `json:"score"`
+	Highlight map[string]string `json:"highlight,omitempty"`
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrMoneyOverflow is returned when an amount no longer fits in a Money value.
+var ErrMoneyOverflow = errors.New("nilai uang melebihi batas maksimum (overflow)")
+
+// Money is an amount in whole rupiah. It is stored as BIGINT and all
+// arithmetic on it is checked so totals never silently wrap around.
+type Money int64
+
+// Add returns m + other, or ErrMoneyOverflow.
+func (m Money) Add(other Money) (Money, error) {
+	sum := m + other
+	if (other > 0 && sum < m) || (other < 0 && sum > m) {
+		return 0, ErrMoneyOverflow
+	}
+	return sum, nil
+}
+
+// Sub returns m - other, or ErrMoneyOverflow.
+func (m Money) Sub(other Money) (Money, error) {
+	if other == math.MinInt64 {
+		return 0, ErrMoneyOverflow
+	}
+	return m.Add(-other)
+}
+
+// MulQuantity returns m × qty rounded half away from zero to whole rupiah
+// (Rp 12000/kg × 0.75 kg = Rp 9000), or ErrMoneyOverflow.
+func (m Money) MulQuantity(qty Quantity) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(qty)))
+	half := big.NewInt(QuantityScale / 2)
+	if product.Sign() < 0 {
+		half.Neg(half)
+	}
+	product.Add(product, half)
+	product.Quo(product, big.NewInt(QuantityScale))
+	if !product.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+	return Money(product.Int64()), nil
+}
+
+// Scan implements sql.Scanner for BIGINT and NUMERIC (e.g. SUM) columns.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case int64:
+		*m = Money(v)
+		return nil
+	case []byte:
+		return m.parse(string(v))
+	case string:
+		return m.parse(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+// ParseMoney parses a whole rupiah amount such as "15000" or "15000.00".
+func ParseMoney(s string) (Money, error) {
+	var m Money
+	err := m.parse(s)
+	return m, err
+}
+
+func (m *Money) parse(s string) error {
+	// NUMERIC aggregates may come back as "123.00"
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if strings.Trim(frac, "0") != "" {
+		return fmt.Errorf("invalid money amount %q: fractional rupiah", s)
+	}
+	v, err := strconv.ParseInt(whole, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return ErrMoneyOverflow
+	}
+	if err != nil {
+		return fmt.Errorf("invalid money amount %q", s)
+	}
+	*m = Money(v)
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyMulQuantity(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Money
+		qty     Quantity
+		want    Money
+		wantErr error
+	}{
+		{"whole units", 3500, NewQuantity(3), 10500, nil},
+		{"weighed", 12000, 750, 9000, nil},
+		{"rounds half up", 1001, 500, 501, nil},
+		{"rounds half away from zero", -1001, 500, -501, nil},
+		{"zero quantity", 15000, 0, 0, nil},
+		{"largest exact", math.MaxInt64, NewQuantity(1), math.MaxInt64, nil},
+		{"overflow", math.MaxInt64, NewQuantity(2), 0, ErrMoneyOverflow},
+		{"negative overflow", math.MinInt64, NewQuantity(2), 0, ErrMoneyOverflow},
+		{"overflow only after rounding", math.MaxInt64, 1001, 0, ErrMoneyOverflow},
+		{"large price, large quantity", 10_000_000_000, NewQuantity(1_000_000_000), 0, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.MulQuantity(tt.qty)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%d.MulQuantity(%d) error = %v, want %v", tt.m, tt.qty, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("%d.MulQuantity(%d) = %d, want %d", tt.m, tt.qty, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyAddSub(t *testing.T) {
+	tests := []struct {
+		name    string
+		got     func() (Money, error)
+		want    Money
+		wantErr error
+	}{
+		{"add", func() (Money, error) { return Money(15000).Add(2500) }, 17500, nil},
+		{"add overflow", func() (Money, error) { return Money(math.MaxInt64).Add(1) }, 0, ErrMoneyOverflow},
+		{"add negative overflow", func() (Money, error) { return Money(math.MinInt64).Add(-1) }, 0, ErrMoneyOverflow},
+		{"sub", func() (Money, error) { return Money(50000).Sub(37500) }, 12500, nil},
+		{"sub min", func() (Money, error) { return Money(0).Sub(math.MinInt64) }, 0, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.got()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"15000", 15000, false},
+		{"15000.00", 15000, false},
+		{" 12500.0 ", 12500, false},
+		{"-500", -500, false},
+		{"15000.50", 0, true},
+		{"15.000", 15, false},
+		{"Rp15000", 0, true},
+		{"", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrQuantityOverflow is returned when a quantity no longer fits in a
+// Quantity value.
+var ErrQuantityOverflow = errors.New("jumlah melebihi batas maksimum (overflow)")
+
+// QuantityScale is the number of fixed-point units in one whole quantity.
+// Quantities keep three decimals, enough for grams when the base unit is kg.
+const QuantityScale = 1000
+
+// Quantity is a fixed-point quantity with three decimals (1.5 kg = 1500).
+// It is stored as NUMERIC(14,3) and encoded in JSON as a plain number.
+type Quantity int64
+
+// NewQuantity returns the quantity of n whole units.
+func NewQuantity(n int64) Quantity {
+	return Quantity(n * QuantityScale)
+}
+
+// ParseQuantity parses a decimal string such as "2", "0.75" or "1.250".
+func ParseQuantity(s string) (Quantity, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("quantity kosong")
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	// Only digits around the point: ParseInt would take a second sign
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole+frac == "" || !onlyDigits(whole) || !onlyDigits(frac) {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 3 {
+		return 0, fmt.Errorf("quantity %s has more than 3 decimals", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || w > math.MaxInt64/QuantityScale-1 {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	var f int64
+	if frac != "" {
+		f, err = strconv.ParseInt(frac+strings.Repeat("0", 3-len(frac)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid quantity %q", s)
+		}
+	}
+
+	q := Quantity(w*QuantityScale + f)
+	if negative {
+		q = -q
+	}
+	return q, nil
+}
+
+func onlyDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsWhole reports whether the quantity has no fractional part.
+func (q Quantity) IsWhole() bool {
+	return q%QuantityScale == 0
+}
+
+// Mul multiplies two quantities (e.g. 2 karton × 24 pcs), rounding half away
+// from zero to three decimals, or returns ErrQuantityOverflow.
+func (q Quantity) Mul(other Quantity) (Quantity, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(q)), big.NewInt(int64(other)))
+	half := big.NewInt(QuantityScale / 2)
+	if product.Sign() < 0 {
+		half.Neg(half)
+	}
+	product.Add(product, half)
+	product.Quo(product, big.NewInt(QuantityScale))
+	if !product.IsInt64() {
+		return 0, ErrQuantityOverflow
+	}
+	return Quantity(product.Int64()), nil
+}
+
+func (q Quantity) String() string {
+	sign := ""
+	v := int64(q)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	whole, frac := v/QuantityScale, v%QuantityScale
+	if frac == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+	return sign + strconv.FormatInt(whole, 10) + "." + strings.TrimRight(fmt.Sprintf("%03d", frac), "0")
+}
+
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		*q = 0
+		return nil
+	}
+	parsed, err := ParseQuantity(s)
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC and integer columns.
+func (q *Quantity) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*q = 0
+		return nil
+	case int64:
+		*q = NewQuantity(v)
+		return nil
+	case []byte:
+		parsed, err := ParseQuantity(string(v))
+		if err != nil {
+			return err
+		}
+		*q = parsed
+		return nil
+	case string:
+		parsed, err := ParseQuantity(v)
+		if err != nil {
+			return err
+		}
+		*q = parsed
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Quantity", src)
+	}
+}
+
+// Value implements driver.Valuer, sending the exact decimal text to Postgres.
+func (q Quantity) Value() (driver.Value, error) {
+	return q.String(), nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Quantity
+		wantErr bool
+	}{
+		{"2", 2000, false},
+		{"0.75", 750, false},
+		{"1.250", 1250, false},
+		{"1.5000", 1500, false},
+		{".5", 500, false},
+		{"3.", 3000, false},
+		{" 4 ", 4000, false},
+		{"+1", 1000, false},
+		{"-1.5", -1500, false},
+		{"0", 0, false},
+		{"", 0, true},
+		{"-", 0, true},
+		{".", 0, true},
+		{"--5", 0, true},
+		{"+-5", 0, true},
+		{"1.-5", 0, true},
+		{"1.+5", 0, true},
+		{"1.2345", 0, true},
+		{"1,5", 0, true},
+		{"1e3", 0, true},
+		{"abc", 0, true},
+		{"9223372036854775", 0, true},
+		{"9223372036854774", 9223372036854774000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseQuantity(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseQuantity(%q) = %d, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQuantity(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseQuantity(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	tests := []struct {
+		q    Quantity
+		want string
+	}{
+		{0, "0"},
+		{2000, "2"},
+		{750, "0.75"},
+		{1250, "1.25"},
+		{5, "0.005"},
+		{-1500, "-1.5"},
+	}
+	for _, tt := range tests {
+		if got := tt.q.String(); got != tt.want {
+			t.Errorf("Quantity(%d).String() = %q, want %q", int64(tt.q), got, tt.want)
+		}
+	}
+}
+
+func TestQuantityMul(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       Quantity
+		other   Quantity
+		want    Quantity
+		wantErr error
+	}{
+		{"karton of 24", NewQuantity(2), NewQuantity(24), NewQuantity(48), nil},
+		{"fraction of a unit", 750, NewQuantity(12), NewQuantity(9), nil},
+		{"rounds half up", 1, 500, 1, nil},
+		{"rounds half away from zero", -1, 500, -1, nil},
+		{"largest exact", math.MaxInt64, NewQuantity(1), math.MaxInt64, nil},
+		{"overflow", math.MaxInt64, NewQuantity(2), 0, ErrQuantityOverflow},
+		{"negative overflow", math.MinInt64, NewQuantity(2), 0, ErrQuantityOverflow},
+		{"large quantity, large factor", NewQuantity(1_000_000_000), NewQuantity(10_000_000_000), 0, ErrQuantityOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.q.Mul(tt.other)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%d.Mul(%d) error = %v, want %v", tt.q, tt.other, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("%d.Mul(%d) = %d, want %d", tt.q, tt.other, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backoff is the wait before each retry of an event some sink did not take;
+// the last wait repeats forever, as events are never given up.
+var backoff = []time.Duration{
+	5 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute, 30 * time.Minute, time.Hour,
+}
+
+const (
+	batchSize = 50
+	// lease must outlast sending a whole batch to every sink
+	lease       = 5 * time.Minute
+	sinkTimeout = 15 * time.Second
+	pollEvery   = time.Second
+	purgeEvery  = time.Hour
+	// retention of delivered events, which double as an audit log
+	retention = 7 * 24 * time.Hour
+)
+
+// Dispatcher moves events from the store to the sinks.
+type Dispatcher struct {
+	store Store
+	sinks []Sink
+}
+
+func NewDispatcher(store Store, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{store: store, sinks: sinks}
+}
+
+// Run dispatches events until ctx is cancelled, polling for new ones every
+// second and purging old delivered events every hour.
+func (d *Dispatcher) Run(ctx context.Context) {
+	poll := time.NewTicker(pollEvery)
+	defer poll.Stop()
+	purge := time.NewTicker(purgeEvery)
+	defer purge.Stop()
+
+	for {
+		for {
+			n, err := d.DispatchOnce(ctx)
+			if err != nil {
+				log.Printf("outbox: %v\n", err)
+				break
+			}
+			if n < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-purge.C:
+			if err := d.store.Purge(retention); err != nil {
+				log.Printf("outbox: purging delivered events: %v\n", err)
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due events and returns how many it claimed.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	events, err := d.store.ClaimDue(batchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		if err := d.dispatch(ctx, e); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// dispatch hands an event to the sinks that have not taken it yet.
+func (d *Dispatcher) dispatch(ctx context.Context, e Event) error {
+	sent := make([]string, 0, len(d.sinks))
+	errs := make([]string, 0)
+	for _, sink := range d.sinks {
+		if slices.Contains(e.Delivered, sink.Name()) {
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, sinkTimeout)
+		err := sink.Send(sendCtx, e)
+		cancel()
+		if err != nil {
+			errs = append(errs, sink.Name()+": "+err.Error())
+			continue
+		}
+		sent = append(sent, sink.Name())
+	}
+
+	lastErr := strings.Join(errs, "; ")
+	if len(lastErr) > 500 {
+		lastErr = lastErr[:500]
+	}
+	retryIn := backoff[min(e.Attempts, len(backoff)-1)]
+	return d.store.MarkSent(e.ID, sent, len(errs) == 0, lastErr, retryIn)
+}
@@ -0,0 +1,221 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The tests run the dispatcher against an in-memory store, which follows the
+// same claim/lease rules as the outbox table on a simulated clock, and sinks
+// that fail on purpose.
+
+func TestDispatcherDeliversEveryEventToEverySink(t *testing.T) {
+	store := newMemStore(t, "product.created", "product.updated", "transaction.created")
+	a, b := newRecorder("a", 0), newRecorder("b", 0)
+	d := NewDispatcher(store, a, b)
+
+	if _, err := d.DispatchOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a.expect(t, store.ids(), 1)
+	b.expect(t, store.ids(), 1)
+	store.expectDone(t)
+}
+
+func TestDispatcherRetriesFailingSinkWithBackoff(t *testing.T) {
+	store := newMemStore(t, "transaction.paid")
+	ok, flaky := newRecorder("ok", 0), newRecorder("flaky", 2)
+	d := NewDispatcher(store, ok, flaky)
+	ctx := context.Background()
+
+	if _, err := d.DispatchOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Not due again before the first backoff has passed
+	if n, err := d.DispatchOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("claimed %d events before the backoff passed (err %v)", n, err)
+	}
+	for _, wait := range []time.Duration{5 * time.Second, 30 * time.Second} {
+		store.advance(wait)
+		if _, err := d.DispatchOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The sink that took the event first is not sent it again
+	ok.expect(t, store.ids(), 1)
+	flaky.expect(t, store.ids(), 1)
+	store.expectDone(t)
+}
+
+func TestDispatcherResendsAfterLostMarkSent(t *testing.T) {
+	store := newMemStore(t, "stock.low")
+	store.failMarkSent = 1
+	sink := newRecorder("sink", 0)
+	d := NewDispatcher(store, sink)
+	ctx := context.Background()
+
+	if _, err := d.DispatchOnce(ctx); err == nil {
+		t.Fatal("lost MarkSent was not reported")
+	}
+	if n, err := d.DispatchOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("claimed %d leased events (err %v)", n, err)
+	}
+	store.advance(lease)
+	if _, err := d.DispatchOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// At least once: the sink saw it twice and must deduplicate on the ID
+	sink.expect(t, store.ids(), 2)
+	store.expectDone(t)
+}
+
+func TestDispatcherTakesOverFromDeadDispatcher(t *testing.T) {
+	store := newMemStore(t, "category.created", "category.deleted")
+	if _, err := store.ClaimDue(10, lease); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := newRecorder("sink", 0)
+	d := NewDispatcher(store, sink)
+	ctx := context.Background()
+	if n, err := d.DispatchOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("claimed %d leased events (err %v)", n, err)
+	}
+	store.advance(lease)
+	if _, err := d.DispatchOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sink.expect(t, store.ids(), 1)
+	store.expectDone(t)
+}
+
+// memEvent is an outbox row.
+type memEvent struct {
+	Event
+	nextAttempt time.Time
+	done        bool
+}
+
+// memStore is a Store on a simulated clock.
+type memStore struct {
+	now          time.Time
+	events       []*memEvent
+	failMarkSent int
+}
+
+func newMemStore(t *testing.T, types ...string) *memStore {
+	t.Helper()
+	s := &memStore{now: time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)}
+	for i, typ := range types {
+		e, err := NewEvent(typ, map[string]int{"id": i + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.ID = int64(i + 1)
+		s.events = append(s.events, &memEvent{Event: e, nextAttempt: s.now})
+	}
+	return s
+}
+
+func (s *memStore) advance(d time.Duration) {
+	s.now = s.now.Add(d)
+}
+
+func (s *memStore) ids() []string {
+	ids := make([]string, len(s.events))
+	for i, e := range s.events {
+		ids[i] = e.EventID
+	}
+	return ids
+}
+
+func (s *memStore) ClaimDue(limit int, lease time.Duration) ([]Event, error) {
+	events := make([]Event, 0)
+	for _, e := range s.events {
+		if len(events) == limit {
+			break
+		}
+		if e.done || e.nextAttempt.After(s.now) {
+			continue
+		}
+		e.nextAttempt = s.now.Add(lease)
+		claimed := e.Event
+		claimed.Delivered = slices.Clone(e.Delivered)
+		events = append(events, claimed)
+	}
+	return events, nil
+}
+
+func (s *memStore) MarkSent(id int64, sinks []string, done bool, lastErr string, retryIn time.Duration) error {
+	if s.failMarkSent > 0 {
+		s.failMarkSent--
+		return errors.New("database went away")
+	}
+	for _, e := range s.events {
+		if e.ID == id {
+			e.Delivered = append(e.Delivered, sinks...)
+			e.Attempts++
+			e.nextAttempt = s.now.Add(retryIn)
+			e.done = done
+		}
+	}
+	return nil
+}
+
+func (s *memStore) Purge(age time.Duration) error {
+	return nil
+}
+
+func (s *memStore) expectDone(t *testing.T) {
+	t.Helper()
+	for _, e := range s.events {
+		if !e.done {
+			t.Errorf("event %d not marked delivered", e.ID)
+		}
+	}
+}
+
+// recorder is a sink that records what it took; its first failures sends
+// fail.
+type recorder struct {
+	name     string
+	failures int
+	received []string
+}
+
+func newRecorder(name string, failures int) *recorder {
+	return &recorder{name: name, failures: failures}
+}
+
+func (r *recorder) Name() string {
+	return r.name
+}
+
+func (r *recorder) Send(ctx context.Context, e Event) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("connection refused")
+	}
+	r.received = append(r.received, e.EventID)
+	return nil
+}
+
+// expect checks the sink took each event times times, in event order.
+func (r *recorder) expect(t *testing.T, ids []string, times int) {
+	t.Helper()
+	want := make([]string, 0, len(ids)*times)
+	for _, id := range ids {
+		for range times {
+			want = append(want, id)
+		}
+	}
+	if !slices.Equal(r.received, want) {
+		t.Errorf("sink %s received %v, want %v", r.name, r.received, want)
+	}
+}
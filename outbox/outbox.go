@@ -0,0 +1,67 @@
+// Package outbox delivers domain events that were stored in the outbox table
+// in the same database transaction as the change they describe. A
+// background Dispatcher hands every event to each configured Sink and keeps
+// retrying until all of them took it, so events are delivered at least once
+// even when the process dies between commit and delivery. Sinks may
+// therefore see an event more than once and should deduplicate on its ID.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Event is one stored event. Payload is the JSON envelope
+// {"id","type","created_at","data"} that sinks send as-is.
+type Event struct {
+	ID        int64
+	EventID   string
+	Type      string
+	Payload   []byte
+	Attempts  int
+	Delivered []string
+}
+
+// NewEvent builds an event of the given type around data, with a new random
+// event ID.
+func NewEvent(eventType string, data interface{}) (Event, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Event{}, err
+	}
+	eventID := hex.EncodeToString(id)
+
+	payload, err := json.Marshal(struct {
+		ID        string      `json:"id"`
+		Type      string      `json:"type"`
+		CreatedAt string      `json:"created_at"`
+		Data      interface{} `json:"data"`
+	}{eventID, eventType, time.Now().Format(time.RFC3339), data})
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{EventID: eventID, Type: eventType, Payload: payload}, nil
+}
+
+// Sink is a destination of events. Send must only return nil once the sink
+// has durably accepted the event.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, e Event) error
+}
+
+// Store is where the dispatcher reads events from and records progress.
+type Store interface {
+	// ClaimDue returns up to limit undelivered events that are due and hides
+	// them from other dispatchers for lease.
+	ClaimDue(limit int, lease time.Duration) ([]Event, error)
+	// MarkSent records the sinks that took an event in this attempt. A done
+	// event is finished; otherwise it is tried again after retryIn.
+	MarkSent(id int64, sinks []string, done bool, lastErr string, retryIn time.Duration) error
+	// Purge deletes events delivered more than age ago.
+	Purge(age time.Duration) error
+}
@@ -0,0 +1,62 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"kasir-api/models"
+)
+
+// FakeCallbackHeader carries the fake gateway's callback token.
+const FakeCallbackHeader = "X-Callback-Token"
+
+// Fake is a local gateway for development and demos. Its QR codes cannot be
+// paid; instead a payment is confirmed by posting
+//
+//	{"order_id": "...", "status": "paid", "amount": 12500}
+//
+// to the webhook with the callback token in the X-Callback-Token header.
+type Fake struct {
+	callbackToken string
+}
+
+func NewFake(callbackToken string) *Fake {
+	return &Fake{callbackToken: callbackToken}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) CreateQRIS(ctx context.Context, charge Charge) (*QRIS, error) {
+	return &QRIS{
+		Reference: "FAKE-" + charge.OrderID,
+		QRString:  fmt.Sprintf("FAKEQRIS|%s|%d", charge.OrderID, charge.Amount),
+	}, nil
+}
+
+// ParseNotification accepts notifications carrying the callback token; with
+// no token configured every notification is rejected.
+func (f *Fake) ParseNotification(body []byte, header http.Header) (*Notification, error) {
+	if f.callbackToken == "" || !equal(header.Get(FakeCallbackHeader), f.callbackToken) {
+		return nil, ErrInvalidSignature
+	}
+
+	var n struct {
+		OrderID string       `json:"order_id"`
+		Status  string       `json:"status"`
+		Amount  models.Money `json:"amount"`
+	}
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("fake: %w: %v", ErrInvalidNotification, err)
+	}
+	switch n.Status {
+	case StatusPaid, StatusFailed, StatusPending:
+	default:
+		return nil, fmt.Errorf("fake: %w: unknown status %q (use paid, failed or pending)", ErrInvalidNotification, n.Status)
+	}
+
+	return &Notification{OrderID: n.OrderID, Reference: "FAKE-" + n.OrderID, Status: n.Status, Amount: n.Amount}, nil
+}
@@ -0,0 +1,166 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"kasir-api/models"
+)
+
+// MidtransSandboxURL is the Core API of Midtrans' sandbox.
+const MidtransSandboxURL = "https://api.sandbox.midtrans.com"
+
+// Midtrans creates QRIS charges through the Midtrans Core API.
+type Midtrans struct {
+	serverKey string
+	baseURL   string
+	client    *http.Client
+}
+
+// NewMidtrans returns a gateway for the Core API at baseURL (the sandbox when
+// empty), authenticated with the merchant's server key.
+func NewMidtrans(serverKey, baseURL string) *Midtrans {
+	if baseURL == "" {
+		baseURL = MidtransSandboxURL
+	}
+	return &Midtrans{
+		serverKey: serverKey,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (m *Midtrans) Name() string {
+	return "midtrans"
+}
+
+type midtransCharge struct {
+	PaymentType        string `json:"payment_type"`
+	TransactionDetails struct {
+		OrderID     string `json:"order_id"`
+		GrossAmount int64  `json:"gross_amount"`
+	} `json:"transaction_details"`
+	QRIS struct {
+		Acquirer string `json:"acquirer"`
+	} `json:"qris"`
+	CustomExpiry struct {
+		ExpiryDuration int    `json:"expiry_duration"`
+		Unit           string `json:"unit"`
+	} `json:"custom_expiry"`
+}
+
+type midtransChargeResponse struct {
+	StatusCode    string `json:"status_code"`
+	StatusMessage string `json:"status_message"`
+	TransactionID string `json:"transaction_id"`
+	QRString      string `json:"qr_string"`
+	Actions       []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"actions"`
+}
+
+func (m *Midtrans) CreateQRIS(ctx context.Context, charge Charge) (*QRIS, error) {
+	var body midtransCharge
+	body.PaymentType = "qris"
+	body.TransactionDetails.OrderID = charge.OrderID
+	body.TransactionDetails.GrossAmount = int64(charge.Amount)
+	body.QRIS.Acquirer = "gopay"
+	body.CustomExpiry.ExpiryDuration = max(1, int(charge.Expiry/time.Minute))
+	body.CustomExpiry.Unit = "minute"
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/v2/charge", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(m.serverKey, "")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var parsed midtransChargeResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("midtrans: unreadable charge response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	// Midtrans answers HTTP 200 with the outcome in status_code
+	if !strings.HasPrefix(parsed.StatusCode, "2") {
+		return nil, fmt.Errorf("midtrans: %s %s", parsed.StatusCode, parsed.StatusMessage)
+	}
+
+	qris := &QRIS{Reference: parsed.TransactionID, QRString: parsed.QRString}
+	for _, action := range parsed.Actions {
+		if action.Name == "generate-qr-code" {
+			qris.ImageURL = action.URL
+		}
+	}
+	return qris, nil
+}
+
+type midtransNotification struct {
+	OrderID           string `json:"order_id"`
+	TransactionID     string `json:"transaction_id"`
+	StatusCode        string `json:"status_code"`
+	GrossAmount       string `json:"gross_amount"`
+	SignatureKey      string `json:"signature_key"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+}
+
+// ParseNotification verifies signature_key, the SHA-512 of order_id,
+// status_code, gross_amount and the server key.
+func (m *Midtrans) ParseNotification(body []byte, header http.Header) (*Notification, error) {
+	var n midtransNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("midtrans: %w: %v", ErrInvalidNotification, err)
+	}
+
+	sum := sha512.Sum512([]byte(n.OrderID + n.StatusCode + n.GrossAmount + m.serverKey))
+	if m.serverKey == "" || !equal(strings.ToLower(n.SignatureKey), hex.EncodeToString(sum[:])) {
+		return nil, ErrInvalidSignature
+	}
+
+	// gross_amount is whole rupiah written with decimals, e.g. "12500.00"
+	amount, err := models.ParseMoney(n.GrossAmount)
+	if err != nil {
+		return nil, fmt.Errorf("midtrans: %w: gross_amount %q: %v", ErrInvalidNotification, n.GrossAmount, err)
+	}
+
+	notification := &Notification{
+		OrderID:   n.OrderID,
+		Reference: n.TransactionID,
+		Amount:    amount,
+	}
+	switch n.TransactionStatus {
+	case "settlement":
+		notification.Status = StatusPaid
+	case "capture":
+		if n.FraudStatus == "" || n.FraudStatus == "accept" {
+			notification.Status = StatusPaid
+		} else {
+			notification.Status = StatusPending
+		}
+	case "deny", "cancel", "expire", "failure":
+		notification.Status = StatusFailed
+	default:
+		// pending, and refunds which are handled outside the POS
+		notification.Status = StatusPending
+	}
+	return notification, nil
+}
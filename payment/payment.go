@@ -0,0 +1,67 @@
+// Package payment talks to payment gateways that take QRIS payments on behalf
+// of the store: creating dynamic QR codes for a sale and verifying the
+// gateway's payment notifications.
+package payment
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"kasir-api/models"
+)
+
+// ErrInvalidSignature is returned for notifications that were not signed by
+// the gateway.
+var ErrInvalidSignature = errors.New("invalid payment notification signature")
+
+// ErrInvalidNotification is returned for notifications that cannot be read;
+// sending them again will not help.
+var ErrInvalidNotification = errors.New("invalid payment notification")
+
+// Statuses of a payment reported by a gateway.
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusFailed  = "failed"
+)
+
+// Gateway is a payment provider that issues dynamic QRIS codes.
+type Gateway interface {
+	// Name identifies the gateway in webhook URLs and stored transactions.
+	Name() string
+	// CreateQRIS asks the gateway for a QR code paying the charge.
+	CreateQRIS(ctx context.Context, charge Charge) (*QRIS, error)
+	// ParseNotification verifies and decodes a webhook callback.
+	ParseNotification(body []byte, header http.Header) (*Notification, error)
+}
+
+// Charge is the amount a customer has to pay for one sale. OrderID is unique
+// per sale and comes back in the gateway's notifications.
+type Charge struct {
+	OrderID string
+	Amount  models.Money
+	Expiry  time.Duration
+}
+
+// QRIS is a dynamic QR code issued for a charge.
+type QRIS struct {
+	Reference string
+	QRString  string
+	ImageURL  string
+}
+
+// Notification is a verified payment status update from a gateway.
+type Notification struct {
+	OrderID   string
+	Reference string
+	Status    string
+	Amount    models.Money
+}
+
+// equal compares secrets in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
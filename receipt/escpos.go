@@ -0,0 +1,148 @@
+package receipt
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// ESC/POS control codes
+const (
+	esc = 0x1b
+	gs  = 0x1d
+	lf  = 0x0a
+)
+
+// Text alignment for ESC a
+const (
+	alignLeft   = 0
+	alignCenter = 1
+)
+
+// ESCPOSOptions controls the printer actions around the receipt body.
+type ESCPOSOptions struct {
+	// Cut feeds the paper past the cutter and makes a partial cut.
+	Cut bool
+	// KickDrawer pulses the cash drawer connected to the printer (pin 2).
+	KickDrawer bool
+	// QR prints a QR code of the transaction ID below the footer.
+	QR bool
+}
+
+// ESCPOS renders the receipt as an ESC/POS byte stream for a printer with
+// cols characters per line. Text outside ASCII is printed as '?'.
+func ESCPOS(r *Receipt, cols int, opts ESCPOSOptions) []byte {
+	p := &escposWriter{}
+	p.raw(esc, '@') // initialize
+
+	p.align(alignCenter)
+	p.bold(true)
+	p.raw(gs, '!', 0x01) // double height
+	for _, l := range wrap(r.StoreName, cols) {
+		p.line(l)
+	}
+	p.raw(gs, '!', 0x00)
+	p.bold(false)
+	for _, l := range wrap(r.StoreAddress, cols) {
+		p.line(l)
+	}
+	if r.StoreNPWP != "" {
+		p.line("NPWP: " + r.StoreNPWP)
+	}
+
+	rule := string(bytes.Repeat([]byte{'-'}, cols))
+	p.align(alignLeft)
+	p.line(rule)
+	p.line(leftRight("No", r.Number, cols))
+	p.line(leftRight("Tanggal", r.Date, cols))
+	p.line(rule)
+
+	for _, item := range r.Lines {
+		for _, l := range wrap(item.Name, cols) {
+			p.line(l)
+		}
+		qty := "  " + Qty(item.Quantity) + " " + item.Unit + " x " + Rupiah(item.UnitPrice)
+		for _, l := range leftRightLines(qty, Rupiah(item.Subtotal), cols) {
+			p.line(l)
+		}
+	}
+
+	p.line(rule)
+	p.bold(true)
+	p.line(leftRight("TOTAL", "Rp "+Rupiah(r.Total), cols))
+	p.bold(false)
+	if r.TaxLabel != "" {
+		p.line(leftRight("DPP", Rupiah(r.TaxBase), cols))
+		p.line(leftRight(r.TaxLabel, Rupiah(r.Tax), cols))
+	}
+	p.line(rule)
+	p.line(leftRight(PaymentLabel(r.Payment.Method), Rupiah(r.Payment.PaidAmount), cols))
+	p.bold(true)
+	p.line(leftRight("KEMBALI", Rupiah(r.Payment.Change), cols))
+	p.bold(false)
+	p.line(rule)
+
+	p.align(alignCenter)
+	for _, paragraph := range splitLines(r.Footer) {
+		for _, l := range wrap(paragraph, cols) {
+			p.line(l)
+		}
+	}
+	if opts.QR {
+		p.raw(lf)
+		p.qr(strconv.Itoa(r.TransactionID))
+	}
+	p.align(alignLeft)
+
+	if opts.KickDrawer {
+		p.raw(esc, 'p', 0x00, 0x19, 0xfa) // pin 2, 50ms on, 500ms off
+	}
+	if opts.Cut {
+		p.raw(gs, 'V', 'B', 0x00) // feed to the cutter, partial cut
+	}
+
+	return p.buf.Bytes()
+}
+
+type escposWriter struct {
+	buf bytes.Buffer
+}
+
+func (p *escposWriter) raw(b ...byte) {
+	p.buf.Write(b)
+}
+
+func (p *escposWriter) align(n byte) {
+	p.raw(esc, 'a', n)
+}
+
+func (p *escposWriter) bold(on bool) {
+	if on {
+		p.raw(esc, 'E', 1)
+	} else {
+		p.raw(esc, 'E', 0)
+	}
+}
+
+// line prints s followed by a line feed, replacing non-ASCII characters.
+func (p *escposWriter) line(s string) {
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			r = '?'
+		}
+		p.buf.WriteByte(byte(r))
+	}
+	p.buf.WriteByte(lf)
+}
+
+// qr prints data as a model 2 QR code with the printer's native GS ( k
+// commands: module size 6, error correction level M.
+func (p *escposWriter) qr(data string) {
+	p.raw(gs, '(', 'k', 4, 0, '1', 'A', '2', 0) // model 2
+	p.raw(gs, '(', 'k', 3, 0, '1', 'C', 6)      // module size
+	p.raw(gs, '(', 'k', 3, 0, '1', 'E', '1')    // error correction M
+	n := len(data) + 3
+	p.raw(gs, '(', 'k', byte(n), byte(n>>8), '1', 'P', '0')
+	p.buf.WriteString(data)
+	p.raw(gs, '(', 'k', 3, 0, '1', 'Q', '0') // print
+	p.raw(lf)
+}
@@ -0,0 +1,21 @@
+package receipt
+
+import "testing"
+
+func TestESCPOSGolden(t *testing.T) {
+	tests := []struct {
+		suffix string
+		opts   ESCPOSOptions
+	}{
+		{".escpos", ESCPOSOptions{Cut: true, KickDrawer: true, QR: true}},
+		{"-nocut.escpos", ESCPOSOptions{}},
+	}
+	for _, paper := range papers {
+		for _, tt := range tests {
+			name := goldenName(paper, tt.suffix)
+			t.Run(name, func(t *testing.T) {
+				checkGolden(t, name, ESCPOS(sample(), columns(t, paper), tt.opts))
+			})
+		}
+	}
+}
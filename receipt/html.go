@@ -0,0 +1,76 @@
+package receipt
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"rupiah":  Rupiah,
+	"qty":     Qty,
+	"payment": PaymentLabel,
+	"lines":   func(s string) []string { return strings.Split(s, "\n") },
+}).Parse(`<!DOCTYPE html>
+<html lang="id">
+<head>
+<meta charset="utf-8">
+<title>Struk {{.Receipt.Number}}</title>
+<style>
+  body { font-family: "Courier New", monospace; font-size: 12px; margin: 0; }
+  .receipt { width: {{.PaperMM}}mm; padding: 3mm; box-sizing: border-box; }
+  .center { text-align: center; }
+  .store { font-weight: bold; font-size: 14px; }
+  table { width: 100%; border-collapse: collapse; }
+  td { vertical-align: top; padding: 1px 0; }
+  td.amount { text-align: right; white-space: nowrap; }
+  .detail { padding-left: 8px; }
+  .total td { font-weight: bold; }
+  hr { border: 0; border-top: 1px dashed #000; }
+  @media print { @page { size: {{.PaperMM}}mm auto; margin: 0; } }
+</style>
+</head>
+<body>
+<div class="receipt">
+  <div class="center store">{{.Receipt.StoreName}}</div>
+  {{if .Receipt.StoreAddress}}<div class="center">{{.Receipt.StoreAddress}}</div>{{end}}
+  {{if .Receipt.StoreNPWP}}<div class="center">NPWP: {{.Receipt.StoreNPWP}}</div>{{end}}
+  <hr>
+  <table>
+    <tr><td>No</td><td class="amount">{{.Receipt.Number}}</td></tr>
+    <tr><td>Tanggal</td><td class="amount">{{.Receipt.Date}}</td></tr>
+  </table>
+  <hr>
+  <table>
+  {{range .Receipt.Lines}}
+    <tr><td colspan="2">{{.Name}}</td></tr>
+    <tr><td class="detail">{{qty .Quantity}} {{.Unit}} x {{rupiah .UnitPrice}}</td><td class="amount">{{rupiah .Subtotal}}</td></tr>
+  {{end}}
+  </table>
+  <hr>
+  <table>
+    <tr class="total"><td>TOTAL</td><td class="amount">Rp {{rupiah .Receipt.Total}}</td></tr>
+    {{if .Receipt.TaxLabel}}
+    <tr><td>DPP</td><td class="amount">{{rupiah .Receipt.TaxBase}}</td></tr>
+    <tr><td>{{.Receipt.TaxLabel}}</td><td class="amount">{{rupiah .Receipt.Tax}}</td></tr>
+    {{end}}
+  </table>
+  <hr>
+  <table>
+    <tr><td>{{payment .Receipt.Payment.Method}}</td><td class="amount">{{rupiah .Receipt.Payment.PaidAmount}}</td></tr>
+    <tr><td>KEMBALI</td><td class="amount">{{rupiah .Receipt.Payment.Change}}</td></tr>
+  </table>
+  <hr>
+  {{range lines .Receipt.Footer}}<div class="center">{{.}}</div>{{end}}
+</div>
+</body>
+</html>
+`))
+
+// HTML writes the receipt as a printable HTML page sized for the paper width.
+func HTML(w io.Writer, r *Receipt, paperMM int) error {
+	return htmlTemplate.Execute(w, struct {
+		Receipt *Receipt
+		PaperMM int
+	}{r, paperMM})
+}
@@ -0,0 +1,19 @@
+package receipt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHTMLGolden(t *testing.T) {
+	for _, paper := range papers {
+		name := goldenName(paper, ".html")
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := HTML(&buf, sample(), paper); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name, buf.Bytes())
+		})
+	}
+}
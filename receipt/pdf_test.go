@@ -0,0 +1,16 @@
+package receipt
+
+import "testing"
+
+func TestPDFGolden(t *testing.T) {
+	for _, paper := range papers {
+		name := goldenName(paper, ".pdf")
+		t.Run(name, func(t *testing.T) {
+			pdf, err := PDF(sample(), paper)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name, pdf)
+		})
+	}
+}
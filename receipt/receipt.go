@@ -0,0 +1,189 @@
+// Package receipt renders sales receipts as plain text for thermal printers,
+// HTML and PDF.
+package receipt
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"kasir-api/models"
+)
+
+// Paper widths of thermal printers, in millimetres.
+const (
+	Paper58 = 58
+	Paper80 = 80
+)
+
+// Columns returns the number of characters per line printed on the paper
+// width (font A: 32 on 58mm, 48 on 80mm).
+func Columns(paperMM int) (int, error) {
+	switch paperMM {
+	case Paper58:
+		return 32, nil
+	case Paper80:
+		return 48, nil
+	default:
+		return 0, fmt.Errorf("unsupported paper width %dmm (use 58 or 80)", paperMM)
+	}
+}
+
+// Config customises the receipt. Store fields override the name, address and
+// NPWP of the store record when set. TaxRate is in basis points (1100 = 11%)
+// and is taken as already included in the prices.
+type Config struct {
+	StoreName    string
+	StoreAddress string
+	StoreNPWP    string
+	Footer       string
+	TaxLabel     string
+	TaxRate      int
+}
+
+// ParseRate parses a percentage such as "11" or "1.5" into basis points.
+func ParseRate(s string) (int, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if s == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || rate < 0 || rate >= 100 {
+		return 0, fmt.Errorf("invalid tax rate %q", s)
+	}
+	return int(rate*100 + 0.5), nil
+}
+
+// Receipt is everything printed on a receipt.
+type Receipt struct {
+	TransactionID int
+	StoreName     string
+	StoreAddress  string
+	StoreNPWP     string
+	Number        string
+	Date          string
+	Lines         []Line
+	Total         models.Money
+	TaxLabel      string
+	TaxBase       models.Money
+	Tax           models.Money
+	Payment       models.Payment
+	Footer        string
+}
+
+// Line is one sold item. UnitPrice is derived from the subtotal.
+type Line struct {
+	Name      string
+	Quantity  models.Quantity
+	Unit      string
+	UnitPrice models.Money
+	Subtotal  models.Money
+}
+
+// New builds the receipt of a transaction made at store.
+func New(cfg Config, store *models.Store, t *models.Transaction) *Receipt {
+	r := &Receipt{
+		TransactionID: t.ID,
+		StoreName:     firstNonEmpty(cfg.StoreName, store.Name),
+		StoreAddress:  firstNonEmpty(cfg.StoreAddress, store.Address),
+		StoreNPWP:     firstNonEmpty(cfg.StoreNPWP, store.NPWP),
+		Number:        firstNonEmpty(t.InvoiceNumber, fmt.Sprintf("#%d", t.ID)),
+		Date:          formatDate(t.CreatedAt),
+		Total:         t.TotalAmount,
+		Payment:       t.Payment,
+		Footer:        cfg.Footer,
+	}
+
+	for _, d := range t.Details {
+		line := Line{Name: d.ProductName, Quantity: d.Quantity, Unit: d.Unit, Subtotal: d.Subtotal}
+		if d.Quantity > 0 {
+			price := new(big.Int).Mul(big.NewInt(int64(d.Subtotal)), big.NewInt(models.QuantityScale))
+			price.Add(price, big.NewInt(int64(d.Quantity)/2))
+			line.UnitPrice = models.Money(price.Quo(price, big.NewInt(int64(d.Quantity))).Int64())
+		}
+		r.Lines = append(r.Lines, line)
+	}
+
+	if cfg.TaxRate > 0 {
+		r.TaxLabel = fmt.Sprintf("%s %s%%", firstNonEmpty(cfg.TaxLabel, "PPN"), formatRate(cfg.TaxRate))
+		r.Tax = includedTax(t.TotalAmount, cfg.TaxRate)
+		r.TaxBase = t.TotalAmount - r.Tax
+	}
+
+	return r
+}
+
+// includedTax is the tax contained in a tax-inclusive total, rounded half up.
+func includedTax(total models.Money, rateBP int) models.Money {
+	tax := new(big.Int).Mul(big.NewInt(int64(total)), big.NewInt(int64(rateBP)))
+	divisor := big.NewInt(int64(10000 + rateBP))
+	tax.Add(tax, new(big.Int).Quo(divisor, big.NewInt(2)))
+	return models.Money(tax.Quo(tax, divisor).Int64())
+}
+
+// Rupiah formats an amount with dots as thousands separators (12.500).
+func Rupiah(m models.Money) string {
+	s := strconv.FormatInt(int64(m), 10)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "." + s[i:]
+	}
+	return sign + s
+}
+
+// Qty formats a quantity with a decimal comma (1,5).
+func Qty(q models.Quantity) string {
+	return strings.Replace(q.String(), ".", ",", 1)
+}
+
+// PaymentLabel is the printed name of a payment method.
+func PaymentLabel(method string) string {
+	switch method {
+	case models.PaymentCash, "":
+		return "TUNAI"
+	case models.PaymentDebit:
+		return "DEBIT"
+	case models.PaymentCredit:
+		return "KARTU KREDIT"
+	case models.PaymentQRIS:
+		return "QRIS"
+	case models.PaymentTransfer:
+		return "TRANSFER"
+	case models.PaymentEWallet:
+		return "E-WALLET"
+	default:
+		return strings.ToUpper(method)
+	}
+}
+
+func formatRate(bp int) string {
+	if bp%100 == 0 {
+		return strconv.Itoa(bp / 100)
+	}
+	return strings.TrimRight(strings.Replace(fmt.Sprintf("%d.%02d", bp/100, bp%100), ".", ",", 1), "0")
+}
+
+// formatDate formats a to_char(..., 'YYYY-MM-DD"T"HH24:MI:SSOF') timestamp,
+// whose offset is "+07" or "+05:30".
+func formatDate(createdAt string) string {
+	for _, layout := range []string{"2006-01-02T15:04:05Z07", "2006-01-02T15:04:05Z07:00"} {
+		if t, err := time.Parse(layout, createdAt); err == nil {
+			return t.Format("02/01/2006 15:04")
+		}
+	}
+	return createdAt
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package receipt
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kasir-api/models"
+)
+
+var update = flag.Bool("update", false, "write the rendered receipts as the new golden files in testdata")
+
+// sample is a cash sale with a long product name, a weighed item, tax and a
+// footer over two lines.
+func sample() *Receipt {
+	store := &models.Store{Name: "Toko Utama", Address: "Jl. Merdeka No. 1, Bandung", NPWP: "01.234.567.8-901.000"}
+	transaction := &models.Transaction{
+		ID:            42,
+		InvoiceNumber: "INV/2026/10/00042",
+		TotalAmount:   37500,
+		Payment:       models.Payment{Method: models.PaymentCash, PaidAmount: 50000, Change: 12500},
+		CreatedAt:     "2026-10-18T14:05:09+07",
+		Details: []models.TransactionDetail{
+			{ProductName: "Indomie Goreng Rendang Spesial Jumbo Pack (isi 5)", Unit: "pcs", Quantity: models.NewQuantity(3), Subtotal: 10500},
+			{ProductName: "Beras (curah)", Unit: "kg", Quantity: 1500, Subtotal: 27000},
+		},
+	}
+	cfg := Config{Footer: "Terima kasih\nBarang yang sudah dibeli tidak dapat dikembalikan", TaxRate: 1100}
+	return New(cfg, store, transaction)
+}
+
+// papers are the paper widths every format is checked at.
+var papers = []int{Paper58, Paper80}
+
+func columns(t *testing.T, paper int) int {
+	t.Helper()
+	cols, err := Columns(paper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cols
+}
+
+// checkGolden compares got with testdata/name byte for byte, or writes it
+// there with -update. Review the diff of an update before committing it.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := firstDiff(golden, got); i >= 0 {
+		t.Errorf("%s differs at byte %d (golden %d bytes, got %d); run go test ./receipt -update after an intended change",
+			name, i, len(golden), len(got))
+	}
+}
+
+func firstDiff(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return min(len(a), len(b))
+	}
+	return -1
+}
+
+func goldenName(paper int, suffix string) string {
+	return fmt.Sprintf("receipt-%d%s", paper, suffix)
+}
@@ -0,0 +1,130 @@
+package receipt
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Text lays the receipt out in fixed-width lines of cols characters for a
+// thermal printer.
+func Text(r *Receipt, cols int) string {
+	return strings.Join(TextLines(r, cols), "\n") + "\n"
+}
+
+// TextLines returns the lines of the text receipt.
+func TextLines(r *Receipt, cols int) []string {
+	rule := strings.Repeat("-", cols)
+	lines := make([]string, 0, 16+2*len(r.Lines))
+
+	for _, l := range wrap(strings.ToUpper(r.StoreName), cols) {
+		lines = append(lines, center(l, cols))
+	}
+	for _, l := range wrap(r.StoreAddress, cols) {
+		lines = append(lines, center(l, cols))
+	}
+	if r.StoreNPWP != "" {
+		lines = append(lines, center("NPWP: "+r.StoreNPWP, cols))
+	}
+
+	lines = append(lines, rule,
+		leftRight("No", r.Number, cols),
+		leftRight("Tanggal", r.Date, cols),
+		rule)
+
+	for _, item := range r.Lines {
+		lines = append(lines, wrap(item.Name, cols)...)
+		qty := "  " + Qty(item.Quantity) + " " + item.Unit + " x " + Rupiah(item.UnitPrice)
+		lines = append(lines, leftRightLines(qty, Rupiah(item.Subtotal), cols)...)
+	}
+
+	lines = append(lines, rule, leftRight("TOTAL", "Rp "+Rupiah(r.Total), cols))
+	if r.TaxLabel != "" {
+		lines = append(lines,
+			leftRight("DPP", Rupiah(r.TaxBase), cols),
+			leftRight(r.TaxLabel, Rupiah(r.Tax), cols))
+	}
+
+	lines = append(lines, rule,
+		leftRight(PaymentLabel(r.Payment.Method), Rupiah(r.Payment.PaidAmount), cols),
+		leftRight("KEMBALI", Rupiah(r.Payment.Change), cols),
+		rule)
+
+	for _, paragraph := range splitLines(r.Footer) {
+		for _, l := range wrap(paragraph, cols) {
+			lines = append(lines, center(l, cols))
+		}
+	}
+
+	return lines
+}
+
+// leftRight puts left and right on one line, padded to cols.
+func leftRight(left, right string, cols int) string {
+	return leftRightLines(left, right, cols)[0]
+}
+
+// leftRightLines puts left and right on one line, or right-aligns right on
+// its own line when both do not fit.
+func leftRightLines(left, right string, cols int) []string {
+	gap := cols - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if gap >= 1 {
+		return []string{left + strings.Repeat(" ", gap) + right}
+	}
+	lines := wrap(left, cols)
+	return append(lines, pad(right, cols))
+}
+
+func center(s string, cols int) string {
+	n := utf8.RuneCountInString(s)
+	if n >= cols {
+		return s
+	}
+	return strings.Repeat(" ", (cols-n)/2) + s
+}
+
+func pad(s string, cols int) string {
+	n := utf8.RuneCountInString(s)
+	if n >= cols {
+		return s
+	}
+	return strings.Repeat(" ", cols-n) + s
+}
+
+// wrap breaks s into lines of at most cols characters at spaces, splitting
+// words that are longer than a line.
+func wrap(s string, cols int) []string {
+	lines := make([]string, 0, 1)
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for utf8.RuneCountInString(word) > cols {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:cols]))
+			word = string(runes[cols:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= cols:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitLines splits text into lines; empty text has none.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,12 @@
+package receipt
+
+import "testing"
+
+func TestTextGolden(t *testing.T) {
+	for _, paper := range papers {
+		name := goldenName(paper, ".txt")
+		t.Run(name, func(t *testing.T) {
+			checkGolden(t, name, []byte(Text(sample(), columns(t, paper))))
+		})
+	}
+}
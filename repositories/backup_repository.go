@@ -0,0 +1,325 @@
+package repositories
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+// backupTables are the tables in a backup, in an order that restores every
+// row after the rows it references. Carts, reservations, transfers, webhooks
+// and the outbox are working state and are left out.
+var backupTables = []struct {
+	name  string
+	order string
+}{
+	{"stores", "id"},
+	{"categories", "id"},
+	{"products", "id"},
+	{"product_units", "id"},
+	{"store_prices", "store_id, product_id"},
+	{"store_stock", "store_id, product_id"},
+	{"stock_batches", "id"},
+	{"stock_writeoffs", "id"},
+	{"transactions", "id"},
+	{"transaction_details", "id"},
+	{"invoice_counters", "store_id, period"},
+}
+
+// BackupTables lists the tables in a backup, in restore order.
+func BackupTables() []string {
+	names := make([]string, len(backupTables))
+	for i, t := range backupTables {
+		names[i] = t.name
+	}
+	return names
+}
+
+// maxBackupLine bounds one row of an archive being restored
+const maxBackupLine = 16 << 20
+
+type BackupRepository struct {
+	db *sql.DB
+}
+
+func NewBackupRepository(db *sql.DB) *BackupRepository {
+	return &BackupRepository{db: db}
+}
+
+// Dump writes a backup archive to w. All tables are read in one snapshot,
+// so the archive is consistent while sales go on, and rows are written as
+// they are read.
+func (repo *BackupRepository) Dump(w io.Writer) error {
+	tx, err := repo.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	header := models.BackupHeader{
+		Format:    models.BackupFormat,
+		Version:   models.BackupVersion,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Tables:    make([]models.BackupTable, 0, len(backupTables)),
+	}
+	for _, t := range backupTables {
+		columns, err := tableColumns(tx, t.name)
+		if err != nil {
+			return err
+		}
+		header.Tables = append(header.Tables, models.BackupTable{Name: t.name, Columns: columns})
+	}
+
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	trailer := models.BackupTrailer{End: true, Rows: make(map[string]int)}
+	for _, t := range backupTables {
+		n, err := dumpTable(tx, enc, t.name, t.order)
+		if err != nil {
+			return fmt.Errorf("backup %s: %w", t.name, err)
+		}
+		trailer.Rows[t.name] = n
+	}
+	if err := enc.Encode(trailer); err != nil {
+		return err
+	}
+
+	return out.Flush()
+}
+
+func dumpTable(tx *sql.Tx, enc *json.Encoder, table, order string) (int, error) {
+	rows, err := tx.Query("SELECT row_to_json(t)::text FROM " + pq.QuoteIdentifier(table) + " t ORDER BY " + order)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return 0, err
+		}
+		if err := enc.Encode(models.BackupRecord{Table: table, Row: row}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	return n, rows.Err()
+}
+
+// tableColumns lists a table's columns in their order.
+func tableColumns(q queryer, table string) ([]string, error) {
+	rows, err := q.Query(`SELECT column_name FROM information_schema.columns
+	                      WHERE table_schema = current_schema() AND table_name = $1
+	                      ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+
+	return columns, rows.Err()
+}
+
+// Restore replays a backup archive into an empty database, with its ids, in
+// one transaction: a bad or truncated archive changes nothing. The database
+// must have been migrated by a build that has every column in the archive;
+// columns the archive lacks get their defaults. The default store created
+// by the migrations is replaced by the archived stores. With dryRun the
+// archive is fully replayed and then rolled back.
+func (repo *BackupRepository) Restore(r io.Reader, dryRun bool) (*models.RestoreResult, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxBackupLine)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("arsip backup kosong")
+	}
+	var header models.BackupHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != models.BackupFormat {
+		return nil, errors.New("file bukan arsip backup kasir-api")
+	}
+	if header.Version != models.BackupVersion {
+		return nil, fmt.Errorf("versi arsip backup %d tidak didukung, build ini memulihkan versi %d", header.Version, models.BackupVersion)
+	}
+
+	// Tables must come in the order of backupTables, so references resolve
+	order := make(map[string]int, len(header.Tables))
+	last := -1
+	for _, t := range header.Tables {
+		i := slices.IndexFunc(backupTables, func(bt struct{ name, order string }) bool { return bt.name == t.Name })
+		if i < 0 {
+			return nil, fmt.Errorf("tabel %s di arsip backup tidak dikenal", t.Name)
+		}
+		if i <= last {
+			return nil, fmt.Errorf("tabel %s di arsip backup tidak berurutan", t.Name)
+		}
+		last = i
+		order[t.Name] = i
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Rows referencing rows later in their table (a category moved under a
+	// newer one) are checked at commit
+	if _, err := tx.Exec("SET CONSTRAINTS ALL DEFERRED"); err != nil {
+		return nil, err
+	}
+
+	inserts := make(map[string]*sql.Stmt, len(header.Tables))
+	hasID := make([]string, 0)
+	for _, t := range header.Tables {
+		columns, err := tableColumns(tx, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range t.Columns {
+			if !slices.Contains(columns, c) {
+				return nil, fmt.Errorf("kolom %s.%s dari arsip tidak ada di database tujuan, jalankan migrasi dari versi aplikasi yang sama", t.Name, c)
+			}
+		}
+		if slices.Contains(t.Columns, "id") {
+			hasID = append(hasID, t.Name)
+		}
+
+		quoted := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			quoted[i] = pq.QuoteIdentifier(c)
+		}
+		list := strings.Join(quoted, ", ")
+		table := pq.QuoteIdentifier(t.Name)
+		stmt, err := tx.Prepare("INSERT INTO " + table + " (" + list + ") SELECT " + list +
+			" FROM json_populate_record(NULL::" + table + ", $1::json)")
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+		inserts[t.Name] = stmt
+	}
+
+	if err := clearForRestore(tx, header.Tables); err != nil {
+		return nil, err
+	}
+
+	result := &models.RestoreResult{Version: header.Version, CreatedAt: header.CreatedAt, Rows: make(map[string]int), DryRun: dryRun}
+	current := -1
+	var trailer *models.BackupTrailer
+	for line := 2; scanner.Scan(); line++ {
+		if trailer != nil {
+			return nil, fmt.Errorf("baris %d: data setelah penutup arsip", line)
+		}
+
+		var entry struct {
+			models.BackupRecord
+			models.BackupTrailer
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("baris %d: %v", line, err)
+		}
+		if entry.End {
+			trailer = &entry.BackupTrailer
+			continue
+		}
+
+		i, ok := order[entry.Table]
+		if !ok {
+			return nil, fmt.Errorf("baris %d: tabel %q tidak ada di header arsip", line, entry.Table)
+		}
+		if i < current {
+			return nil, fmt.Errorf("baris %d: tabel %s tidak berurutan", line, entry.Table)
+		}
+		current = i
+		if _, err := inserts[entry.Table].Exec(string(entry.Row)); err != nil {
+			return nil, fmt.Errorf("baris %d (%s): %w", line, entry.Table, err)
+		}
+		result.Rows[entry.Table]++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if trailer == nil {
+		return nil, errors.New("arsip backup terpotong: penutup arsip tidak ada")
+	}
+	for _, t := range header.Tables {
+		if trailer.Rows[t.Name] != result.Rows[t.Name] {
+			return nil, fmt.Errorf("arsip backup tidak lengkap: %s berisi %d baris, seharusnya %d", t.Name, result.Rows[t.Name], trailer.Rows[t.Name])
+		}
+	}
+
+	// Ids were restored as they were; new rows continue after them
+	for _, table := range hasID {
+		_, err := tx.Exec("SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM "+pq.QuoteIdentifier(table), table)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// clearForRestore checks that the tables to restore are empty. Only the
+// default store seeded by the migrations may exist; it is removed so the
+// archived stores take its place.
+func clearForRestore(tx *sql.Tx, tables []models.BackupTable) error {
+	seeded := false
+	for _, t := range tables {
+		var rows int
+		err := tx.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM " + pq.QuoteIdentifier(t.Name) + " LIMIT 2) r").Scan(&rows)
+		if err != nil {
+			return err
+		}
+		if t.Name == "stores" && rows == 1 {
+			seeded = true
+			continue
+		}
+		if rows > 0 {
+			return fmt.Errorf("tabel %s tidak kosong, restore hanya ke database baru", t.Name)
+		}
+	}
+
+	if !seeded {
+		return nil
+	}
+	_, err := tx.Exec("DELETE FROM stores")
+	if err != nil {
+		return fmt.Errorf("toko bawaan tidak dapat dihapus: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+type BatchRepository struct {
+	db *sql.DB
+}
+
+func NewBatchRepository(db *sql.DB) *BatchRepository {
+	return &BatchRepository{db: db}
+}
+
+const batchColumns = `b.id, b.product_id, p.name, b.batch_code, b.quantity, b.initial_quantity,
+	to_char(b.expiry_date, 'YYYY-MM-DD'), (b.expiry_date - CURRENT_DATE),
+	to_char(b.received_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'), to_char(b.written_off_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`
+
+func scanBatch(rows *sql.Rows) (models.StockBatch, error) {
+	var b models.StockBatch
+	var expiry, writtenOff sql.NullString
+	var daysLeft sql.NullInt64
+	err := rows.Scan(&b.ID, &b.ProductID, &b.ProductName, &b.BatchCode, &b.Quantity, &b.InitialQuantity,
+		&expiry, &daysLeft, &b.ReceivedAt, &writtenOff)
+	if err != nil {
+		return b, err
+	}
+	if expiry.Valid {
+		b.ExpiryDate = &expiry.String
+	}
+	if daysLeft.Valid {
+		d := int(daysLeft.Int64)
+		b.DaysLeft = &d
+	}
+	if writtenOff.Valid {
+		b.WrittenOffAt = &writtenOff.String
+	}
+	return b, nil
+}
+
+func (repo *BatchRepository) GetByProduct(productID int) ([]models.StockBatch, error) {
+	query := `SELECT ` + batchColumns + `
+	          FROM stock_batches b
+	          JOIN products p ON p.id = b.product_id
+	          WHERE b.product_id = $1
+	          ORDER BY b.expiry_date NULLS LAST, b.received_at, b.id`
+	return repo.query(query, productID)
+}
+
+// GetExpiring returns batches with remaining stock that expire within the
+// given number of days, including ones that are already expired.
+func (repo *BatchRepository) GetExpiring(days int) ([]models.StockBatch, error) {
+	query := `SELECT ` + batchColumns + `
+	          FROM stock_batches b
+	          JOIN products p ON p.id = b.product_id
+	          WHERE b.quantity > 0 AND b.written_off_at IS NULL
+	            AND b.expiry_date <= CURRENT_DATE + $1::int
+	          ORDER BY b.expiry_date, p.name, b.id`
+	return repo.query(query, days)
+}
+
+func (repo *BatchRepository) query(query string, args ...interface{}) ([]models.StockBatch, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := make([]models.StockBatch, 0)
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+
+	return batches, rows.Err()
+}
+
+// WriteOff removes the remaining quantity of a batch from stock.
+func (repo *BatchRepository) WriteOff(batchID int, reason string) (*models.StockWriteOff, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	w, err := writeOffBatch(tx, batchID, reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertWriteOffStockChanged(tx, []models.StockWriteOff{*w}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// WriteOffExpired writes off every batch whose expiry date has passed.
+func (repo *BatchRepository) WriteOffExpired(reason string) ([]models.StockWriteOff, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM stock_batches
+	                       WHERE quantity > 0 AND written_off_at IS NULL AND expiry_date < CURRENT_DATE
+	                       ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	writeOffs := make([]models.StockWriteOff, 0, len(ids))
+	for _, id := range ids {
+		w, err := writeOffBatch(tx, id, reason)
+		if err != nil {
+			return nil, err
+		}
+		writeOffs = append(writeOffs, *w)
+	}
+	if len(writeOffs) > 0 {
+		if err := insertWriteOffStockChanged(tx, writeOffs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return writeOffs, nil
+}
+
+// insertWriteOffStockChanged queues stock.changed for the products written
+// off. Batches belong to the default store.
+func insertWriteOffStockChanged(tx *sql.Tx, writeOffs []models.StockWriteOff) error {
+	store, err := resolveStore(tx, 0)
+	if err != nil {
+		return err
+	}
+	productIDs := make([]int, 0, len(writeOffs))
+	for _, w := range writeOffs {
+		productIDs = append(productIDs, w.ProductID)
+	}
+	_, err = insertStockChanged(tx, store, productIDs)
+	return err
+}
+
+func writeOffBatch(tx *sql.Tx, batchID int, reason string) (*models.StockWriteOff, error) {
+	w := models.StockWriteOff{BatchID: batchID, Reason: reason}
+	var writtenOff sql.NullString
+	err := tx.QueryRow("SELECT product_id, quantity, written_off_at::text FROM stock_batches WHERE id = $1 FOR UPDATE", batchID).
+		Scan(&w.ProductID, &w.Quantity, &writtenOff)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("batch tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if writtenOff.Valid || w.Quantity == 0 {
+		return nil, fmt.Errorf("batch %d has no remaining stock to write off", batchID)
+	}
+
+	_, err = tx.Exec("UPDATE stock_batches SET quantity = 0, written_off_at = CURRENT_TIMESTAMP WHERE id = $1", batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE products SET stock = GREATEST(stock - $1, 0) WHERE id = $2", w.Quantity, w.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`INSERT INTO stock_writeoffs (batch_id, product_id, quantity, reason) VALUES ($1, $2, $3, $4)
+	                   RETURNING id, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`,
+		batchID, w.ProductID, w.Quantity, reason).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// createBatch records received stock as a new batch.
+func createBatch(tx *sql.Tx, productID int, qty models.Quantity, batchCode string, expiryDate *string) error {
+	_, err := tx.Exec(`INSERT INTO stock_batches (product_id, batch_code, quantity, initial_quantity, expiry_date)
+	                   VALUES ($1, $2, $3, $3, $4)`, productID, batchCode, qty, expiryDate)
+	return err
+}
+
+// consumeBatchesFEFO takes the needed quantity of each product out of its
+// batches, earliest expiry first, using one query to read and one to update.
+// Expired batches are never sold; they must be written off. Stock that
+// predates batch tracking has no batch and is consumed after all batches.
+func consumeBatchesFEFO(tx *sql.Tx, stock, needs map[int]models.Quantity) error {
+	productIDs := make([]int, 0, len(needs))
+	for id := range needs {
+		productIDs = append(productIDs, id)
+	}
+	ids := pq.Array(sortedProductIDs(productIDs))
+
+	rows, err := tx.Query(`SELECT id, product_id, quantity, COALESCE(expiry_date < CURRENT_DATE, FALSE)
+	                       FROM stock_batches
+	                       WHERE product_id = ANY($1) AND quantity > 0 AND written_off_at IS NULL
+	                       ORDER BY product_id, expiry_date NULLS LAST, received_at, id
+	                       FOR UPDATE`, ids)
+	if err != nil {
+		return err
+	}
+
+	remaining := make(map[int]models.Quantity, len(needs))
+	for id, qty := range needs {
+		remaining[id] = qty
+	}
+	expired := make(map[int]models.Quantity)
+	batchIDs := make([]int64, 0)
+	takes := make([]string, 0)
+	for rows.Next() {
+		var batchID, productID int
+		var available models.Quantity
+		var isExpired bool
+		if err := rows.Scan(&batchID, &productID, &available, &isExpired); err != nil {
+			rows.Close()
+			return err
+		}
+		if isExpired {
+			expired[productID] += available
+			continue
+		}
+		if remaining[productID] <= 0 {
+			continue
+		}
+		n := min(available, remaining[productID])
+		remaining[productID] -= n
+		batchIDs = append(batchIDs, int64(batchID))
+		takes = append(takes, n.String())
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for productID, qty := range needs {
+		if available := stock[productID] - expired[productID]; available < qty {
+			return &StockConflictError{ProductID: productID, Requested: qty, Available: available, Expired: expired[productID]}
+		}
+	}
+
+	if len(batchIDs) == 0 {
+		return nil
+	}
+	_, err = tx.Exec(`UPDATE stock_batches b SET quantity = b.quantity - v.qty
+	                  FROM unnest($1::bigint[], $2::numeric[]) AS v(id, qty)
+	                  WHERE b.id = v.id`, pq.Array(batchIDs), pq.Array(takes))
+	return err
+}
@@ -0,0 +1,526 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+// CartTTL is how long an open or held cart, and the stock it reserves, is kept
+// after its last change.
+const CartTTL = 12 * time.Hour
+
+type CartRepository struct {
+	db *sql.DB
+}
+
+func NewCartRepository(db *sql.DB) *CartRepository {
+	return &CartRepository{db: db}
+}
+
+const cartColumns = `id, store_id, name, status, transaction_id,
+	to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'),
+	to_char(updated_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'),
+	to_char(expires_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`
+
+func scanCart(row interface{ Scan(...interface{}) error }) (*models.Cart, error) {
+	var c models.Cart
+	var transactionID sql.NullInt64
+	err := row.Scan(&c.ID, &c.StoreID, &c.Name, &c.Status, &transactionID, &c.CreatedAt, &c.UpdatedAt, &c.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if transactionID.Valid {
+		id := int(transactionID.Int64)
+		c.TransactionID = &id
+	}
+	return &c, nil
+}
+
+// GetAll lists carts of a store (all stores when storeID is 0), optionally
+// filtered by status.
+func (repo *CartRepository) GetAll(storeID int, status string) ([]models.Cart, error) {
+	if err := repo.expire(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + cartColumns + ` FROM carts
+	          WHERE ($1::bigint = 0 OR store_id = $1) AND ($2 = '' OR status = $2)
+	          ORDER BY updated_at DESC, id DESC`
+	rows, err := repo.db.Query(query, storeID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	carts := make([]models.Cart, 0)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		c, err := scanCart(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		carts = append(carts, *c)
+		ids = append(ids, int64(c.ID))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items, err := loadCartItems(repo.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range carts {
+		if err := fillCart(&carts[i], items[carts[i].ID]); err != nil {
+			return nil, err
+		}
+	}
+
+	return carts, nil
+}
+
+func (repo *CartRepository) GetByID(id int) (*models.Cart, error) {
+	if err := repo.expire(); err != nil {
+		return nil, err
+	}
+	return getCart(repo.db, id, false)
+}
+
+// Create opens an empty cart at a store (0 selects the default store).
+func (repo *CartRepository) Create(cart *models.Cart) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	store, err := resolveStore(tx, cart.StoreID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`INSERT INTO carts (store_id, name, status, expires_at)
+	                   VALUES ($1, $2, $3, CURRENT_TIMESTAMP + $4 * INTERVAL '1 second') RETURNING id`,
+		store.ID, cart.Name, models.CartOpen, int64(CartTTL/time.Second)).Scan(&cart.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	created, err := repo.GetByID(cart.ID)
+	if err != nil {
+		return err
+	}
+	*cart = *created
+	return nil
+}
+
+// Delete discards a cart that has not been checked out.
+func (repo *CartRepository) Delete(id int) error {
+	result, err := repo.db.Exec("DELETE FROM carts WHERE id = $1 AND status <> $2", id, models.CartCheckedOut)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errors.New("keranjang tidak ditemukan atau sudah checkout")
+	}
+
+	return nil
+}
+
+// AddItem adds a line to an open cart priced at the store's current price.
+// Adding a product again in the same unit increases that line's quantity.
+func (repo *CartRepository) AddItem(id int, item models.CheckoutItem) (*models.Cart, error) {
+	return repo.modify(id, models.CartOpen, func(tx *sql.Tx, cart *models.Cart) error {
+		product, unit, err := cartProductUnit(tx, cart.StoreID, item.ProductID, item.Unit)
+		if err != nil {
+			return err
+		}
+
+		var quantity models.Quantity
+		err = tx.QueryRow(`INSERT INTO cart_items (cart_id, product_id, unit, quantity, price) VALUES ($1, $2, $3, $4, $5)
+		                   ON CONFLICT (cart_id, product_id, unit)
+		                   DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity, price = EXCLUDED.price
+		                   RETURNING quantity`,
+			id, item.ProductID, unit.Name, item.Quantity, unit.Price).Scan(&quantity)
+		if err != nil {
+			return err
+		}
+		baseQuantity, err := quantity.Mul(unit.ConversionFactor)
+		if err != nil {
+			return fmt.Errorf("product %d: %w", item.ProductID, err)
+		}
+		return checkWholeQuantity(product, item.ProductID, baseQuantity)
+	})
+}
+
+// UpdateItem sets the quantity of a cart line; quantity 0 removes it.
+func (repo *CartRepository) UpdateItem(id, itemID int, quantity models.Quantity) (*models.Cart, error) {
+	if quantity == 0 {
+		return repo.RemoveItem(id, itemID)
+	}
+
+	return repo.modify(id, models.CartOpen, func(tx *sql.Tx, cart *models.Cart) error {
+		var productID int
+		var unitName string
+		err := tx.QueryRow("SELECT product_id, unit FROM cart_items WHERE id = $1 AND cart_id = $2", itemID, id).
+			Scan(&productID, &unitName)
+		if err == sql.ErrNoRows {
+			return errors.New("item keranjang tidak ditemukan")
+		}
+		if err != nil {
+			return err
+		}
+
+		product, unit, err := cartProductUnit(tx, cart.StoreID, productID, unitName)
+		if err != nil {
+			return err
+		}
+		baseQuantity, err := quantity.Mul(unit.ConversionFactor)
+		if err != nil {
+			return fmt.Errorf("product %d: %w", productID, err)
+		}
+		if err := checkWholeQuantity(product, productID, baseQuantity); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE cart_items SET quantity = $1 WHERE id = $2", quantity, itemID)
+		return err
+	})
+}
+
+func (repo *CartRepository) RemoveItem(id, itemID int) (*models.Cart, error) {
+	return repo.modify(id, models.CartOpen, func(tx *sql.Tx, cart *models.Cart) error {
+		result, err := tx.Exec("DELETE FROM cart_items WHERE id = $1 AND cart_id = $2", itemID, id)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return errors.New("item keranjang tidak ditemukan")
+		}
+		return nil
+	})
+}
+
+// Hold parks an open cart so it cannot be changed or checked out until it
+// is resumed.
+func (repo *CartRepository) Hold(id int) (*models.Cart, error) {
+	return repo.modify(id, models.CartOpen, func(tx *sql.Tx, cart *models.Cart) error {
+		_, err := tx.Exec("UPDATE carts SET status = $1 WHERE id = $2", models.CartHeld, id)
+		return err
+	})
+}
+
+// Resume reopens a held cart and brings its prices up to date.
+func (repo *CartRepository) Resume(id int) (*models.Cart, error) {
+	var previous map[int]models.Money
+	cart, err := repo.modify(id, models.CartHeld, func(tx *sql.Tx, cart *models.Cart) error {
+		_, err := tx.Exec("UPDATE carts SET status = $1 WHERE id = $2", models.CartOpen, id)
+		if err != nil {
+			return err
+		}
+		previous, err = recalculateCart(tx, cart)
+		return err
+	})
+	return markPriceChanges(cart, previous), err
+}
+
+// Recalculate reprices every line of an open cart at the store's current
+// prices; changed lines report their previous price.
+func (repo *CartRepository) Recalculate(id int) (*models.Cart, error) {
+	var previous map[int]models.Money
+	cart, err := repo.modify(id, models.CartOpen, func(tx *sql.Tx, cart *models.Cart) error {
+		var err error
+		previous, err = recalculateCart(tx, cart)
+		return err
+	})
+	return markPriceChanges(cart, previous), err
+}
+
+// modify locks a cart that must be in the given status, applies fn and
+// extends the cart's expiry.
+func (repo *CartRepository) modify(id int, status string, fn func(tx *sql.Tx, cart *models.Cart) error) (*models.Cart, error) {
+	if err := repo.expire(); err != nil {
+		return nil, err
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cart, err := getCart(tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if cart.Status != status {
+		return nil, fmt.Errorf("cart %d is %s, expected %s", id, cart.Status, status)
+	}
+
+	if err := fn(tx, cart); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE carts SET updated_at = CURRENT_TIMESTAMP,
+	                  expires_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second' WHERE id = $2`,
+		int64(CartTTL/time.Second), id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lines (and, for held carts, the extended expiry) are reflected in the
+	// cart's stock reservations
+	if err := syncCartReservations(tx, id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// expire marks open and held carts that passed their expiry as expired; their
+// reservations expire at the same time.
+func (repo *CartRepository) expire() error {
+	_, err := repo.db.Exec(`UPDATE carts SET status = $1
+	                        WHERE status IN ($2, $3) AND expires_at < CURRENT_TIMESTAMP`,
+		models.CartExpired, models.CartOpen, models.CartHeld)
+	if err != nil {
+		return err
+	}
+	return releaseExpiredReservations(repo.db)
+}
+
+// getCart loads a cart with its items, optionally locking it.
+func getCart(q queryer, id int, forUpdate bool) (*models.Cart, error) {
+	query := "SELECT " + cartColumns + " FROM carts WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	cart, err := scanCart(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("keranjang tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := loadCartItems(q, []int64{int64(id)})
+	if err != nil {
+		return nil, err
+	}
+	if err := fillCart(cart, items[id]); err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+// loadCartItems loads the lines of the given carts keyed by cart id.
+func loadCartItems(q queryer, cartIDs []int64) (map[int][]models.CartItem, error) {
+	items := make(map[int][]models.CartItem)
+	if len(cartIDs) == 0 {
+		return items, nil
+	}
+
+	rows, err := q.Query(`SELECT ci.cart_id, ci.id, ci.product_id, p.name, ci.unit, ci.quantity, ci.price
+	                      FROM cart_items ci
+	                      JOIN products p ON p.id = ci.product_id
+	                      WHERE ci.cart_id = ANY($1)
+	                      ORDER BY ci.id`, pq.Array(cartIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cartID int
+		var item models.CartItem
+		if err := rows.Scan(&cartID, &item.ID, &item.ProductID, &item.ProductName, &item.Unit, &item.Quantity, &item.Price); err != nil {
+			return nil, err
+		}
+		items[cartID] = append(items[cartID], item)
+	}
+
+	return items, rows.Err()
+}
+
+// fillCart sets a cart's items, line subtotals and total.
+func fillCart(cart *models.Cart, items []models.CartItem) error {
+	cart.Items = make([]models.CartItem, 0, len(items))
+	cart.TotalAmount = 0
+	for _, item := range items {
+		subtotal, err := item.Price.MulQuantity(item.Quantity)
+		if err != nil {
+			return err
+		}
+		item.Subtotal = subtotal
+		cart.TotalAmount, err = cart.TotalAmount.Add(subtotal)
+		if err != nil {
+			return err
+		}
+		cart.Items = append(cart.Items, item)
+	}
+	return nil
+}
+
+// cartProductUnit resolves a product's selling unit and price at a store.
+func cartProductUnit(tx *sql.Tx, storeID, productID int, unitName string) (*checkoutProduct, models.ProductUnit, error) {
+	store, err := resolveStore(tx, storeID)
+	if err != nil {
+		return nil, models.ProductUnit{}, err
+	}
+	products, err := loadCheckoutProducts(tx, store, []int{productID}, false)
+	if err != nil {
+		return nil, models.ProductUnit{}, err
+	}
+	product, ok := products[productID]
+	if !ok {
+		return nil, models.ProductUnit{}, fmt.Errorf("product id %d not found", productID)
+	}
+	unit, err := product.unit(unitName)
+	return product, unit, err
+}
+
+func checkWholeQuantity(product *checkoutProduct, productID int, baseQuantity models.Quantity) error {
+	if !product.soldByWeight && !baseQuantity.IsWhole() {
+		return fmt.Errorf("product %d is not sold by weight, quantity must be a whole number", productID)
+	}
+	return nil
+}
+
+// recalculateCart reprices the cart's lines and returns the previous price of
+// every line whose price changed.
+func recalculateCart(tx *sql.Tx, cart *models.Cart) (map[int]models.Money, error) {
+	previous := make(map[int]models.Money)
+	if len(cart.Items) == 0 {
+		return previous, nil
+	}
+
+	store, err := resolveStore(tx, cart.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	productIDs := make([]int, len(cart.Items))
+	for i, item := range cart.Items {
+		productIDs[i] = item.ProductID
+	}
+	products, err := loadCheckoutProducts(tx, store, productIDs, false)
+	if err != nil {
+		return nil, err
+	}
+
+	itemIDs := make([]int64, 0)
+	prices := make([]int64, 0)
+	for _, item := range cart.Items {
+		product, ok := products[item.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("product id %d not found", item.ProductID)
+		}
+		unit, err := product.unit(item.Unit)
+		if err != nil {
+			return nil, err
+		}
+		if unit.Price != item.Price {
+			previous[item.ID] = item.Price
+			itemIDs = append(itemIDs, int64(item.ID))
+			prices = append(prices, int64(unit.Price))
+		}
+	}
+
+	if len(itemIDs) > 0 {
+		_, err = tx.Exec(`UPDATE cart_items c SET price = v.price
+		                  FROM unnest($1::bigint[], $2::bigint[]) AS v(id, price)
+		                  WHERE c.id = v.id`, pq.Array(itemIDs), pq.Array(prices))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return previous, nil
+}
+
+func markPriceChanges(cart *models.Cart, previous map[int]models.Money) *models.Cart {
+	if cart == nil {
+		return nil
+	}
+	for i := range cart.Items {
+		if price, ok := previous[cart.Items[i].ID]; ok {
+			cart.Items[i].PreviousPrice = &price
+		}
+	}
+	return cart
+}
+
+// lockCartForCheckout locks an open cart and returns its store and lines as
+// checkout items. For a cart that was already checked out it returns the id
+// of its transaction instead.
+func lockCartForCheckout(tx *sql.Tx, cartID int) (int, []models.CheckoutItem, int, error) {
+	var storeID int
+	var status string
+	var transactionID sql.NullInt64
+	var expired bool
+	err := tx.QueryRow(`SELECT store_id, status, transaction_id, expires_at < CURRENT_TIMESTAMP
+	                    FROM carts WHERE id = $1 FOR UPDATE`, cartID).Scan(&storeID, &status, &transactionID, &expired)
+	if err == sql.ErrNoRows {
+		return 0, nil, 0, errors.New("keranjang tidak ditemukan")
+	}
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	switch {
+	case status == models.CartCheckedOut && transactionID.Valid:
+		return storeID, nil, int(transactionID.Int64), nil
+	case status == models.CartExpired || (status != models.CartCheckedOut && expired):
+		return 0, nil, 0, fmt.Errorf("cart %d has expired", cartID)
+	case status != models.CartOpen:
+		return 0, nil, 0, fmt.Errorf("cart %d is %s, resume it before checkout", cartID, status)
+	}
+
+	rows, err := tx.Query("SELECT product_id, unit, quantity FROM cart_items WHERE cart_id = $1 ORDER BY id", cartID)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer rows.Close()
+
+	items := make([]models.CheckoutItem, 0)
+	for rows.Next() {
+		var item models.CheckoutItem
+		if err := rows.Scan(&item.ProductID, &item.Unit, &item.Quantity); err != nil {
+			return 0, nil, 0, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil, 0, fmt.Errorf("cart %d is empty", cartID)
+	}
+
+	return storeID, items, 0, nil
+}
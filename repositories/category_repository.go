@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"kasir-api/models"
+	"strconv"
+	"strings"
 )
 
 type CategoryRepository struct {
@@ -14,38 +16,106 @@ func NewCategoryRepository(db *sql.DB) *CategoryRepository {
 	return &CategoryRepository{db: db}
 }
 
-func (repo *CategoryRepository) GetAll() ([]models.Category, error) {
-	query := "SELECT id, name, description FROM categories ORDER BY id"
-	rows, err := repo.db.Query(query)
+// GetAll lists a page of the categories matching the query.
+func (repo *CategoryRepository) GetAll(query models.CategoryQuery) ([]models.Category, *models.PageInfo, error) {
+	sort, err := parseSort(query.Sort, map[string]string{"name": "name"})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	whereClause := func() string {
+		if len(where) == 0 {
+			return ""
+		}
+		return " WHERE " + strings.Join(where, " AND ")
+	}
+	if query.Name != "" {
+		where = append(where, "name ILIKE '%' || "+arg(query.Name)+" || '%'")
+	}
+
+	page := &models.PageInfo{}
+	err = repo.db.QueryRow("SELECT COUNT(*) FROM categories"+whereClause(), args...).Scan(&page.Total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if query.After != "" {
+		c, err := parseCursor(query.After, sort)
+		if err != nil {
+			return nil, nil, err
+		}
+		where = append(where, sort.after("id", c, c.Key, "text", arg))
+	}
+
+	rows, err := repo.db.Query("SELECT id, name, description, parent_id FROM categories"+whereClause()+sort.orderBy("id")+pageLimit(query.ListQuery), args...)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	categories := make([]models.Category, 0)
 	for rows.Next() {
 		var c models.Category
-		err := rows.Scan(&c.ID, &c.Name, &c.Description)
+		err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.ParentID)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		categories = append(categories, c)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if query.Limit > 0 && len(categories) > query.Limit {
+		categories = categories[:query.Limit]
+		last := categories[len(categories)-1]
+		c := listCursor{Sort: sort.field, ID: last.ID}
+		if sort.field == "name" {
+			c.Key = last.Name
+		}
+		page.NextCursor = c.String()
+	}
 
-	return categories, nil
+	return categories, page, nil
 }
 
 func (repo *CategoryRepository) Create(category *models.Category) error {
-	query := "INSERT INTO categories (name, description) VALUES ($1, $2) RETURNING id"
-	err := repo.db.QueryRow(query, category.Name, category.Description).Scan(&category.ID)
-	return err
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if category.ParentID != nil {
+		if err := checkParentExists(tx, *category.ParentID); err != nil {
+			return err
+		}
+	}
+
+	query := "INSERT INTO categories (name, description, parent_id) VALUES ($1, $2, $3) RETURNING id"
+	err = tx.QueryRow(query, category.Name, category.Description, category.ParentID).Scan(&category.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertOutbox(tx, models.EventCategoryCreated, category); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (repo *CategoryRepository) GetByID(id int) (*models.Category, error) {
-	query := "SELECT id, name, description FROM categories WHERE id = $1"
+	query := "SELECT id, name, description, parent_id FROM categories WHERE id = $1"
 
 	var c models.Category
-	err := repo.db.QueryRow(query, id).Scan(&c.ID, &c.Name, &c.Description)
+	err := repo.db.QueryRow(query, id).Scan(&c.ID, &c.Name, &c.Description, &c.ParentID)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("kategori tidak ditemukan")
 	}
@@ -57,38 +127,159 @@ func (repo *CategoryRepository) GetByID(id int) (*models.Category, error) {
 }
 
 func (repo *CategoryRepository) Update(category *models.Category) error {
-	query := "UPDATE categories SET name = $1, description = $2 WHERE id = $3"
-	result, err := repo.db.Exec(query, category.Name, category.Description, category.ID)
+	tx, err := repo.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := result.RowsAffected()
+	// The parent is changed only by Move
+	query := "UPDATE categories SET name = $1, description = $2 WHERE id = $3 RETURNING parent_id"
+	err = tx.QueryRow(query, category.Name, category.Description, category.ID).Scan(&category.ParentID)
+	if err == sql.ErrNoRows {
+		return errors.New("kategori tidak ditemukan")
+	}
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return errors.New("kategori tidak ditemukan")
+	if err := insertOutbox(tx, models.EventCategoryUpdated, category); err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
+// Delete removes a category; its subcategories move up to its parent.
 func (repo *CategoryRepository) Delete(id int) error {
-	query := "DELETE FROM categories WHERE id = $1"
-	result, err := repo.db.Exec(query, id)
+	tx, err := repo.db.Begin()
 	if err != nil {
 		return err
 	}
-	rows, err := result.RowsAffected()
-	if err != nil {
+	defer tx.Rollback()
+
+	if err := lockCategoryTree(tx); err != nil {
 		return err
 	}
 
-	if rows == 0 {
+	var parentID *int
+	err = tx.QueryRow("SELECT parent_id FROM categories WHERE id = $1", id).Scan(&parentID)
+	if err == sql.ErrNoRows {
 		return errors.New("kategori tidak ditemukan")
 	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`UPDATE categories SET parent_id = $2 WHERE parent_id = $1
+	                       RETURNING id, name, description, parent_id`, id, parentID)
+	if err != nil {
+		return err
+	}
+	children := make([]models.Category, 0)
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.ParentID); err != nil {
+			rows.Close()
+			return err
+		}
+		children = append(children, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range children {
+		if err := insertOutbox(tx, models.EventCategoryUpdated, &children[i]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM categories WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	if err := insertOutbox(tx, models.EventCategoryDeleted, map[string]int{"id": id}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Move puts a category, with everything below it, under parentID, or at
+// the top level when parentID is nil. A category cannot be moved under
+// itself or one of its own subcategories.
+func (repo *CategoryRepository) Move(id int, parentID *int) (*models.Category, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCategoryTree(tx); err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		if err := checkParentExists(tx, *parentID); err != nil {
+			return nil, err
+		}
+		var cycle bool
+		err := tx.QueryRow("SELECT $2 IN "+categorySubtree("$1"), id, *parentID).Scan(&cycle)
+		if err != nil {
+			return nil, err
+		}
+		if cycle {
+			return nil, errors.New("induk kategori tidak valid: kategori tidak bisa dipindah ke bawah dirinya sendiri atau subkategorinya")
+		}
+	}
+
+	var c models.Category
+	err = tx.QueryRow(`UPDATE categories SET parent_id = $2 WHERE id = $1
+	                   RETURNING id, name, description, parent_id`, id, parentID).Scan(&c.ID, &c.Name, &c.Description, &c.ParentID)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("kategori tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	if err := insertOutbox(tx, models.EventCategoryUpdated, &c); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// lockCategoryTree serialises changes to the tree: two moves checked at the
+// same time could otherwise together make a cycle.
+func lockCategoryTree(tx *sql.Tx) error {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('category_tree'))")
+	return err
+}
+
+func checkParentExists(tx *sql.Tx, parentID int) error {
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)", parentID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("kategori induk tidak ditemukan")
+	}
 	return nil
 }
+
+// categorySubtree selects the ids of the category in param and of all the
+// categories below it. UNION stops at rows already found, so even a cycle
+// made by hand in the database cannot make it loop.
+func categorySubtree(param string) string {
+	return `(WITH RECURSIVE subtree AS (
+	            SELECT id FROM categories WHERE id = ` + param + `
+	            UNION
+	            SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+	        ) SELECT id FROM subtree)`
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"kasir-api/database"
+	"kasir-api/invoice"
+	"kasir-api/models"
+)
+
+// testDB connects to the database in TEST_DB_CONN (a DB_CONN style DSN) and
+// migrates it, or skips the test when it is not set. Tests create products
+// and sales there, so never point it at a database holding real data.
+func testDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	conn := os.Getenv("TEST_DB_CONN")
+	if conn == "" {
+		tb.Skip("TEST_DB_CONN not set")
+	}
+	db, err := database.InitDB(conn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestProducts adds n products of the default store with the given
+// stock each and returns their ids.
+func createTestProducts(tb testing.TB, db *sql.DB, n int, stock int64) []int {
+	tb.Helper()
+	repo := NewProductRepository(db)
+	prefix := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	ids := make([]int, n)
+	for i := range ids {
+		product := &models.Product{
+			Name:     fmt.Sprintf("%s-%d", prefix, i),
+			Price:    1000,
+			Stock:    models.NewQuantity(stock),
+			BaseUnit: "pcs",
+		}
+		if err := repo.Create(product); err != nil {
+			tb.Fatal(err)
+		}
+		ids[i] = product.ID
+	}
+	return ids
+}
+
+func newTestTransactionRepository(db *sql.DB) *TransactionRepository {
+	return NewTransactionRepository(db, invoice.DefaultFormat, 0)
+}
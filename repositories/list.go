@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"kasir-api/models"
+)
+
+// listSort is the column a listing is sorted on; ties are broken by id, so
+// every row has one place in the order and keyset pages never skip or
+// repeat a row.
+type listSort struct {
+	field string
+	expr  string
+	desc  bool
+}
+
+// parseSort looks sort up in the fields a listing can be sorted on; empty
+// sorts by id.
+func parseSort(sort string, fields map[string]string) (listSort, error) {
+	if sort == "" {
+		sort = "id"
+	}
+	field, desc := strings.CutPrefix(sort, "-")
+	if field == "id" {
+		return listSort{field: field, expr: "id", desc: desc}, nil
+	}
+	expr, ok := fields[field]
+	if !ok {
+		return listSort{}, fmt.Errorf("sort %q tidak valid", sort)
+	}
+	return listSort{field: field, expr: expr, desc: desc}, nil
+}
+
+// orderBy is the ORDER BY clause of the sort, with id the column holding
+// the row's id.
+func (s listSort) orderBy(id string) string {
+	dir := ""
+	if s.desc {
+		dir = " DESC"
+	}
+	if s.field == "id" {
+		return " ORDER BY " + id + dir
+	}
+	return " ORDER BY " + s.expr + dir + ", " + id + dir
+}
+
+// after is the condition selecting the rows after the cursor's row; arg
+// adds a query argument and returns its placeholder. key is the cursor's
+// value parsed for the sort column and cast is its SQL type.
+func (s listSort) after(id string, c listCursor, key interface{}, cast string, arg func(interface{}) string) string {
+	op := " > "
+	if s.desc {
+		op = " < "
+	}
+	if s.field == "id" {
+		return id + op + arg(c.ID)
+	}
+	return "(" + s.expr + ", " + id + ")" + op + "(" + arg(key) + "::" + cast + ", " + arg(c.ID) + ")"
+}
+
+// listCursor points to the last row of a page: its id and the value of the
+// column the listing is sorted on. It is only valid for that sort.
+type listCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k,omitempty"`
+	ID   int    `json:"id"`
+}
+
+func (c listCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+var errBadCursor = errors.New("cursor tidak valid")
+
+func parseCursor(s string, sort listSort) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, errBadCursor
+	}
+	if c.Sort != sort.field {
+		return c, errors.New("cursor tidak valid untuk urutan ini, mulai lagi dari halaman pertama")
+	}
+	return c, nil
+}
+
+// pageLimit adds LIMIT and OFFSET for a page. One row more than the page is
+// read, to know whether there is a next page.
+func pageLimit(query models.ListQuery) string {
+	clause := ""
+	if query.Limit > 0 {
+		clause += " LIMIT " + strconv.Itoa(query.Limit+1)
+	}
+	if query.Offset > 0 {
+		clause += " OFFSET " + strconv.Itoa(query.Offset)
+	}
+	return clause
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+// maxTxAttempts is how often a transaction is tried when Postgres aborts it
+// with a serialization failure or deadlock.
+const maxTxAttempts = 3
+
+// isRetryable reports whether err is a serialization failure (40001) or a
+// detected deadlock (40P01), after which the whole transaction can be rerun.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+// retryOnConflict runs fn again, with a short backoff, when it failed with a
+// retryable error. fn must run its own database transaction.
+func retryOnConflict(name string, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = fn()
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		log.Printf("%s: retrying after %v (attempt %d/%d)\n", name, err, attempt, maxTxAttempts)
+		time.Sleep(time.Duration(attempt*attempt) * 20 * time.Millisecond)
+	}
+	return err
+}
+
+// sortedProductIDs returns the distinct product ids in ascending order.
+func sortedProductIDs(productIDs []int) []int64 {
+	ids := make([]int64, 0, len(productIDs))
+	for _, id := range productIDs {
+		ids = append(ids, int64(id))
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// lockStock locks and returns the stock of the given products at a store, in
+// ascending product id order. Taking locks in one global order means two
+// checkouts containing the same products can never deadlock each other.
+// Products without a stock row at a non-default store have stock 0.
+func lockStock(tx *sql.Tx, store *models.Store, productIDs []int) (map[int]models.Quantity, error) {
+	query := `SELECT product_id, stock FROM store_stock WHERE store_id = $1 AND product_id = ANY($2)
+	          ORDER BY product_id FOR UPDATE`
+	args := []interface{}{store.ID, pq.Array(sortedProductIDs(productIDs))}
+	if store.IsDefault {
+		query = "SELECT id, stock FROM products WHERE id = ANY($1) ORDER BY id FOR UPDATE"
+		args = args[1:]
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stock := make(map[int]models.Quantity, len(productIDs))
+	for rows.Next() {
+		var id int
+		var qty models.Quantity
+		if err := rows.Scan(&id, &qty); err != nil {
+			return nil, err
+		}
+		stock[id] = qty
+	}
+
+	return stock, rows.Err()
+}
+
+// decrementStock takes the needed quantities out of stock at a store in one
+// statement. Each row only changes while enough stock is left, so stock can
+// never go negative even if an earlier check raced with another transaction.
+func decrementStock(tx *sql.Tx, store *models.Store, needs map[int]models.Quantity) error {
+	ids := make([]int64, 0, len(needs))
+	qtys := make([]string, 0, len(needs))
+	for id, qty := range needs {
+		ids = append(ids, int64(id))
+		qtys = append(qtys, qty.String())
+	}
+
+	query := `UPDATE store_stock s SET stock = s.stock - v.qty
+	          FROM unnest($2::bigint[], $3::numeric[]) AS v(id, qty)
+	          WHERE s.store_id = $1 AND s.product_id = v.id AND s.stock >= v.qty`
+	args := []interface{}{store.ID, pq.Array(ids), pq.Array(qtys)}
+	if store.IsDefault {
+		query = `UPDATE products p SET stock = p.stock - v.qty
+		         FROM unnest($1::bigint[], $2::numeric[]) AS v(id, qty)
+		         WHERE p.id = v.id AND p.stock >= v.qty`
+		args = args[1:]
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != int64(len(needs)) {
+		return errors.New("stock not enough for one or more products")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"deadlock", &pq.Error{Code: "40P01"}, true},
+		{"wrapped deadlock", fmt.Errorf("checkout: %w", &pq.Error{Code: "40P01"}), true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"stock conflict", &StockConflictError{ProductID: 1}, false},
+		{"plain error", errors.New("connection refused"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortedProductIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []int
+		want []int64
+	}{
+		{"empty", nil, []int64{}},
+		{"sorted", []int{1, 2, 3}, []int64{1, 2, 3}},
+		{"shuffled", []int{9, 3, 7, 1}, []int64{1, 3, 7, 9}},
+		{"duplicates", []int{5, 2, 5, 2, 8}, []int64{2, 5, 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortedProductIDs(tt.ids); !slices.Equal(got, tt.want) {
+				t.Errorf("sortedProductIDs(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCreateTransactionConcurrentLocking sells the same few products from
+// many goroutines at once, each basket in its own random order. Checkouts
+// must only fail for lack of stock, never with a deadlock, and stock must end
+// at exactly what was not sold, never below zero.
+func TestCreateTransactionConcurrentLocking(t *testing.T) {
+	db := testDB(t)
+	repo := newTestTransactionRepository(db)
+
+	const (
+		products  = 5
+		stock     = 30
+		workers   = 16
+		perWorker = 10
+	)
+	ids := createTestProducts(t, db, products, stock)
+
+	var mu sync.Mutex
+	sold := make(map[int]int64, products)
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				basket := slices.Clone(ids)
+				rand.Shuffle(len(basket), func(i, j int) { basket[i], basket[j] = basket[j], basket[i] })
+				basket = basket[:1+rand.IntN(len(basket))]
+
+				items := make([]models.CheckoutItem, len(basket))
+				for i, id := range basket {
+					items[i] = models.CheckoutItem{ProductID: id, Quantity: models.NewQuantity(1)}
+				}
+				_, err := repo.CreateTransaction(models.CheckoutRequest{Items: items})
+				var conflict *StockConflictError
+				if errors.As(err, &conflict) {
+					continue
+				}
+				if err != nil {
+					errs <- err
+					continue
+				}
+				mu.Lock()
+				for _, id := range basket {
+					sold[id]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("checkout failed: %v (retryable: %v)", err, isRetryable(err))
+	}
+	for _, id := range ids {
+		var left models.Quantity
+		if err := db.QueryRow("SELECT stock FROM products WHERE id = $1", id).Scan(&left); err != nil {
+			t.Fatal(err)
+		}
+		if left < 0 {
+			t.Errorf("product %d: stock %s below zero", id, left)
+		}
+		if want := models.NewQuantity(stock - sold[id]); left != want {
+			t.Errorf("product %d: stock %s, want %s after selling %d", id, left, want, sold[id])
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"cmp"
+	"database/sql"
+	"slices"
+	"time"
+
+	"kasir-api/models"
+	"kasir-api/outbox"
+
+	"github.com/lib/pq"
+)
+
+// OutboxRepository is the outbox.Store of the events written by the other
+// repositories with insertOutbox.
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// insertOutbox stores an event in the transaction making the change it
+// describes, so the event exists exactly when the change was committed.
+func insertOutbox(tx *sql.Tx, eventType string, data interface{}) error {
+	e, err := outbox.NewEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO outbox (event_id, event_type, payload) VALUES ($1, $2, $3)",
+		e.EventID, e.Type, string(e.Payload))
+	return err
+}
+
+// insertStockChanged queues stock.changed with the stock the transaction left
+// for the given products at a store, and returns those levels.
+func insertStockChanged(tx *sql.Tx, store *models.Store, productIDs []int) ([]models.StockLevel, error) {
+	rows, err := tx.Query(`SELECT p.id, p.name, CASE WHEN $2 THEN p.stock ELSE COALESCE(ss.stock, 0) END
+	                       FROM products p
+	                       LEFT JOIN store_stock ss ON ss.product_id = p.id AND ss.store_id = $3
+	                       WHERE p.id = ANY($1)
+	                       ORDER BY p.id`, pq.Array(sortedProductIDs(productIDs)), store.IsDefault, store.ID)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]models.StockLevel, 0, len(productIDs))
+	for rows.Next() {
+		var l models.StockLevel
+		if err := rows.Scan(&l.ProductID, &l.ProductName, &l.Stock); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		levels = append(levels, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	reserved, err := reservedStock(tx, store.ID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range levels {
+		levels[i].Available = levels[i].Stock - reserved[levels[i].ProductID]
+	}
+
+	err = insertOutbox(tx, models.EventStockChanged, models.StockChange{StoreID: store.ID, Products: levels})
+	return levels, err
+}
+
+func (repo *OutboxRepository) ClaimDue(limit int, lease time.Duration) ([]outbox.Event, error) {
+	rows, err := repo.db.Query(`WITH due AS (
+	                                SELECT id FROM outbox
+	                                WHERE dispatched_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+	                                ORDER BY id
+	                                LIMIT $1
+	                                FOR UPDATE SKIP LOCKED
+	                            )
+	                            UPDATE outbox o
+	                            SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+	                            FROM due WHERE o.id = due.id
+	                            RETURNING o.id, o.event_id, o.event_type, o.payload, o.attempts, o.delivered_to`,
+		limit, int64(lease/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]outbox.Event, 0)
+	for rows.Next() {
+		var e outbox.Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Type, &payload, &e.Attempts, pq.Array(&e.Delivered)); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// UPDATE ... RETURNING gives no order; events go out in insert order
+	slices.SortFunc(events, func(a, b outbox.Event) int { return cmp.Compare(a.ID, b.ID) })
+	return events, nil
+}
+
+func (repo *OutboxRepository) MarkSent(id int64, sinks []string, done bool, lastErr string, retryIn time.Duration) error {
+	_, err := repo.db.Exec(`UPDATE outbox
+	                        SET delivered_to = delivered_to || $1::text[], attempts = attempts + 1, last_error = $2,
+	                            next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second',
+	                            dispatched_at = CASE WHEN $4 THEN CURRENT_TIMESTAMP END
+	                        WHERE id = $5`,
+		pq.Array(sinks), lastErr, int64(retryIn/time.Second), done, id)
+	return err
+}
+
+func (repo *OutboxRepository) Purge(age time.Duration) error {
+	_, err := repo.db.Exec("DELETE FROM outbox WHERE dispatched_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'",
+		int64(age/time.Second))
+	return err
+}
+
+// LastID returns the id of the newest event, 0 when there is none.
+func (repo *OutboxRepository) LastID() (int64, error) {
+	var id int64
+	err := repo.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM outbox").Scan(&id)
+	return id, err
+}
+
+// After returns up to limit events with an id above afterID, delivered or
+// not, in id order.
+func (repo *OutboxRepository) After(afterID int64, limit int) ([]outbox.Event, error) {
+	rows, err := repo.db.Query(`SELECT id, event_id, event_type, payload FROM outbox
+	                            WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]outbox.Event, 0)
+	for rows.Next() {
+		var e outbox.Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Type, &payload); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,362 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+// importRowError is a problem with one import row; the other rows are still
+// checked.
+type importRowError struct {
+	field   string
+	message string
+}
+
+func (e *importRowError) Error() string {
+	return e.message
+}
+
+func rowErrorf(field, format string, args ...interface{}) error {
+	return &importRowError{field: field, message: fmt.Sprintf(format, args...)}
+}
+
+// Import creates or updates products from import rows in one transaction.
+// Rows are matched to existing products on match (models.ImportMatchSKU or
+// models.ImportMatchName, case-insensitive); a matched product only changes
+// in the fields its row carries. Categories are looked up by name and
+// created when missing. Stock is the default store's.
+//
+// Every row is tried, each under a savepoint, so all row errors are reported
+// at once. The import is committed only when no row failed and dryRun is
+// not set; otherwise it is rolled back and the result tells what it would
+// have done.
+func (repo *ProductRepository) Import(rows []models.ProductImportRow, match string, dryRun bool) (*models.ImportResult, error) {
+	result := &models.ImportResult{
+		DryRun:            dryRun,
+		Match:             match,
+		Rows:              len(rows),
+		CategoriesCreated: make([]string, 0),
+		Products:          make([]models.ImportedProduct, 0),
+		Errors:            make([]models.ImportError, 0),
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	categories, err := loadImportCategories(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Row number each match key was first seen on
+	seen := make(map[string]int)
+	stocked := make([]int, 0)
+	for _, row := range rows {
+		key, err := importKey(row, match)
+		if err == nil {
+			if first, ok := seen[key]; ok {
+				err = rowErrorf(match, "baris duplikat, %s sama dengan baris %d", match, first)
+			} else {
+				seen[key] = row.Row
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, importError(row.Row, err))
+			continue
+		}
+
+		if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+			return nil, err
+		}
+		imported, err := importRow(tx, row, match, categories)
+		if err != nil {
+			if !isRowError(err) {
+				return nil, err
+			}
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); err != nil {
+				return nil, err
+			}
+			categories.discard()
+			result.Errors = append(result.Errors, importError(row.Row, err))
+			continue
+		}
+		if _, err := tx.Exec("RELEASE SAVEPOINT import_row"); err != nil {
+			return nil, err
+		}
+
+		result.CategoriesCreated = append(result.CategoriesCreated, categories.keep()...)
+		result.Products = append(result.Products, *imported)
+		if imported.Action == models.ImportCreate {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+		if row.Stock != nil {
+			stocked = append(stocked, imported.ProductID)
+		}
+	}
+
+	if dryRun || len(result.Errors) > 0 {
+		// Ids of products created here were rolled back with them
+		for i := range result.Products {
+			if result.Products[i].Action == models.ImportCreate {
+				result.Products[i].ProductID = 0
+			}
+		}
+		return result, nil
+	}
+
+	if len(stocked) > 0 {
+		store, err := resolveStore(tx, 0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := insertStockChanged(tx, store, stocked); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// importKey is what a row is matched on, normalized for finding duplicates.
+func importKey(row models.ProductImportRow, match string) (string, error) {
+	if match == models.ImportMatchSKU {
+		if row.SKU == nil {
+			return "", rowErrorf("sku", "sku wajib diisi")
+		}
+		return *row.SKU, nil
+	}
+	if row.Name == nil {
+		return "", rowErrorf("name", "nama produk wajib diisi")
+	}
+	return strings.ToLower(*row.Name), nil
+}
+
+func importRow(tx *sql.Tx, row models.ProductImportRow, match string, categories *importCategories) (*models.ImportedProduct, error) {
+	id, err := findImportMatch(tx, row, match)
+	if err != nil {
+		return nil, err
+	}
+
+	action := models.ImportCreate
+	product := &models.Product{BaseUnit: "pcs"}
+	if id != 0 {
+		action = models.ImportUpdate
+		product, err = getProduct(tx, id)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if row.Name == nil {
+			return nil, rowErrorf("name", "nama produk wajib diisi untuk produk baru")
+		}
+		if row.Price == nil {
+			return nil, rowErrorf("price", "harga wajib diisi untuk produk baru")
+		}
+	}
+
+	if row.SKU != nil {
+		product.SKU = *row.SKU
+	}
+	if row.Name != nil {
+		product.Name = *row.Name
+	}
+	if row.Price != nil {
+		product.Price = *row.Price
+	}
+	if row.Stock != nil {
+		product.Stock = *row.Stock
+	}
+	if row.BaseUnit != nil {
+		product.BaseUnit = *row.BaseUnit
+	}
+	if row.SoldByWeight != nil {
+		product.SoldByWeight = *row.SoldByWeight
+	}
+	if row.Barcode != nil {
+		product.Barcode = *row.Barcode
+	}
+	if row.Category != nil {
+		categoryID, err := categories.resolve(tx, *row.Category)
+		if err != nil {
+			return nil, err
+		}
+		product.CategoryID = &categoryID
+	}
+
+	if !product.SoldByWeight && !product.Stock.IsWhole() {
+		return nil, rowErrorf("stock", "produk tidak dijual per berat, stock harus bilangan bulat")
+	}
+
+	if id != 0 {
+		err = updateProduct(tx, product)
+	} else {
+		err = insertProduct(tx, product)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	eventType := models.EventProductUpdated
+	if action == models.ImportCreate {
+		eventType = models.EventProductCreated
+	}
+	if err := insertProductEvent(tx, eventType, product.ID); err != nil {
+		return nil, err
+	}
+
+	return &models.ImportedProduct{Row: row.Row, Action: action, ProductID: product.ID, Name: product.Name}, nil
+}
+
+// findImportMatch returns the id of the product a row updates, 0 when it
+// creates one.
+func findImportMatch(tx *sql.Tx, row models.ProductImportRow, match string) (int, error) {
+	if match == models.ImportMatchSKU {
+		var id int
+		err := tx.QueryRow("SELECT id FROM products WHERE sku = $1 FOR UPDATE", *row.SKU).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return id, err
+	}
+
+	rows, err := tx.Query("SELECT id FROM products WHERE lower(name) = lower($1) ORDER BY id LIMIT 2 FOR UPDATE", *row.Name)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, 2)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	switch len(ids) {
+	case 0:
+		return 0, nil
+	case 1:
+		return ids[0], nil
+	}
+	return 0, rowErrorf("name", "nama produk %q dipakai lebih dari satu produk, cocokkan dengan sku", *row.Name)
+}
+
+// isRowError reports whether err only fails its row: a validation error, or
+// bad data or a violated constraint reported by Postgres.
+func isRowError(err error) bool {
+	var rowErr *importRowError
+	if errors.As(err, &rowErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		class := pqErr.Code.Class()
+		return class == "22" || class == "23"
+	}
+	return false
+}
+
+func importError(row int, err error) models.ImportError {
+	var rowErr *importRowError
+	if errors.As(err, &rowErr) {
+		return models.ImportError{Row: row, Field: rowErr.field, Message: rowErr.message}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Constraint {
+		case "products_sku_key":
+			return models.ImportError{Row: row, Field: "sku", Message: "sku sudah dipakai produk lain"}
+		case "products_barcode_key":
+			return models.ImportError{Row: row, Field: "barcode", Message: "barcode sudah dipakai produk lain"}
+		}
+		return models.ImportError{Row: row, Message: pqErr.Message}
+	}
+	return models.ImportError{Row: row, Message: err.Error()}
+}
+
+// importCategories finds categories by name, case-insensitively, creating
+// the missing ones. Categories created for a row that then fails are
+// discarded along with the row.
+type importCategories struct {
+	ids     map[string]int
+	pending []string
+}
+
+func loadImportCategories(tx *sql.Tx) (*importCategories, error) {
+	rows, err := tx.Query("SELECT id, name FROM categories ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := &importCategories{ids: make(map[string]int)}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		// The oldest category wins when names differ only in case
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := c.ids[key]; !ok {
+			c.ids[key] = id
+		}
+	}
+
+	return c, rows.Err()
+}
+
+func (c *importCategories) resolve(tx *sql.Tx, name string) (int, error) {
+	key := strings.ToLower(name)
+	if id, ok := c.ids[key]; ok {
+		return id, nil
+	}
+
+	category := models.Category{Name: name}
+	err := tx.QueryRow("INSERT INTO categories (name, description) VALUES ($1, '') RETURNING id", name).Scan(&category.ID)
+	if err != nil {
+		return 0, err
+	}
+	if err := insertOutbox(tx, models.EventCategoryCreated, category); err != nil {
+		return 0, err
+	}
+
+	c.ids[key] = category.ID
+	c.pending = append(c.pending, name)
+	return category.ID, nil
+}
+
+// keep returns the categories created for the row just imported.
+func (c *importCategories) keep() []string {
+	created := c.pending
+	c.pending = nil
+	return created
+}
+
+// discard forgets the categories created for a row that was rolled back.
+func (c *importCategories) discard() {
+	for _, name := range c.pending {
+		delete(c.ids, strings.ToLower(name))
+	}
+	c.pending = nil
+}
@@ -3,7 +3,10 @@ package repositories
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"kasir-api/models"
+	"strconv"
+	"strings"
 )
 
 type ProductRepository struct {
@@ -14,54 +17,243 @@ func NewProductRepository(db *sql.DB) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
-func (repo *ProductRepository) GetAll(nameFilter string) ([]models.Product, error) {
-	// JOIN with categories table to get category name
-	query := `SELECT p.id, p.name, p.price, p.stock, p.category_id, COALESCE(c.name, '') as category_name 
-	          FROM products p 
-	          LEFT JOIN categories c ON p.category_id = c.id`
+// productListFrom joins what a product listing shows at the store in $1.
+const productListFrom = ` FROM products p
+	LEFT JOIN categories c ON c.id = p.category_id
+	LEFT JOIN store_stock ss ON ss.product_id = p.id AND ss.store_id = $1
+	LEFT JOIN store_prices sp ON sp.product_id = p.id AND sp.store_id = $1
+	` + storeReserved
+
+// productListing is a product listing's query at a store: its filters, and
+// the price, stock and available stock there.
+type productListing struct {
+	price     string
+	stock     string
+	available string
+	where     []string
+	args      []interface{}
+}
+
+func (repo *ProductRepository) listing(query models.ProductQuery) (*productListing, error) {
+	store, err := resolveStore(repo.db, query.StoreID)
+	if err != nil {
+		return nil, err
+	}
 
-	args := []interface{}{}
-	if nameFilter != "" {
-		query += " WHERE p.name ILIKE $1"
-		args = append(args, "%"+nameFilter+"%")
+	l := &productListing{price: "COALESCE(sp.price, p.price)", stock: "COALESCE(ss.stock, 0)", args: []interface{}{store.ID}}
+	// The default store's stock lives in products.stock
+	if store.IsDefault {
+		l.stock = "p.stock"
 	}
+	l.available = "(" + l.stock + " - COALESCE(r.reserved, 0))"
 
-	query += " ORDER BY p.id"
+	if query.Name != "" {
+		l.where = append(l.where, "p.name ILIKE '%' || "+l.arg(query.Name)+" || '%'")
+	}
+	if query.CategoryID != 0 {
+		l.where = append(l.where, "p.category_id IN "+categorySubtree(l.arg(query.CategoryID)))
+	}
+	if query.MinPrice != nil {
+		l.where = append(l.where, l.price+" >= "+l.arg(*query.MinPrice))
+	}
+	if query.MaxPrice != nil {
+		l.where = append(l.where, l.price+" <= "+l.arg(*query.MaxPrice))
+	}
+	if query.InStock != nil {
+		if *query.InStock {
+			l.where = append(l.where, l.available+" > 0")
+		} else {
+			l.where = append(l.where, l.available+" <= 0")
+		}
+	}
 
-	rows, err := repo.db.Query(query, args...)
+	return l, nil
+}
+
+// arg adds a query argument and returns its placeholder.
+func (l *productListing) arg(v interface{}) string {
+	l.args = append(l.args, v)
+	return "$" + strconv.Itoa(len(l.args))
+}
+
+func (l *productListing) whereClause() string {
+	if len(l.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(l.where, " AND ")
+}
+
+func (l *productListing) sort(sort string) (listSort, error) {
+	return parseSort(sort, map[string]string{"name": "p.name", "price": l.price, "stock": l.stock})
+}
+
+func (l *productListing) columns() string {
+	return "p.id, p.name, " + l.price + ", " + l.stock + ", " + l.available + `,
+	        p.base_unit, p.sold_by_weight, COALESCE(p.sku, ''), COALESCE(p.barcode, ''), p.category_id, COALESCE(c.name, '')`
+}
+
+func (l *productListing) selectQuery() string {
+	return "SELECT " + l.columns() + productListFrom + l.whereClause()
+}
+
+func scanListedProduct(rows *sql.Rows, extra ...interface{}) (models.Product, error) {
+	var p models.Product
+	dest := []interface{}{&p.ID, &p.Name, &p.Price, &p.Stock, &p.Available, &p.BaseUnit, &p.SoldByWeight, &p.SKU, &p.Barcode, &p.CategoryID, &p.CategoryName}
+	err := rows.Scan(append(dest, extra...)...)
+	return p, err
+}
+
+// GetAll lists a page of the products matching the query, with the price and
+// stock at its store. Units are left out.
+func (repo *ProductRepository) GetAll(query models.ProductQuery) ([]models.Product, *models.PageInfo, error) {
+	l, err := repo.listing(query)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	sort, err := l.sort(query.Sort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &models.PageInfo{}
+	err = repo.db.QueryRow("SELECT COUNT(*)"+productListFrom+l.whereClause(), l.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if query.After != "" {
+		c, err := parseCursor(query.After, sort)
+		if err != nil {
+			return nil, nil, err
+		}
+		var key interface{}
+		cast := "text"
+		switch sort.field {
+		case "name":
+			key = c.Key
+		case "price":
+			cast = "bigint"
+			key, err = strconv.ParseInt(c.Key, 10, 64)
+		case "stock":
+			cast = "numeric"
+			key, err = models.ParseQuantity(c.Key)
+		}
+		if err != nil {
+			return nil, nil, errBadCursor
+		}
+		l.where = append(l.where, sort.after("p.id", c, key, cast, l.arg))
+	}
+
+	rows, err := repo.db.Query(l.selectQuery()+sort.orderBy("p.id")+pageLimit(query.ListQuery), l.args...)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	products := make([]models.Product, 0)
 	for rows.Next() {
-		var p models.Product
-		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID, &p.CategoryName)
+		p, err := scanListedProduct(rows)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		products = append(products, p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if query.Limit > 0 && len(products) > query.Limit {
+		products = products[:query.Limit]
+		last := products[len(products)-1]
+		c := listCursor{Sort: sort.field, ID: last.ID}
+		switch sort.field {
+		case "name":
+			c.Key = last.Name
+		case "price":
+			c.Key = strconv.FormatInt(int64(last.Price), 10)
+		case "stock":
+			c.Key = last.Stock.String()
+		}
+		page.NextCursor = c.String()
+	}
+
+	return products, page, nil
+}
+
+// Export passes every product matching the query's filters to fn, in its
+// order, as the rows come from the database; large exports are never held
+// in memory. Paging is ignored and units are left out.
+func (repo *ProductRepository) Export(query models.ProductQuery, fn func(models.Product) error) error {
+	l, err := repo.listing(query)
+	if err != nil {
+		return err
+	}
+	sort, err := l.sort(query.Sort)
+	if err != nil {
+		return err
+	}
+
+	rows, err := repo.db.Query(l.selectQuery()+sort.orderBy("p.id"), l.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	return products, nil
+	for rows.Next() {
+		p, err := scanListedProduct(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
 }
 
 func (repo *ProductRepository) Create(product *models.Product) error {
-	query := "INSERT INTO products (name, price, stock, category_id) VALUES ($1, $2, $3, $4) RETURNING id"
-	err := repo.db.QueryRow(query, product.Name, product.Price, product.Stock, product.CategoryID).Scan(&product.ID)
-	return err
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertProduct(tx, product); err != nil {
+		return err
+	}
+
+	if err := insertProductEvent(tx, models.EventProductCreated, product.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (repo *ProductRepository) GetByID(id int) (*models.Product, error) {
+	return getProduct(repo.db, id)
+}
+
+// insertProductEvent queues a product event carrying the product as the
+// transaction left it.
+func insertProductEvent(tx *sql.Tx, eventType string, id int) error {
+	product, err := getProduct(tx, id)
+	if err != nil {
+		return err
+	}
+	return insertOutbox(tx, eventType, product)
+}
+
+func getProduct(q queryer, id int) (*models.Product, error) {
 	// JOIN with categories to include category info
-	query := `SELECT p.id, p.name, p.price, p.stock, p.category_id, COALESCE(c.name, '') as category_name 
+	query := `SELECT p.id, p.name, p.price, p.stock, p.stock - COALESCE(r.reserved, 0), p.base_unit, p.sold_by_weight, COALESCE(p.sku, ''), COALESCE(p.barcode, ''), p.category_id, COALESCE(c.name, '') as category_name 
 	          FROM products p 
 	          LEFT JOIN categories c ON p.category_id = c.id 
+	          ` + defaultStoreReserved + `
 	          WHERE p.id = $1`
 
 	var p models.Product
-	err := repo.db.QueryRow(query, id).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.CategoryID, &p.CategoryName)
+	err := q.QueryRow(query, id).Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.Available, &p.BaseUnit, &p.SoldByWeight, &p.SKU, &p.Barcode, &p.CategoryID, &p.CategoryName)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("produk tidak ditemukan")
 	}
@@ -69,12 +261,75 @@ func (repo *ProductRepository) GetByID(id int) (*models.Product, error) {
 		return nil, err
 	}
 
+	p.Units, err = getUnits(q, p.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &p, nil
 }
 
+func (repo *ProductRepository) GetByBarcode(barcode string) (*models.Product, error) {
+	var id int
+	err := repo.db.QueryRow("SELECT id FROM products WHERE barcode = $1", barcode).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("produk dengan barcode tersebut tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
 func (repo *ProductRepository) Update(product *models.Product) error {
-	query := "UPDATE products SET name = $1, price = $2, stock = $3, category_id = $4 WHERE id = $5"
-	result, err := repo.db.Exec(query, product.Name, product.Price, product.Stock, product.CategoryID, product.ID)
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stock models.Quantity
+	err = tx.QueryRow("SELECT stock FROM products WHERE id = $1 FOR UPDATE", product.ID).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return errors.New("produk tidak ditemukan")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := updateProduct(tx, product); err != nil {
+		return err
+	}
+
+	if err := insertProductEvent(tx, models.EventProductUpdated, product.ID); err != nil {
+		return err
+	}
+
+	// The product's stock is the default store's stock
+	if product.Stock != stock {
+		store, err := resolveStore(tx, 0)
+		if err != nil {
+			return err
+		}
+		if _, err := insertStockChanged(tx, store, []int{product.ID}); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertProduct(tx *sql.Tx, product *models.Product) error {
+	query := `INSERT INTO products (name, price, stock, base_unit, sold_by_weight, sku, barcode, category_id)
+	          VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8) RETURNING id`
+	return tx.QueryRow(query, product.Name, product.Price, product.Stock, product.BaseUnit, product.SoldByWeight, product.SKU, product.Barcode, product.CategoryID).Scan(&product.ID)
+}
+
+func updateProduct(tx *sql.Tx, product *models.Product) error {
+	query := `UPDATE products SET name = $1, price = $2, stock = $3, base_unit = $4, sold_by_weight = $5, sku = NULLIF($6, ''), barcode = NULLIF($7, ''), category_id = $8
+	          WHERE id = $9`
+	result, err := tx.Exec(query, product.Name, product.Price, product.Stock, product.BaseUnit, product.SoldByWeight, product.SKU, product.Barcode, product.CategoryID, product.ID)
 	if err != nil {
 		return err
 	}
@@ -92,8 +347,14 @@ func (repo *ProductRepository) Update(product *models.Product) error {
 }
 
 func (repo *ProductRepository) Delete(id int) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := "DELETE FROM products WHERE id = $1"
-	result, err := repo.db.Exec(query, id)
+	result, err := tx.Exec(query, id)
 	if err != nil {
 		return err
 	}
@@ -106,5 +367,128 @@ func (repo *ProductRepository) Delete(id int) error {
 		return errors.New("produk tidak ditemukan")
 	}
 
-	return nil
+	if err := insertOutbox(tx, models.EventProductDeleted, map[string]int{"id": id}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo *ProductRepository) GetUnits(productID int) ([]models.ProductUnit, error) {
+	return getUnits(repo.db, productID)
+}
+
+func getUnits(q queryer, productID int) ([]models.ProductUnit, error) {
+	query := "SELECT id, product_id, name, conversion_factor, price FROM product_units WHERE product_id = $1 ORDER BY conversion_factor, id"
+	rows, err := q.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := make([]models.ProductUnit, 0)
+	for rows.Next() {
+		var u models.ProductUnit
+		err := rows.Scan(&u.ID, &u.ProductID, &u.Name, &u.ConversionFactor, &u.Price)
+		if err != nil {
+			return nil, err
+		}
+		units = append(units, u)
+	}
+
+	return units, rows.Err()
+}
+
+func (repo *ProductRepository) CreateUnit(unit *models.ProductUnit) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO product_units (product_id, name, conversion_factor, price) VALUES ($1, $2, $3, $4) RETURNING id"
+	err = tx.QueryRow(query, unit.ProductID, unit.Name, unit.ConversionFactor, unit.Price).Scan(&unit.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertProductEvent(tx, models.EventProductUpdated, unit.ProductID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo *ProductRepository) DeleteUnit(productID, unitID int) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM product_units WHERE id = $1 AND product_id = $2"
+	result, err := tx.Exec(query, unitID, productID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errors.New("satuan tidak ditemukan")
+	}
+
+	if err := insertProductEvent(tx, models.EventProductUpdated, productID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReceiveStock adds received goods to a product's stock, converting the
+// received quantity into the product's base unit.
+func (repo *ProductRepository) ReceiveStock(productID int, receipt models.StockReceipt) (*models.Product, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	unit, err := findUnit(tx, productID, receipt.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	baseQuantity, err := receipt.Quantity.Mul(unit.ConversionFactor)
+	if err != nil {
+		return nil, fmt.Errorf("product %d: %w", productID, err)
+	}
+	_, err = tx.Exec("UPDATE products SET stock = stock + $1 WHERE id = $2", baseQuantity, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createBatch(tx, productID, baseQuantity, receipt.BatchCode, receipt.ExpiryDate); err != nil {
+		return nil, err
+	}
+
+	if err := insertProductEvent(tx, models.EventProductUpdated, productID); err != nil {
+		return nil, err
+	}
+	// Received stock goes to the default store
+	store, err := resolveStore(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := insertStockChanged(tx, store, []int{productID}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(productID)
 }
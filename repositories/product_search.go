@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+
+	"kasir-api/models"
+)
+
+// productSearchDocument is the full-text document of a product, weighting
+// the name above the codes. It must stay the expression of the
+// idx_products_search index, or searches cannot use the index.
+const productSearchDocument = `(setweight(to_tsvector('simple', p.name), 'A') ||
+	setweight(to_tsvector('simple', COALESCE(p.sku, '') || ' ' || COALESCE(p.barcode, '')), 'B'))`
+
+// Search finds the products matching the search terms, best match first,
+// among those matching the query's filters. A product matches when every
+// term starts a word of its name, SKU or barcode, or every term one of its
+// category; when text is close to a word of its name (typos), or only
+// contained in it where pg_trgm is not installed; or when text is its exact
+// SKU or barcode. Offset paging only: ranked results have no stable cursor.
+func (repo *ProductRepository) Search(query models.ProductQuery, terms []string, text string) ([]models.ProductSearchResult, *models.PageInfo, error) {
+	if query.After != "" {
+		return nil, nil, errors.New("after tidak valid untuk pencarian, gunakan offset")
+	}
+	l, err := repo.listing(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = "'" + strings.ReplaceAll(term, "'", "''") + "':*"
+	}
+	tsquery := "to_tsquery('simple', " + l.arg(strings.Join(prefixes, " & ")) + ")"
+	raw := l.arg(text)
+
+	trigram, err := repo.hasTrigram()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Without pg_trgm there is no typo matching: the name only has to
+	// contain text, and does not add to the score
+	nameMatch := "p.name ILIKE '%' || " + raw + " || '%'"
+	nameScore := ""
+	if trigram {
+		nameMatch = raw + " <% p.name"
+		nameScore = " + word_similarity(" + raw + ", p.name)"
+	}
+
+	// Every branch only refers to products, so each can use its own index
+	// (idx_products_search, idx_products_category_id, idx_products_name_trgm,
+	// products_sku_key, products_barcode_key) and the planner ORs the bitmaps.
+	// The matching categories are an array computed once, not a join.
+	l.where = append(l.where, "("+productSearchDocument+" @@ "+tsquery+
+		" OR p.category_id = ANY(ARRAY(SELECT id FROM categories WHERE to_tsvector('simple', name) @@ "+tsquery+"))"+
+		" OR "+nameMatch+" OR p.sku = "+raw+" OR p.barcode = "+raw+")")
+	score := "ts_rank(" + productSearchDocument + ", " + tsquery + ")" + nameScore +
+		" + CASE WHEN p.sku = " + raw + " OR p.barcode = " + raw + " THEN 1 ELSE 0 END"
+
+	page := &models.PageInfo{}
+	err = repo.db.QueryRow("SELECT COUNT(*)"+productListFrom+l.whereClause(), l.args...).Scan(&page.Total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := repo.db.Query("SELECT "+l.columns()+", "+score+" AS score"+productListFrom+l.whereClause()+
+		" ORDER BY score DESC, p.name, p.id"+pageLimit(query.ListQuery), l.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	results := make([]models.ProductSearchResult, 0)
+	for rows.Next() {
+		var r models.ProductSearchResult
+		r.Product, err = scanListedProduct(rows, &r.Score)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, page, nil
+}
+
+// hasTrigram reports whether pg_trgm is installed. The migrations go on
+// without it when the app may not create extensions, and it can be enabled
+// later without a restart.
+func (repo *ProductRepository) hasTrigram() (bool, error) {
+	var installed bool
+	err := repo.db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&installed)
+	return installed, err
+}
@@ -0,0 +1,361 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+// DefaultReservationTTL applies to reservations made without a TTL.
+const DefaultReservationTTL = 15 * time.Minute
+
+// defaultStoreReserved sums the active reservations of the default store per
+// product, to be joined on products as r.
+const defaultStoreReserved = `LEFT JOIN (SELECT product_id, SUM(quantity) AS reserved
+	                     FROM stock_reservations
+	                     WHERE store_id = (SELECT id FROM stores WHERE is_default) AND expires_at > CURRENT_TIMESTAMP
+	                     GROUP BY product_id) r ON r.product_id = p.id`
+
+// storeReserved is defaultStoreReserved for the store given as $1.
+const storeReserved = `LEFT JOIN (SELECT product_id, SUM(quantity) AS reserved
+	               FROM stock_reservations
+	               WHERE store_id = $1 AND expires_at > CURRENT_TIMESTAMP
+	               GROUP BY product_id) r ON r.product_id = p.id`
+
+type ReservationRepository struct {
+	db *sql.DB
+}
+
+func NewReservationRepository(db *sql.DB) *ReservationRepository {
+	return &ReservationRepository{db: db}
+}
+
+const reservationColumns = `r.id, r.store_id, r.product_id, p.name, r.quantity, r.cart_id, r.transaction_id, r.reference,
+	to_char(r.created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'), to_char(r.expires_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`
+
+func scanReservation(row interface{ Scan(...interface{}) error }) (*models.StockReservation, error) {
+	var res models.StockReservation
+	var cartID, transactionID sql.NullInt64
+	err := row.Scan(&res.ID, &res.StoreID, &res.ProductID, &res.ProductName, &res.Quantity, &cartID, &transactionID,
+		&res.Reference, &res.CreatedAt, &res.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if cartID.Valid {
+		id := int(cartID.Int64)
+		res.CartID = &id
+	}
+	if transactionID.Valid {
+		id := int(transactionID.Int64)
+		res.TransactionID = &id
+	}
+	return &res, nil
+}
+
+// GetAll lists active reservations of a store (all stores when storeID is 0),
+// optionally for one product.
+func (repo *ReservationRepository) GetAll(storeID, productID int) ([]models.StockReservation, error) {
+	if err := releaseExpiredReservations(repo.db); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + reservationColumns + ` FROM stock_reservations r
+	          JOIN products p ON p.id = r.product_id
+	          WHERE ($1::bigint = 0 OR r.store_id = $1) AND ($2::bigint = 0 OR r.product_id = $2)
+	          ORDER BY r.expires_at, r.id`
+	rows, err := repo.db.Query(query, storeID, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := make([]models.StockReservation, 0)
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, *res)
+	}
+
+	return reservations, rows.Err()
+}
+
+func (repo *ReservationRepository) GetByID(id int) (*models.StockReservation, error) {
+	query := "SELECT " + reservationColumns + ` FROM stock_reservations r
+	          JOIN products p ON p.id = r.product_id
+	          WHERE r.id = $1 AND r.expires_at > CURRENT_TIMESTAMP`
+	res, err := scanReservation(repo.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("reservasi tidak ditemukan")
+	}
+	return res, err
+}
+
+// Create reserves stock of a product at a store for ttl, failing when less
+// than the requested quantity is available.
+func (repo *ReservationRepository) Create(res *models.StockReservation, ttl time.Duration) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	store, err := resolveStore(tx, res.StoreID)
+	if err != nil {
+		return err
+	}
+
+	unit, err := findUnit(tx, res.ProductID, res.Unit)
+	if err != nil {
+		return err
+	}
+	baseQuantity, err := res.Quantity.Mul(unit.ConversionFactor)
+	if err != nil {
+		return fmt.Errorf("product %d: %w", res.ProductID, err)
+	}
+
+	ids := []int{res.ProductID}
+	products, err := loadCheckoutProducts(tx, store, ids, true)
+	if err != nil {
+		return err
+	}
+	product, ok := products[res.ProductID]
+	if !ok {
+		return fmt.Errorf("product id %d not found", res.ProductID)
+	}
+	if err := checkWholeQuantity(product, res.ProductID, baseQuantity); err != nil {
+		return err
+	}
+
+	available, err := availableStock(tx, store, products, ids)
+	if err != nil {
+		return err
+	}
+	if available[res.ProductID] < baseQuantity {
+		return fmt.Errorf("stock not enough for product %d (available %s)", res.ProductID, available[res.ProductID])
+	}
+
+	err = tx.QueryRow(`INSERT INTO stock_reservations (store_id, product_id, quantity, reference, expires_at)
+	                   VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second') RETURNING id`,
+		store.ID, res.ProductID, baseQuantity, res.Reference, int64(ttl/time.Second)).Scan(&res.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	created, err := repo.GetByID(res.ID)
+	if err != nil {
+		return err
+	}
+	*res = *created
+	return nil
+}
+
+// Release cancels a reservation so its stock is available again. Reservations
+// of carts and of sales awaiting payment follow their owner and cannot be
+// released on their own.
+func (repo *ReservationRepository) Release(id int) error {
+	result, err := repo.db.Exec("DELETE FROM stock_reservations WHERE id = $1 AND cart_id IS NULL AND transaction_id IS NULL", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errors.New("reservasi tidak ditemukan atau milik keranjang/transaksi")
+	}
+
+	return nil
+}
+
+// releaseExpiredReservations deletes reservations past their expiry. Expired
+// reservations are already ignored everywhere; this only keeps the table small.
+func releaseExpiredReservations(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM stock_reservations WHERE expires_at <= CURRENT_TIMESTAMP")
+	return err
+}
+
+// reservedStock sums the active reservations of the given products at a store.
+func reservedStock(q queryer, storeID int, productIDs []int) (map[int]models.Quantity, error) {
+	rows, err := q.Query(`SELECT product_id, SUM(quantity) FROM stock_reservations
+	                      WHERE store_id = $1 AND product_id = ANY($2) AND expires_at > CURRENT_TIMESTAMP
+	                      GROUP BY product_id`, storeID, pq.Array(sortedProductIDs(productIDs)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reserved := make(map[int]models.Quantity, len(productIDs))
+	for rows.Next() {
+		var id int
+		var qty models.Quantity
+		if err := rows.Scan(&id, &qty); err != nil {
+			return nil, err
+		}
+		reserved[id] = qty
+	}
+
+	return reserved, rows.Err()
+}
+
+// availableStock returns the stock of the products at a store that is not
+// reserved. The products must have been loaded with loadCheckoutProducts
+// holding their row locks, which serializes reservations against checkouts.
+func availableStock(tx *sql.Tx, store *models.Store, products map[int]*checkoutProduct, productIDs []int) (map[int]models.Quantity, error) {
+	stock := make(map[int]models.Quantity, len(products))
+	for id, p := range products {
+		stock[id] = p.stock
+	}
+	if !store.IsDefault {
+		var err error
+		stock, err = lockStock(tx, store, productIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reserved, err := reservedStock(tx, store.ID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, qty := range reserved {
+		stock[id] -= qty
+	}
+
+	return stock, nil
+}
+
+// consumeReservations deletes the reservations a checkout turns into stock
+// decrements, so they no longer count against available stock.
+func consumeReservations(tx *sql.Tx, storeID, cartID int, reservationIDs []int64) error {
+	if cartID != 0 {
+		if _, err := tx.Exec("DELETE FROM stock_reservations WHERE cart_id = $1", cartID); err != nil {
+			return err
+		}
+	}
+	if len(reservationIDs) == 0 {
+		return nil
+	}
+
+	result, err := tx.Exec(`DELETE FROM stock_reservations
+	                        WHERE id = ANY($1) AND store_id = $2 AND cart_id IS NULL AND transaction_id IS NULL
+	                          AND expires_at > CURRENT_TIMESTAMP`,
+		pq.Array(reservationIDs), storeID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != int64(len(reservationIDs)) {
+		return errors.New("reservation not found, expired or made at another store")
+	}
+	return nil
+}
+
+// syncCartReservations makes a cart's reservations match its lines and expiry.
+// Stock must be available for any product the cart now holds more of.
+func syncCartReservations(tx *sql.Tx, cartID int) error {
+	var storeID int
+	err := tx.QueryRow("SELECT store_id FROM carts WHERE id = $1", cartID).Scan(&storeID)
+	if err != nil {
+		return err
+	}
+	store, err := resolveStore(tx, storeID)
+	if err != nil {
+		return err
+	}
+
+	lines, err := loadCartItems(tx, []int64{int64(cartID)})
+	if err != nil {
+		return err
+	}
+	productIDs := make([]int, 0, len(lines[cartID]))
+	for _, item := range lines[cartID] {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	needs := make(map[int]models.Quantity)
+	if len(productIDs) > 0 {
+		products, err := loadCheckoutProducts(tx, store, productIDs, true)
+		if err != nil {
+			return err
+		}
+		for _, item := range lines[cartID] {
+			product, ok := products[item.ProductID]
+			if !ok {
+				return fmt.Errorf("product id %d not found", item.ProductID)
+			}
+			unit, err := product.unit(item.Unit)
+			if err != nil {
+				return err
+			}
+			baseQuantity, err := item.Quantity.Mul(unit.ConversionFactor)
+			if err != nil {
+				return fmt.Errorf("product %d: %w", item.ProductID, err)
+			}
+			needs[item.ProductID] += baseQuantity
+		}
+
+		held := make(map[int]models.Quantity)
+		rows, err := tx.Query(`SELECT product_id, SUM(quantity) FROM stock_reservations
+		                       WHERE cart_id = $1 AND expires_at > CURRENT_TIMESTAMP GROUP BY product_id`, cartID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			var qty models.Quantity
+			if err := rows.Scan(&id, &qty); err != nil {
+				rows.Close()
+				return err
+			}
+			held[id] = qty
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		available, err := availableStock(tx, store, products, productIDs)
+		if err != nil {
+			return err
+		}
+		for id, qty := range needs {
+			if qty > held[id] && available[id]+held[id] < qty {
+				return fmt.Errorf("stock not enough for product %d (available %s)", id, available[id]+held[id])
+			}
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM stock_reservations WHERE cart_id = $1", cartID); err != nil {
+		return err
+	}
+	if len(needs) == 0 {
+		return nil
+	}
+
+	ids := sortedProductIDs(productIDs)
+	quantities := make([]string, len(ids))
+	for i, id := range ids {
+		quantities[i] = needs[int(id)].String()
+	}
+	_, err = tx.Exec(`INSERT INTO stock_reservations (store_id, product_id, quantity, cart_id, reference, expires_at)
+	                  SELECT c.store_id, v.product_id, v.quantity, c.id, 'cart ' || c.id, c.expires_at
+	                  FROM carts c, unnest($2::bigint[], $3::numeric[]) AS v(product_id, quantity)
+	                  WHERE c.id = $1`, cartID, pq.Array(ids), pq.Array(quantities))
+	return err
+}
@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"kasir-api/models"
+)
+
+type StoreRepository struct {
+	db *sql.DB
+}
+
+func NewStoreRepository(db *sql.DB) *StoreRepository {
+	return &StoreRepository{db: db}
+}
+
+const storeColumns = "id, code, name, address, npwp, is_default"
+
+func (repo *StoreRepository) GetAll() ([]models.Store, error) {
+	rows, err := repo.db.Query("SELECT " + storeColumns + " FROM stores ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stores := make([]models.Store, 0)
+	for rows.Next() {
+		var s models.Store
+		err := rows.Scan(&s.ID, &s.Code, &s.Name, &s.Address, &s.NPWP, &s.IsDefault)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, s)
+	}
+
+	return stores, rows.Err()
+}
+
+// GetByID returns a store; id 0 means the default store.
+func (repo *StoreRepository) GetByID(id int) (*models.Store, error) {
+	return resolveStore(repo.db, id)
+}
+
+func (repo *StoreRepository) Create(store *models.Store) error {
+	query := "INSERT INTO stores (code, name, address, npwp) VALUES ($1, $2, $3, $4) RETURNING id"
+	return repo.db.QueryRow(query, store.Code, store.Name, store.Address, store.NPWP).Scan(&store.ID)
+}
+
+func (repo *StoreRepository) Update(store *models.Store) error {
+	query := "UPDATE stores SET code = $1, name = $2, address = $3, npwp = $4 WHERE id = $5 RETURNING is_default"
+	err := repo.db.QueryRow(query, store.Code, store.Name, store.Address, store.NPWP, store.ID).Scan(&store.IsDefault)
+	if err == sql.ErrNoRows {
+		return errors.New("toko tidak ditemukan")
+	}
+	return err
+}
+
+func (repo *StoreRepository) Delete(id int) error {
+	result, err := repo.db.Exec("DELETE FROM stores WHERE id = $1 AND NOT is_default", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errors.New("toko tidak ditemukan atau merupakan toko utama")
+	}
+
+	return nil
+}
+
+// GetStock lists every product with its stock and effective price at a store.
+func (repo *StoreRepository) GetStock(storeID int) ([]models.StoreProduct, error) {
+	store, err := resolveStore(repo.db, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	stockExpr := "COALESCE(ss.stock, 0)"
+	if store.IsDefault {
+		stockExpr = "p.stock"
+	}
+
+	query := `SELECT p.id, p.name, ` + stockExpr + `, ` + stockExpr + ` - COALESCE(r.reserved, 0), p.price, sp.price
+	          FROM products p
+	          LEFT JOIN store_stock ss ON ss.product_id = p.id AND ss.store_id = $1
+	          LEFT JOIN store_prices sp ON sp.product_id = p.id AND sp.store_id = $1
+	          ` + storeReserved + `
+	          ORDER BY p.id`
+	rows, err := repo.db.Query(query, store.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := make([]models.StoreProduct, 0)
+	for rows.Next() {
+		sp := models.StoreProduct{StoreID: store.ID}
+		var override sql.NullInt64
+		err := rows.Scan(&sp.ProductID, &sp.ProductName, &sp.Stock, &sp.Available, &sp.Price, &override)
+		if err != nil {
+			return nil, err
+		}
+		if override.Valid {
+			price := models.Money(override.Int64)
+			sp.PriceOverride = &price
+			sp.Price = price
+		}
+		products = append(products, sp)
+	}
+
+	return products, rows.Err()
+}
+
+// SetPrice sets or, when price is nil, removes a per-store price override.
+func (repo *StoreRepository) SetPrice(storeID int, price models.StorePrice) error {
+	if price.Price == nil {
+		_, err := repo.db.Exec("DELETE FROM store_prices WHERE store_id = $1 AND product_id = $2", storeID, price.ProductID)
+		return err
+	}
+
+	_, err := repo.db.Exec(`INSERT INTO store_prices (store_id, product_id, price) VALUES ($1, $2, $3)
+	                        ON CONFLICT (store_id, product_id) DO UPDATE SET price = EXCLUDED.price`,
+		storeID, price.ProductID, *price.Price)
+	return err
+}
+
+// ReceiveStock adds stock received directly at a store. For the default store
+// this is the same as receiving into products.stock (and creates a batch).
+func (repo *StoreRepository) ReceiveStock(storeID int, receipt models.StoreStockReceipt) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	store, err := resolveStore(tx, storeID)
+	if err != nil {
+		return err
+	}
+
+	unit, err := findUnit(tx, receipt.ProductID, receipt.Unit)
+	if err != nil {
+		return err
+	}
+	baseQuantity, err := receipt.Quantity.Mul(unit.ConversionFactor)
+	if err != nil {
+		return fmt.Errorf("product %d: %w", receipt.ProductID, err)
+	}
+
+	if err := adjustStoreStock(tx, store, receipt.ProductID, baseQuantity); err != nil {
+		return err
+	}
+	if store.IsDefault {
+		if err := createBatch(tx, receipt.ProductID, baseQuantity, receipt.BatchCode, receipt.ExpiryDate); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// resolveStore loads a store by id; id 0 selects the default store.
+func resolveStore(q queryRower, storeID int) (*models.Store, error) {
+	query := "SELECT " + storeColumns + " FROM stores WHERE id = $1"
+	args := []interface{}{storeID}
+	if storeID == 0 {
+		query = "SELECT " + storeColumns + " FROM stores WHERE is_default"
+		args = nil
+	}
+
+	var s models.Store
+	err := q.QueryRow(query, args...).Scan(&s.ID, &s.Code, &s.Name, &s.Address, &s.NPWP, &s.IsDefault)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("toko tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// adjustStoreStock adds delta to a product's stock at a store; stock is taken
+// out with decrementStock. The default store's stock lives in products.stock.
+func adjustStoreStock(tx *sql.Tx, store *models.Store, productID int, delta models.Quantity) error {
+	if store.IsDefault {
+		_, err := tx.Exec("UPDATE products SET stock = stock + $1 WHERE id = $2", delta, productID)
+		return err
+	}
+
+	_, err := tx.Exec(`INSERT INTO store_stock (store_id, product_id, stock) VALUES ($1, $2, $3)
+	                   ON CONFLICT (store_id, product_id) DO UPDATE SET stock = store_stock.stock + EXCLUDED.stock`,
+		store.ID, productID, delta)
+	if err != nil {
+		return fmt.Errorf("update stock toko %s: %w", store.Code, err)
+	}
+	return nil
+}
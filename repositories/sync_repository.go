@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"database/sql"
+	"strconv"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+type SyncRepository struct {
+	db *sql.DB
+}
+
+func NewSyncRepository(db *sql.DB) *SyncRepository {
+	return &SyncRepository{db: db}
+}
+
+// Catalog returns the catalog of a store changed after version since, or all
+// of it when since is 0 or not a version this database handed out.
+func (repo *SyncRepository) Catalog(storeID int, since int64) (*models.CatalogSync, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	store, err := resolveStore(tx, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Waits for catalog changes still committing; every version up to the
+	// token is then visible to the queries below
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock_shared(hashtext('catalog_sync_version'))"); err != nil {
+		return nil, err
+	}
+	var token int64
+	err = tx.QueryRow("SELECT CASE WHEN is_called THEN last_value ELSE 0 END FROM catalog_version_seq").Scan(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	full := since <= 0 || since > token
+	catalog := &models.CatalogSync{
+		Token: strconv.FormatInt(token, 10),
+		Full:  full,
+		Deleted: models.CatalogDeletions{
+			Categories: make([]int, 0),
+			Products:   make([]int, 0),
+		},
+	}
+
+	catalog.Categories, err = syncCategories(tx, full, since)
+	if err != nil {
+		return nil, err
+	}
+	catalog.Products, err = syncProducts(tx, store, full, since)
+	if err != nil {
+		return nil, err
+	}
+	if full {
+		return catalog, nil
+	}
+
+	rows, err := tx.Query("SELECT entity, entity_id FROM catalog_tombstones WHERE sync_version > $1 ORDER BY id", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entity string
+		var id int
+		if err := rows.Scan(&entity, &id); err != nil {
+			return nil, err
+		}
+		switch entity {
+		case "categories":
+			catalog.Deleted.Categories = append(catalog.Deleted.Categories, id)
+		case "products":
+			catalog.Deleted.Products = append(catalog.Deleted.Products, id)
+		}
+	}
+
+	return catalog, rows.Err()
+}
+
+func syncCategories(tx *sql.Tx, full bool, since int64) ([]models.Category, error) {
+	rows, err := tx.Query("SELECT id, name, description, parent_id FROM categories WHERE $1 OR sync_version > $2 ORDER BY id", full, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make([]models.Category, 0)
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.ParentID); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rows.Err()
+}
+
+// syncProducts loads the changed products with the store's prices and stock
+// and all their units.
+func syncProducts(tx *sql.Tx, store *models.Store, full bool, since int64) ([]models.Product, error) {
+	rows, err := tx.Query(`SELECT p.id, p.name, COALESCE(sp.price, p.price),
+	                              CASE WHEN $4 THEN p.stock ELSE COALESCE(ss.stock, 0) END, COALESCE(r.reserved, 0),
+	                              p.base_unit, p.sold_by_weight, COALESCE(p.sku, ''), COALESCE(p.barcode, ''), p.category_id, COALESCE(c.name, '')
+	                       FROM products p
+	                       LEFT JOIN categories c ON c.id = p.category_id
+	                       LEFT JOIN store_stock ss ON ss.product_id = p.id AND ss.store_id = $1
+	                       LEFT JOIN store_prices sp ON sp.product_id = p.id AND sp.store_id = $1
+	                       `+storeReserved+`
+	                       WHERE $2 OR p.sync_version > $3
+	                       ORDER BY p.id`, store.ID, full, since, store.IsDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]models.Product, 0)
+	index := make(map[int]int)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var p models.Product
+		var reserved models.Quantity
+		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &reserved, &p.BaseUnit, &p.SoldByWeight, &p.SKU, &p.Barcode, &p.CategoryID, &p.CategoryName)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.Available = p.Stock - reserved
+		p.Units = make([]models.ProductUnit, 0)
+		index[p.ID] = len(products)
+		products = append(products, p)
+		ids = append(ids, int64(p.ID))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return products, nil
+	}
+
+	rows, err = tx.Query(`SELECT id, product_id, name, conversion_factor, price FROM product_units
+	                      WHERE product_id = ANY($1) ORDER BY product_id, conversion_factor, id`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u models.ProductUnit
+		if err := rows.Scan(&u.ID, &u.ProductID, &u.Name, &u.ConversionFactor, &u.Price); err != nil {
+			return nil, err
+		}
+		p := &products[index[u.ProductID]]
+		p.Units = append(p.Units, u)
+	}
+
+	return products, rows.Err()
+}
@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"testing"
+
+	"kasir-api/models"
+)
+
+// benchmarkCreateTransaction measures a checkout of lines distinct products
+// against the database in TEST_DB_CONN. The statement count of a checkout
+// does not grow with the basket, so time per line should fall as lines grow.
+func benchmarkCreateTransaction(b *testing.B, lines int) {
+	db := testDB(b)
+	repo := newTestTransactionRepository(db)
+	ids := createTestProducts(b, db, lines, 1_000_000_000)
+
+	items := make([]models.CheckoutItem, lines)
+	for i, id := range ids {
+		items[i] = models.CheckoutItem{ProductID: id, Quantity: models.NewQuantity(1)}
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := repo.CreateTransaction(models.CheckoutRequest{Items: items}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateTransaction10Lines(b *testing.B)  { benchmarkCreateTransaction(b, 10) }
+func BenchmarkCreateTransaction40Lines(b *testing.B)  { benchmarkCreateTransaction(b, 40) }
+func BenchmarkCreateTransaction100Lines(b *testing.B) { benchmarkCreateTransaction(b, 100) }
@@ -2,119 +2,935 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"kasir-api/invoice"
 	"kasir-api/models"
+
+	"github.com/lib/pq"
 )
 
+// ErrIdempotencyConflict is returned when an Idempotency-Key is reused with a
+// different checkout payload.
+var ErrIdempotencyConflict = errors.New("Idempotency-Key sudah dipakai untuk checkout dengan isi berbeda")
+
+// ErrAlreadyPaid is returned when cancelling a sale whose payment arrived.
+var ErrAlreadyPaid = errors.New("transaksi sudah dibayar")
+
+// CheckoutError is a checkout its own data makes impossible, such as an
+// unknown product or unit; unlike a database failure, retrying it unchanged
+// fails the same way.
+type CheckoutError struct {
+	Message string
+}
+
+func (e *CheckoutError) Error() string {
+	return e.Message
+}
+
+func checkoutErrorf(format string, args ...interface{}) error {
+	return &CheckoutError{Message: fmt.Sprintf(format, args...)}
+}
+
+// StockConflictError is a sale of more than the available stock of a product.
+// Expired is the part of the stock in expired batches, which cannot be sold
+// until it is written off.
+type StockConflictError struct {
+	ProductID int
+	Requested models.Quantity
+	Available models.Quantity
+	Expired   models.Quantity
+}
+
+func (e *StockConflictError) Error() string {
+	if e.Expired > 0 {
+		return fmt.Sprintf("stock not enough for product %d (expired batches must be written off)", e.ProductID)
+	}
+	return fmt.Sprintf("stock not enough for product %d", e.ProductID)
+}
+
+// PriceMismatchError is a sale whose total, at current prices, differs from
+// the total the client expected.
+type PriceMismatchError struct {
+	Expected models.Money
+	Actual   models.Money
+}
+
+func (e *PriceMismatchError) Error() string {
+	return fmt.Sprintf("total at current prices is %d, expected %d", e.Actual, e.Expected)
+}
+
 type TransactionRepository struct {
-	db *sql.DB
+	db            *sql.DB
+	invoiceFormat invoice.Format
+	lowStock      models.Quantity
 }
 
-func NewTransactionRepository(db *sql.DB) *TransactionRepository {
-	return &TransactionRepository{db: db}
+// NewTransactionRepository creates the repository; a sale taking a product's
+// stock to lowStock or below queues stock.low (never when lowStock is 0).
+func NewTransactionRepository(db *sql.DB, invoiceFormat invoice.Format, lowStock models.Quantity) *TransactionRepository {
+	return &TransactionRepository{db: db, invoiceFormat: invoiceFormat, lowStock: lowStock}
 }
 
-func (repo *TransactionRepository) CreateTransaction(items []models.CheckoutItem) (*models.Transaction, error) {
-	if len(items) == 0 {
-		return nil, fmt.Errorf("items cannot be empty")
+// CreateTransaction records a sale and takes its items out of stock. The
+// whole checkout is retried when Postgres aborts it with a serialization
+// failure or deadlock.
+func (repo *TransactionRepository) CreateTransaction(req models.CheckoutRequest) (*models.Transaction, error) {
+	if len(req.Items) == 0 && req.CartID == 0 {
+		return nil, checkoutErrorf("items cannot be empty")
 	}
 
+	var transaction *models.Transaction
+	err := retryOnConflict("checkout", func() error {
+		var err error
+		transaction, err = repo.createTransaction(req)
+		return err
+	})
+	return transaction, err
+}
+
+func (repo *TransactionRepository) createTransaction(req models.CheckoutRequest) (*models.Transaction, error) {
+	items := req.Items
+
 	tx, err := repo.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	totalAmount := 0
-	details := make([]models.TransactionDetail, 0)
+	if req.IdempotencyKey != "" {
+		// Serialize requests sharing a key so a concurrent retry waits for
+		// the first attempt instead of racing it
+		_, err = tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", req.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+
+		var existingID int
+		var existingHash string
+		err = tx.QueryRow("SELECT id, request_hash FROM transactions WHERE idempotency_key = $1", req.IdempotencyKey).
+			Scan(&existingID, &existingHash)
+		if err == nil {
+			if existingHash != req.RequestHash {
+				return nil, ErrIdempotencyConflict
+			}
+			tx.Rollback()
+			existing, err := repo.GetByID(existingID)
+			if err != nil {
+				return nil, err
+			}
+			existing.Replayed = true
+			return existing, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	if req.CartID != 0 {
+		storeID, cartItems, checkedOutAs, err := lockCartForCheckout(tx, req.CartID)
+		if err != nil {
+			return nil, err
+		}
+		if checkedOutAs != 0 {
+			tx.Rollback()
+			existing, err := repo.GetByID(checkedOutAs)
+			if err != nil {
+				return nil, err
+			}
+			existing.Replayed = true
+			return existing, nil
+		}
+		req.StoreID, items = storeID, cartItems
+	}
+
+	store, err := resolveStore(tx, req.StoreID)
+	if err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]int, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+
+	// One round trip locks and loads every product in the basket, one more
+	// loads their units (and one the stock of a non-default store)
+	products, err := loadCheckoutProducts(tx, store, productIDs, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sale's own reservations become the decrement below; everything
+	// else reserved is not available to it
+	if err := consumeReservations(tx, store.ID, req.CartID, req.ReservationIDs); err != nil {
+		return nil, err
+	}
+	stock, err := availableStock(tx, store, products, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalAmount models.Money
+	details := make([]models.TransactionDetail, 0, len(items))
+	needs := make(map[int]models.Quantity, len(products))
 
 	for _, item := range items {
 		if item.Quantity <= 0 {
-			return nil, fmt.Errorf("invalid quantity for product %d", item.ProductID)
+			return nil, checkoutErrorf("invalid quantity for product %d", item.ProductID)
 		}
 
-		var productPrice, stock int
-		var productName string
+		product, ok := products[item.ProductID]
+		if !ok {
+			return nil, checkoutErrorf("product id %d not found", item.ProductID)
+		}
 
-		err := tx.QueryRow("SELECT name, price, stock FROM products WHERE id = $1", item.ProductID).Scan(&productName, &productPrice, &stock)
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("product id %d not found", item.ProductID)
+		// Selling unit decides the price; stock is always in the base unit
+		unit, err := product.unit(item.Unit)
+		if err != nil {
+			return nil, &CheckoutError{Message: err.Error()}
 		}
+		baseQuantity, err := item.Quantity.Mul(unit.ConversionFactor)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("product %d: %w", item.ProductID, err)
 		}
-
-		if stock < item.Quantity {
-			return nil, fmt.Errorf("stock not enough for product %d", item.ProductID)
+		if !product.soldByWeight && !baseQuantity.IsWhole() {
+			return nil, checkoutErrorf("product %d is not sold by weight, quantity must be a whole number", item.ProductID)
 		}
 
-		subtotal := productPrice * item.Quantity
-		totalAmount += subtotal
+		needs[item.ProductID] += baseQuantity
+		if stock[item.ProductID] < needs[item.ProductID] {
+			return nil, &StockConflictError{ProductID: item.ProductID, Requested: needs[item.ProductID], Available: stock[item.ProductID]}
+		}
 
-		_, err = tx.Exec("UPDATE products SET stock = stock - $1 WHERE id = $2", item.Quantity, item.ProductID)
+		subtotal, err := unit.Price.MulQuantity(item.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		// A price label charges the price it was printed with
+		if item.LineTotal != nil {
+			subtotal = *item.LineTotal
+		}
+		totalAmount, err = totalAmount.Add(subtotal)
 		if err != nil {
 			return nil, err
 		}
 
 		details = append(details, models.TransactionDetail{
-			ProductID:   item.ProductID,
-			ProductName: productName,
-			Quantity:    item.Quantity,
-			Subtotal:    subtotal,
+			ProductID:    item.ProductID,
+			ProductName:  product.name,
+			Unit:         unit.Name,
+			Quantity:     item.Quantity,
+			BaseQuantity: baseQuantity,
+			Subtotal:     subtotal,
 		})
 	}
 
+	if req.ExpectedTotal != nil && *req.ExpectedTotal != totalAmount {
+		return nil, &PriceMismatchError{Expected: *req.ExpectedTotal, Actual: totalAmount}
+	}
+
+	// A sale awaiting payment keeps its stock reserved instead; it is taken
+	// out when the payment is confirmed
+	pending := req.PaymentTTL > 0
+	if !pending {
+		if err := takeStock(tx, store, stock, needs); err != nil {
+			return nil, err
+		}
+		if err := insertSaleStockEvents(tx, store, needs, repo.lowStock); err != nil {
+			return nil, err
+		}
+	}
+
+	payment := models.Payment{Method: req.PaymentMethod, PaidAmount: totalAmount}
+	if payment.Method == "" {
+		payment.Method = models.PaymentCash
+	}
+	if req.PaidAmount != nil {
+		if *req.PaidAmount < totalAmount {
+			return nil, checkoutErrorf("paid amount %d is less than the total %d", *req.PaidAmount, totalAmount)
+		}
+		payment.PaidAmount = *req.PaidAmount
+	}
+	payment.Change, err = payment.PaidAmount.Sub(totalAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Taken last, so concurrent checkouts of the store queue on the counter
+	// only for the rest of this transaction
+	invoiceNumber, err := nextInvoiceNumber(tx, repo.invoiceFormat, store, req.SoldAt)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.TransactionPaid
+	if pending {
+		status = models.TransactionPendingPayment
+	}
+
 	var transactionID int
-	err = tx.QueryRow("INSERT INTO transactions (total_amount) VALUES ($1) RETURNING id", totalAmount).Scan(&transactionID)
+	var createdAt, paymentExpiresAt string
+	err = tx.QueryRow(`INSERT INTO transactions (total_amount, store_id, idempotency_key, request_hash,
+	                                             payment_method, paid_amount, change_amount, invoice_number,
+	                                             status, payment_expires_at, created_at)
+	                   VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8, $9,
+	                           CASE WHEN $10 > 0 THEN CURRENT_TIMESTAMP + $10 * INTERVAL '1 second' END,
+	                           COALESCE(NULLIF($11, '')::timestamptz, CURRENT_TIMESTAMP))
+	                   RETURNING id, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'),
+	                             COALESCE(to_char(payment_expires_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'), '')`,
+		totalAmount, store.ID, req.IdempotencyKey, req.RequestHash,
+		payment.Method, payment.PaidAmount, payment.Change, invoiceNumber,
+		status, int64(req.PaymentTTL/time.Second), req.SoldAt).Scan(&transactionID, &createdAt, &paymentExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertDetails(tx, transactionID, details); err != nil {
+		return nil, err
+	}
+
+	if pending {
+		if err := reserveForTransaction(tx, transactionID, needs); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.CartID != 0 {
+		_, err = tx.Exec("UPDATE carts SET status = $1, transaction_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+			models.CartCheckedOut, transactionID, req.CartID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	transaction := &models.Transaction{
+		ID:            transactionID,
+		InvoiceNumber: invoiceNumber,
+		StoreID:       store.ID,
+		Status:        status,
+		TotalAmount:   totalAmount,
+		Payment:       payment,
+		CreatedAt:     createdAt,
+		Details:       details,
+	}
+	if pending {
+		transaction.Gateway = &models.GatewayPayment{ExpiresAt: paymentExpiresAt}
+	}
+
+	if err := insertOutbox(tx, models.EventTransactionCreated, transaction); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// takeStock takes a sale's base quantities out of the store's stock, from the
+// batches first. stock is what the sale may use, as returned by availableStock.
+func takeStock(tx *sql.Tx, store *models.Store, stock, needs map[int]models.Quantity) error {
+	// Batches are tracked for the default store's stock only
+	if store.IsDefault {
+		if err := consumeBatchesFEFO(tx, stock, needs); err != nil {
+			return err
+		}
+	}
+	return decrementStock(tx, store, needs)
+}
+
+// insertSaleStockEvents queues stock.changed for the products a sale took
+// and stock.low for those it took to the threshold or below. Only the sale
+// crossing the threshold queues stock.low, so later sales of a product
+// already low stay quiet.
+func insertSaleStockEvents(tx *sql.Tx, store *models.Store, sold map[int]models.Quantity, threshold models.Quantity) error {
+	productIDs := make([]int, 0, len(sold))
+	for id := range sold {
+		productIDs = append(productIDs, id)
+	}
+	levels, err := insertStockChanged(tx, store, productIDs)
+	if err != nil || threshold <= 0 {
+		return err
+	}
+
+	for _, l := range levels {
+		if l.Stock > threshold || l.Stock+sold[l.ProductID] <= threshold {
+			continue
+		}
+		alert := models.StockAlert{
+			StoreID:     store.ID,
+			ProductID:   l.ProductID,
+			ProductName: l.ProductName,
+			Stock:       l.Stock,
+			Available:   l.Available,
+			Threshold:   threshold,
+		}
+		if err := insertOutbox(tx, models.EventStockLow, alert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveForTransaction reserves the stock of a sale awaiting payment until
+// its payment expires.
+func reserveForTransaction(tx *sql.Tx, transactionID int, needs map[int]models.Quantity) error {
+	productIDs := make([]int, 0, len(needs))
+	for id := range needs {
+		productIDs = append(productIDs, id)
+	}
+	ids := sortedProductIDs(productIDs)
+	quantities := make([]string, len(ids))
+	for i, id := range ids {
+		quantities[i] = needs[int(id)].String()
+	}
+
+	_, err := tx.Exec(`INSERT INTO stock_reservations (store_id, product_id, quantity, transaction_id, reference, expires_at)
+	                   SELECT t.store_id, v.product_id, v.quantity, t.id, 'transaction ' || t.id, t.payment_expires_at
+	                   FROM transactions t, unnest($2::bigint[], $3::numeric[]) AS v(product_id, quantity)
+	                   WHERE t.id = $1`, transactionID, pq.Array(ids), pq.Array(quantities))
+	return err
+}
+
+// AttachGatewayPayment stores the QRIS code a gateway issued for a sale
+// awaiting payment.
+func (repo *TransactionRepository) AttachGatewayPayment(id int, gp *models.GatewayPayment) error {
+	_, err := repo.db.Exec(`UPDATE transactions
+	                        SET payment_gateway = $1, payment_order_id = $2, payment_reference = $3,
+	                            payment_qr = $4, payment_qr_url = $5
+	                        WHERE id = $6 AND status = $7`,
+		gp.Gateway, gp.OrderID, gp.Reference, gp.QRString, gp.QRImageURL, id, models.TransactionPendingPayment)
+	return err
+}
+
+// FindByPaymentOrder returns the id of the sale a gateway order belongs to.
+func (repo *TransactionRepository) FindByPaymentOrder(gateway, orderID string) (int, error) {
+	var id int
+	err := repo.db.QueryRow("SELECT id FROM transactions WHERE payment_gateway = $1 AND payment_order_id = $2", gateway, orderID).
+		Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errors.New("transaksi tidak ditemukan")
+	}
+	return id, err
+}
+
+// ConfirmPayment finalizes a sale once its payment arrived: the reserved
+// stock is taken out of stock and the sale counts as paid. Confirming a paid
+// sale again does nothing. A payment arriving after the sale expired or was
+// cancelled is still accepted while the stock is there. A payment that
+// cannot complete the sale, because its amount differs or the stock is
+// gone, is recorded all the same: the sale becomes refund_required and a
+// transaction.refund_required event is sent, so the money is never lost.
+func (repo *TransactionRepository) ConfirmPayment(id int, amount models.Money) error {
+	return retryOnConflict("payment confirmation", func() error {
+		return repo.confirmPayment(id, amount)
+	})
+}
+
+func (repo *TransactionRepository) confirmPayment(id int, amount models.Money) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The sale's row is locked before its products, as a cart is in checkout
+	var storeID int
+	var status string
+	var total models.Money
+	err = tx.QueryRow("SELECT store_id, status, total_amount FROM transactions WHERE id = $1 FOR UPDATE", id).
+		Scan(&storeID, &status, &total)
+	if err == sql.ErrNoRows {
+		return errors.New("transaksi tidak ditemukan")
+	}
+	if err != nil {
+		return err
+	}
+	if status == models.TransactionPaid || status == models.TransactionRefundRequired {
+		return nil
+	}
+	if amount != total {
+		return refundPayment(tx, id, amount, models.RefundAmountMismatch)
+	}
+
+	store, err := resolveStore(tx, storeID)
+	if err != nil {
+		return err
+	}
+	details, err := loadTransactionDetails(tx, []int64{int64(id)})
+	if err != nil {
+		return err
+	}
+	needs := make(map[int]models.Quantity)
+	productIDs := make([]int, 0, len(details[id]))
+	for _, d := range details[id] {
+		needs[d.ProductID] += d.BaseQuantity
+		productIDs = append(productIDs, d.ProductID)
+	}
+
+	products, err := loadCheckoutProducts(tx, store, productIDs, true)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM stock_reservations WHERE transaction_id = $1", id); err != nil {
+		return err
+	}
+	stock, err := availableStock(tx, store, products, productIDs)
+	if err != nil {
+		return err
+	}
+	for productID, qty := range needs {
+		if stock[productID] < qty {
+			return refundPayment(tx, id, amount, models.RefundOutOfStock)
+		}
+	}
+	if err := takeStock(tx, store, stock, needs); err != nil {
+		return err
+	}
+	if err := insertSaleStockEvents(tx, store, needs, repo.lowStock); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET status = $1, paid_amount = total_amount, change_amount = 0 WHERE id = $2",
+		models.TransactionPaid, id)
+	if err != nil {
+		return err
+	}
+
+	paid, err := loadTransaction(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := insertOutbox(tx, models.EventTransactionPaid, paid); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refundPayment records a received payment that cannot complete its sale
+// and commits tx. Its reserved stock, if any, is released.
+func refundPayment(tx *sql.Tx, id int, amount models.Money, reason string) error {
+	if _, err := tx.Exec("DELETE FROM stock_reservations WHERE transaction_id = $1", id); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE transactions SET status = $1, paid_amount = $2, change_amount = 0 WHERE id = $3",
+		models.TransactionRefundRequired, amount, id)
+	if err != nil {
+		return err
+	}
+
+	transaction, err := loadTransaction(tx, id)
+	if err != nil {
+		return err
+	}
+	event := models.RefundRequired{Transaction: transaction, PaidAmount: amount, Reason: reason}
+	if err := insertOutbox(tx, models.EventTransactionRefundRequired, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CancelPendingPayment gives up on a sale awaiting payment and releases its
+// reserved stock.
+func (repo *TransactionRepository) CancelPendingPayment(id int) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM transactions WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return errors.New("transaksi tidak ditemukan")
+	}
+	if err != nil {
+		return err
+	}
+	switch status {
+	case models.TransactionCancelled:
+		return nil
+	case models.TransactionPaid, models.TransactionRefundRequired:
+		return ErrAlreadyPaid
+	}
+
+	if _, err := tx.Exec("DELETE FROM stock_reservations WHERE transaction_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE transactions SET status = $1 WHERE id = $2", models.TransactionCancelled, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// expirePendingPayments cancels sales whose payment did not arrive in time.
+// Their reservations have expired already.
+func expirePendingPayments(db *sql.DB) error {
+	_, err := db.Exec(`UPDATE transactions SET status = $1
+	                   WHERE status = $2 AND payment_expires_at <= CURRENT_TIMESTAMP`,
+		models.TransactionCancelled, models.TransactionPendingPayment)
+	return err
+}
+
+// nextInvoiceNumber takes the next number of the store's sequence for the
+// period the sale was made in: soldAt (RFC 3339) for a sale recorded later,
+// such as offline, or now when empty. The counter row stays locked until the
+// checkout commits and a rollback gives the number back, so numbers have no
+// gaps.
+func nextInvoiceNumber(tx *sql.Tx, format invoice.Format, store *models.Store, soldAt string) (string, error) {
+	// The same expression the sale's created_at is set from; CURRENT_TIMESTAMP
+	// is the start of the transaction
+	var now time.Time
+	err := tx.QueryRow("SELECT COALESCE(NULLIF($1, '')::timestamptz, CURRENT_TIMESTAMP)", soldAt).Scan(&now)
+	if err != nil {
+		return "", err
+	}
+
+	var seq int64
+	err = tx.QueryRow(`INSERT INTO invoice_counters (store_id, period, last_number) VALUES ($1, $2, 1)
+	                    ON CONFLICT (store_id, period) DO UPDATE SET last_number = invoice_counters.last_number + 1
+	                    RETURNING last_number`, store.ID, format.Period(now)).Scan(&seq)
+	if err != nil {
+		return "", err
+	}
+
+	return format.Number(store.Code, now, seq), nil
+}
+
+// checkoutProduct is what checkout needs to know about a product in the basket.
+type checkoutProduct struct {
+	name         string
+	baseUnit     string
+	price        models.Money
+	soldByWeight bool
+	stock        models.Quantity
+	units        map[string]models.ProductUnit
+}
+
+// unit resolves a selling unit; empty or the base unit sells at the
+// (store-specific) base price.
+func (p *checkoutProduct) unit(name string) (models.ProductUnit, error) {
+	if name == "" || name == p.baseUnit {
+		return models.ProductUnit{Name: p.baseUnit, ConversionFactor: models.NewQuantity(1), Price: p.price}, nil
+	}
+	u, ok := p.units[name]
+	if !ok {
+		return u, fmt.Errorf("unit %s not defined for product %s", name, p.name)
+	}
+	return u, nil
+}
+
+// loadCheckoutProducts loads the basket's products with the store's price
+// overrides and all their units, optionally locking them in id order.
+func loadCheckoutProducts(q queryer, store *models.Store, productIDs []int, forUpdate bool) (map[int]*checkoutProduct, error) {
+	ids := pq.Array(sortedProductIDs(productIDs))
+
+	query := `SELECT p.id, p.name, p.base_unit, COALESCE(sp.price, p.price), p.sold_by_weight, p.stock
+	          FROM products p
+	          LEFT JOIN store_prices sp ON sp.product_id = p.id AND sp.store_id = $2
+	          WHERE p.id = ANY($1)
+	          ORDER BY p.id`
+	if forUpdate {
+		query += " FOR UPDATE OF p"
+	}
+	rows, err := q.Query(query, ids, store.ID)
 	if err != nil {
 		return nil, err
 	}
+	products := make(map[int]*checkoutProduct, len(productIDs))
+	for rows.Next() {
+		var id int
+		p := &checkoutProduct{units: make(map[string]models.ProductUnit)}
+		if err := rows.Scan(&id, &p.name, &p.baseUnit, &p.price, &p.soldByWeight, &p.stock); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		products[id] = p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(`SELECT id, product_id, name, conversion_factor, price
+	                      FROM product_units WHERE product_id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u models.ProductUnit
+		if err := rows.Scan(&u.ID, &u.ProductID, &u.Name, &u.ConversionFactor, &u.Price); err != nil {
+			return nil, err
+		}
+		if p, ok := products[u.ProductID]; ok {
+			p.units[u.Name] = u
+		}
+	}
 
+	return products, rows.Err()
+}
+
+// insertDetails inserts all line items of a transaction in one statement and
+// fills in their ids.
+func insertDetails(tx *sql.Tx, transactionID int, details []models.TransactionDetail) error {
+	productIDs := make([]int64, len(details))
+	units := make([]string, len(details))
+	quantities := make([]string, len(details))
+	baseQuantities := make([]string, len(details))
+	subtotals := make([]int64, len(details))
+	for i, d := range details {
+		productIDs[i] = int64(d.ProductID)
+		units[i] = d.Unit
+		quantities[i] = d.Quantity.String()
+		baseQuantities[i] = d.BaseQuantity.String()
+		subtotals[i] = int64(d.Subtotal)
+	}
+
+	rows, err := tx.Query(`INSERT INTO transaction_details (transaction_id, product_id, unit, quantity, base_quantity, subtotal)
+	                       SELECT $1, v.product_id, v.unit, v.quantity, v.base_quantity, v.subtotal
+	                       FROM unnest($2::bigint[], $3::text[], $4::numeric[], $5::numeric[], $6::bigint[])
+	                            WITH ORDINALITY AS v(product_id, unit, quantity, base_quantity, subtotal, ord)
+	                       ORDER BY v.ord
+	                       RETURNING id`,
+		transactionID, pq.Array(productIDs), pq.Array(units), pq.Array(quantities), pq.Array(baseQuantities), pq.Array(subtotals))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Ids come from the sequence in insert order, so sorted ids match the
+	// order of the details
+	ids := make([]int, 0, len(details))
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	slices.Sort(ids)
 	for i := range details {
 		details[i].TransactionID = transactionID
-		_, err = tx.Exec("INSERT INTO transaction_details (transaction_id, product_id, quantity, subtotal) VALUES ($1, $2, $3, $4)",
-			transactionID, details[i].ProductID, details[i].Quantity, details[i].Subtotal)
+		if i < len(ids) {
+			details[i].ID = ids[i]
+		}
+	}
+
+	return nil
+}
+
+// GetByID loads a stored transaction with its line items.
+func (repo *TransactionRepository) GetByID(id int) (*models.Transaction, error) {
+	if err := expirePendingPayments(repo.db); err != nil {
+		return nil, err
+	}
+	return loadTransaction(repo.db, id)
+}
+
+func loadTransaction(q queryer, id int) (*models.Transaction, error) {
+	t, err := scanTransaction(q.QueryRow("SELECT "+transactionColumns+" FROM transactions t WHERE t.id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("transaksi tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := loadTransactionDetails(q, []int64{int64(id)})
+	if err != nil {
+		return nil, err
+	}
+	t.Details = details[id]
+
+	return t, nil
+}
+
+const transactionColumns = `t.id, COALESCE(t.invoice_number, ''), t.store_id, t.status, t.total_amount, t.payment_method,
+	COALESCE(t.paid_amount, t.total_amount), t.change_amount, to_char(t.created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'),
+	COALESCE(t.payment_gateway, ''), COALESCE(t.payment_order_id, ''), COALESCE(t.payment_reference, ''),
+	COALESCE(t.payment_qr, ''), COALESCE(t.payment_qr_url, ''),
+	COALESCE(to_char(t.payment_expires_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'), '')`
+
+// scanTransaction scans transactionColumns; the gateway payment is only set
+// for sales paid through a gateway.
+func scanTransaction(row interface{ Scan(...interface{}) error }) (*models.Transaction, error) {
+	var t models.Transaction
+	var gp models.GatewayPayment
+	err := row.Scan(&t.ID, &t.InvoiceNumber, &t.StoreID, &t.Status, &t.TotalAmount, &t.Method, &t.PaidAmount, &t.Change,
+		&t.CreatedAt, &gp.Gateway, &gp.OrderID, &gp.Reference, &gp.QRString, &gp.QRImageURL, &gp.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if gp.Gateway != "" {
+		t.Gateway = &gp
+	}
+	return &t, nil
+}
+
+// SearchByInvoice finds the latest transactions whose invoice number contains
+// the given text (case-insensitive), at one store or all stores when storeID
+// is 0.
+func (repo *TransactionRepository) SearchByInvoice(storeID int, number string, limit int) ([]models.Transaction, error) {
+	if err := expirePendingPayments(repo.db); err != nil {
+		return nil, err
+	}
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(number) + "%"
+	rows, err := repo.db.Query("SELECT "+transactionColumns+` FROM transactions t
+	                           WHERE t.invoice_number ILIKE $1 AND ($2::bigint = 0 OR t.store_id = $2)
+	                           ORDER BY t.created_at DESC, t.id DESC
+	                           LIMIT $3`, pattern, storeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]models.Transaction, 0)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		t, err := scanTransaction(rows)
 		if err != nil {
 			return nil, err
 		}
+		transactions = append(transactions, *t)
+		ids = append(ids, int64(t.ID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
+	details, err := loadTransactionDetails(repo.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range transactions {
+		transactions[i].Details = details[transactions[i].ID]
+	}
+
+	return transactions, nil
+}
+
+// ExportLines passes the line items of the transactions matching filter to
+// fn, oldest transaction first, as the rows come from the database.
+func (repo *TransactionRepository) ExportLines(filter models.TransactionExportFilter, fn func(models.TransactionLine) error) error {
+	if err := expirePendingPayments(repo.db); err != nil {
+		return err
+	}
+
+	rows, err := repo.db.Query(`SELECT t.id, COALESCE(t.invoice_number, ''), to_char(t.created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'),
+	                                   s.code, t.status, t.total_amount, t.payment_method,
+	                                   COALESCE(t.paid_amount, t.total_amount), t.change_amount,
+	                                   COALESCE(td.product_id, 0), COALESCE(p.sku, ''), COALESCE(p.name, ''),
+	                                   COALESCE(td.unit, p.base_unit, ''), COALESCE(td.quantity, 0),
+	                                   COALESCE(td.base_quantity, td.quantity, 0), COALESCE(td.subtotal, 0)
+	                            FROM transactions t
+	                            JOIN stores s ON s.id = t.store_id
+	                            LEFT JOIN transaction_details td ON td.transaction_id = t.id
+	                            LEFT JOIN products p ON p.id = td.product_id
+	                            WHERE ($1::bigint = 0 OR t.store_id = $1)
+	                              AND ($2 = '' OR t.created_at::date >= $2::date)
+	                              AND ($3 = '' OR t.created_at::date <= $3::date)
+	                              AND ($4 = '' OR t.status = $4)
+	                            ORDER BY t.created_at, t.id, td.id`,
+		filter.StoreID, filter.From, filter.To, filter.Status)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.TransactionLine
+		err := rows.Scan(&l.TransactionID, &l.InvoiceNumber, &l.CreatedAt, &l.StoreCode, &l.Status, &l.TotalAmount,
+			&l.Method, &l.PaidAmount, &l.Change, &l.ProductID, &l.SKU, &l.ProductName, &l.Unit, &l.Quantity,
+			&l.BaseQuantity, &l.Subtotal)
+		if err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadTransactionDetails loads the line items of several transactions in one
+// query; every transaction gets a (possibly empty) slice.
+func loadTransactionDetails(q queryer, transactionIDs []int64) (map[int][]models.TransactionDetail, error) {
+	details := make(map[int][]models.TransactionDetail, len(transactionIDs))
+	for _, id := range transactionIDs {
+		details[int(id)] = make([]models.TransactionDetail, 0)
+	}
+	if len(transactionIDs) == 0 {
+		return details, nil
+	}
+
+	rows, err := q.Query(`SELECT td.id, td.transaction_id, td.product_id, p.name, COALESCE(td.unit, p.base_unit), td.quantity,
+	                             COALESCE(td.base_quantity, td.quantity), td.subtotal
+	                      FROM transaction_details td
+	                      JOIN products p ON p.id = td.product_id
+	                      WHERE td.transaction_id = ANY($1)
+	                      ORDER BY td.id`, pq.Array(transactionIDs))
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.TransactionDetail
+		err := rows.Scan(&d.ID, &d.TransactionID, &d.ProductID, &d.ProductName, &d.Unit, &d.Quantity, &d.BaseQuantity, &d.Subtotal)
+		if err != nil {
+			return nil, err
+		}
+		details[d.TransactionID] = append(details[d.TransactionID], d)
+	}
 
-	return &models.Transaction{
-		ID:          transactionID,
-		TotalAmount: totalAmount,
-		Details:     details,
-	}, nil
+	return details, rows.Err()
 }
 
-func (repo *TransactionRepository) GetTodaySummary() (*models.ReportSummary, error) {
-	var totalRevenue, totalTransaksi int
+// GetTodaySummary summarises today's paid sales of one store, or of all
+// stores when storeID is 0.
+func (repo *TransactionRepository) GetTodaySummary(storeID int) (*models.ReportSummary, error) {
+	var totalRevenue models.Money
+	var totalTransaksi int
 
 	err := repo.db.QueryRow(`
 		SELECT COALESCE(SUM(total_amount), 0), COALESCE(COUNT(*), 0)
 		FROM transactions
 		WHERE created_at::date = CURRENT_DATE
-	`).Scan(&totalRevenue, &totalTransaksi)
+		  AND ($1::bigint = 0 OR store_id = $1)
+		  AND status = 'paid'
+	`, storeID).Scan(&totalRevenue, &totalTransaksi)
 	if err != nil {
 		return nil, err
 	}
 
 	var topName sql.NullString
-	var topQty sql.NullInt64
+	var topQty models.Quantity
 	_ = repo.db.QueryRow(`
-		SELECT p.name, COALESCE(SUM(td.quantity), 0) as qty
+		SELECT p.name, COALESCE(SUM(COALESCE(td.base_quantity, td.quantity)), 0) as qty
 		FROM transaction_details td
 		JOIN transactions t ON t.id = td.transaction_id
 		JOIN products p ON p.id = td.product_id
 		WHERE t.created_at::date = CURRENT_DATE
+		  AND ($1::bigint = 0 OR t.store_id = $1)
+		  AND t.status = 'paid'
 		GROUP BY p.name
 		ORDER BY qty DESC
 		LIMIT 1
-	`).Scan(&topName, &topQty)
+	`, storeID).Scan(&topName, &topQty)
 
 	summary := &models.ReportSummary{
 		TotalRevenue:   totalRevenue,
@@ -125,10 +941,60 @@ func (repo *TransactionRepository) GetTodaySummary() (*models.ReportSummary, err
 		},
 	}
 
-	if topName.Valid && topQty.Valid {
+	if topName.Valid {
 		summary.ProdukTerlaris.Nama = topName.String
-		summary.ProdukTerlaris.QtyTerjual = int(topQty.Int64)
+		summary.ProdukTerlaris.QtyTerjual = topQty
 	}
 
 	return summary, nil
 }
+
+// GetTodaySalesPerCategory sums today's paid sales of one store (all stores
+// when storeID is 0) per category, each including its subcategories. With a
+// categoryID only that category and those below it are listed.
+func (repo *TransactionRepository) GetTodaySalesPerCategory(storeID, categoryID int) ([]models.CategorySales, error) {
+	rows, err := repo.db.Query(`
+		WITH RECURSIVE tree AS (
+			SELECT id AS root, id FROM categories
+			UNION
+			SELECT t.root, c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		), sales AS (
+			SELECT td.transaction_id, td.subtotal, p.category_id
+			FROM transaction_details td
+			JOIN transactions t ON t.id = td.transaction_id
+			JOIN products p ON p.id = td.product_id
+			WHERE t.created_at::date = CURRENT_DATE
+			  AND ($1::bigint = 0 OR t.store_id = $1)
+			  AND t.status = 'paid'
+		)
+		SELECT c.id, c.parent_id, c.name, COALESCE(SUM(s.subtotal), 0), COUNT(DISTINCT s.transaction_id)
+		FROM categories c
+		JOIN tree ON tree.root = c.id
+		LEFT JOIN sales s ON s.category_id = tree.id
+		WHERE $2::bigint = 0 OR c.id IN `+categorySubtree("$2")+`
+		GROUP BY c.id, c.parent_id, c.name
+		ORDER BY c.name, c.id
+	`, storeID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := make([]models.CategorySales, 0)
+	for rows.Next() {
+		var cs models.CategorySales
+		if err := rows.Scan(&cs.CategoryID, &cs.ParentID, &cs.Name, &cs.TotalRevenue, &cs.TotalTransaksi); err != nil {
+			return nil, err
+		}
+		sales = append(sales, cs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The category itself is always listed when it exists
+	if categoryID != 0 && len(sales) == 0 {
+		return nil, errors.New("kategori tidak ditemukan")
+	}
+	return sales, nil
+}
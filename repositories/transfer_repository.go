@@ -0,0 +1,443 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+type TransferRepository struct {
+	db *sql.DB
+}
+
+func NewTransferRepository(db *sql.DB) *TransferRepository {
+	return &TransferRepository{db: db}
+}
+
+const transferColumns = `id, source_store_id, destination_store_id, status, note,
+	to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'),
+	to_char(sent_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'),
+	to_char(received_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`
+
+func scanTransfer(row interface{ Scan(...interface{}) error }) (*models.StockTransfer, error) {
+	var t models.StockTransfer
+	var sentAt, receivedAt sql.NullString
+	err := row.Scan(&t.ID, &t.SourceStoreID, &t.DestinationStoreID, &t.Status, &t.Note, &t.CreatedAt, &sentAt, &receivedAt)
+	if err != nil {
+		return nil, err
+	}
+	if sentAt.Valid {
+		t.SentAt = &sentAt.String
+	}
+	if receivedAt.Valid {
+		t.ReceivedAt = &receivedAt.String
+	}
+	return &t, nil
+}
+
+func (repo *TransferRepository) GetAll(status string) ([]models.StockTransfer, error) {
+	query := "SELECT " + transferColumns + " FROM stock_transfers"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = $1"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := make([]models.StockTransfer, 0)
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *t)
+	}
+
+	return transfers, rows.Err()
+}
+
+func (repo *TransferRepository) GetByID(id int) (*models.StockTransfer, error) {
+	return getTransfer(repo.db, id, false)
+}
+
+// Create stores a draft transfer with item quantities converted to base units.
+func (repo *TransferRepository) Create(transfer *models.StockTransfer) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, storeID := range []int{transfer.SourceStoreID, transfer.DestinationStoreID} {
+		if _, err := resolveStore(tx, storeID); err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRow(`INSERT INTO stock_transfers (source_store_id, destination_store_id, note)
+	                   VALUES ($1, $2, $3) RETURNING id`,
+		transfer.SourceStoreID, transfer.DestinationStoreID, transfer.Note).Scan(&transfer.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertTransferItems(tx, transfer.ID, transfer.Items); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	created, err := repo.GetByID(transfer.ID)
+	if err != nil {
+		return err
+	}
+	*transfer = *created
+	return nil
+}
+
+// UpdateItems replaces the items of a draft transfer.
+func (repo *TransferRepository) UpdateItems(id int, items []models.StockTransferItem) (*models.StockTransfer, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := getTransfer(tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.Status != models.TransferDraft {
+		return nil, fmt.Errorf("transfer %d is %s, only drafts can be edited", id, transfer.Status)
+	}
+
+	if _, err := tx.Exec("DELETE FROM stock_transfer_items WHERE transfer_id = $1", id); err != nil {
+		return nil, err
+	}
+	if err := insertTransferItems(tx, id, items); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// Send takes the transfer's stock out of the source store. Only stock that
+// is not reserved can be sent.
+func (repo *TransferRepository) Send(id int) (*models.StockTransfer, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := getTransfer(tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.Status != models.TransferDraft {
+		return nil, fmt.Errorf("transfer %d is %s, only drafts can be sent", id, transfer.Status)
+	}
+
+	source, err := resolveStore(tx, transfer.SourceStoreID)
+	if err != nil {
+		return nil, err
+	}
+
+	needs := make(map[int]models.Quantity)
+	productIDs := make([]int, 0, len(transfer.Items))
+	for _, item := range transfer.Items {
+		needs[item.ProductID] += item.Quantity
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	stock, err := lockStock(tx, source, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	// Stock reserved by carts, orders and sales awaiting payment stays behind
+	reserved, err := reservedStock(tx, source.ID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	for productID, qty := range needs {
+		if available := stock[productID] - reserved[productID]; available < qty {
+			return nil, &StockConflictError{ProductID: productID, Requested: qty, Available: available}
+		}
+	}
+	if source.IsDefault {
+		if err := consumeBatchesFEFO(tx, stock, needs); err != nil {
+			return nil, err
+		}
+	}
+	if err := decrementStock(tx, source, needs); err != nil {
+		return nil, err
+	}
+	if _, err := insertStockChanged(tx, source, productIDs); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE stock_transfers SET status = $1, sent_at = CURRENT_TIMESTAMP WHERE id = $2", models.TransferSent, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// Receive adds what actually arrived to the destination store. Items missing
+// from the receipt are taken as fully received; any shortfall is kept on the
+// item as a discrepancy and does not return to the source store.
+func (repo *TransferRepository) Receive(id int, receipt models.TransferReceipt) (*models.StockTransfer, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := getTransfer(tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.Status != models.TransferSent {
+		return nil, fmt.Errorf("transfer %d is %s, only sent transfers can be received", id, transfer.Status)
+	}
+
+	destination, err := resolveStore(tx, transfer.DestinationStoreID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keyed by transfer item, as a product may be on several items
+	received := make(map[int]models.TransferReceiptItem)
+	for _, r := range receipt.Items {
+		itemID, err := receiptItemID(transfer, r)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := received[itemID]; ok {
+			return nil, fmt.Errorf("item %d of transfer %d is received twice", itemID, id)
+		}
+		received[itemID] = r
+	}
+
+	stocked := make([]int, 0, len(transfer.Items))
+	for _, item := range transfer.Items {
+		qty := item.Quantity
+		note := ""
+		if r, ok := received[item.ID]; ok {
+			qty = r.QuantityReceived
+			note = r.Note
+		}
+		if qty < 0 {
+			return nil, fmt.Errorf("invalid quantity_received for product %d", item.ProductID)
+		}
+
+		_, err = tx.Exec("UPDATE stock_transfer_items SET quantity_received = $1, note = $2 WHERE id = $3", qty, note, item.ID)
+		if err != nil {
+			return nil, err
+		}
+		if qty == 0 {
+			continue
+		}
+		if err := adjustStoreStock(tx, destination, item.ProductID, qty); err != nil {
+			return nil, err
+		}
+		if destination.IsDefault {
+			if err := createBatch(tx, item.ProductID, qty, fmt.Sprintf("TRF-%d", id), nil); err != nil {
+				return nil, err
+			}
+		}
+		stocked = append(stocked, item.ProductID)
+	}
+	if len(stocked) > 0 {
+		if _, err := insertStockChanged(tx, destination, stocked); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE stock_transfers SET status = $1, received_at = CURRENT_TIMESTAMP WHERE id = $2", models.TransferReceived, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return repo.GetByID(id)
+}
+
+// receiptItemID finds the transfer item a receipt line confirms.
+func receiptItemID(transfer *models.StockTransfer, r models.TransferReceiptItem) (int, error) {
+	if r.ItemID != 0 {
+		for _, item := range transfer.Items {
+			if item.ID == r.ItemID {
+				return item.ID, nil
+			}
+		}
+		return 0, fmt.Errorf("item %d is not part of transfer %d", r.ItemID, transfer.ID)
+	}
+
+	itemID := 0
+	for _, item := range transfer.Items {
+		if item.ProductID != r.ProductID {
+			continue
+		}
+		if itemID != 0 {
+			return 0, fmt.Errorf("product %d is on several items of transfer %d, receive them by item_id", r.ProductID, transfer.ID)
+		}
+		itemID = item.ID
+	}
+	if itemID == 0 {
+		return 0, fmt.Errorf("product %d is not part of transfer %d", r.ProductID, transfer.ID)
+	}
+	return itemID, nil
+}
+
+// Cancel cancels a draft transfer; no stock has moved yet.
+func (repo *TransferRepository) Cancel(id int) (*models.StockTransfer, error) {
+	result, err := repo.db.Exec("UPDATE stock_transfers SET status = $1 WHERE id = $2 AND status = $3",
+		models.TransferCancelled, id, models.TransferDraft)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, errors.New("transfer tidak ditemukan atau bukan draft")
+	}
+
+	return repo.GetByID(id)
+}
+
+// GetInTransit sums stock on sent transfers that has not been received yet.
+func (repo *TransferRepository) GetInTransit(storeID int) ([]models.InTransitStock, error) {
+	query := `SELECT i.product_id, p.name, t.source_store_id, t.destination_store_id,
+	                 SUM(i.quantity), array_agg(DISTINCT t.id ORDER BY t.id)
+	          FROM stock_transfer_items i
+	          JOIN stock_transfers t ON t.id = i.transfer_id
+	          JOIN products p ON p.id = i.product_id
+	          WHERE t.status = $1
+	            AND ($2::bigint = 0 OR t.source_store_id = $2 OR t.destination_store_id = $2)
+	          GROUP BY i.product_id, p.name, t.source_store_id, t.destination_store_id
+	          ORDER BY p.name, t.source_store_id, t.destination_store_id`
+	rows, err := repo.db.Query(query, models.TransferSent, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stock := make([]models.InTransitStock, 0)
+	for rows.Next() {
+		var s models.InTransitStock
+		err := rows.Scan(&s.ProductID, &s.ProductName, &s.SourceStoreID, &s.DestinationStoreID,
+			&s.Quantity, pq.Array(&s.TransferIDs))
+		if err != nil {
+			return nil, err
+		}
+		stock = append(stock, s)
+	}
+
+	return stock, rows.Err()
+}
+
+type queryer interface {
+	queryRower
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// getTransfer loads a transfer with its items, optionally locking it.
+func getTransfer(q queryer, id int, forUpdate bool) (*models.StockTransfer, error) {
+	query := "SELECT " + transferColumns + " FROM stock_transfers WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	transfer, err := scanTransfer(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("transfer tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`SELECT i.id, i.product_id, p.name, i.quantity, i.quantity_received, i.note
+	                      FROM stock_transfer_items i
+	                      JOIN products p ON p.id = i.product_id
+	                      WHERE i.transfer_id = $1
+	                      ORDER BY i.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfer.Items = make([]models.StockTransferItem, 0)
+	for rows.Next() {
+		var item models.StockTransferItem
+		var received sql.NullString
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.Quantity, &received, &item.Note); err != nil {
+			return nil, err
+		}
+		if received.Valid {
+			var qty models.Quantity
+			if err := qty.Scan(received.String); err != nil {
+				return nil, err
+			}
+			discrepancy := item.Quantity - qty
+			item.QuantityReceived = &qty
+			item.Discrepancy = &discrepancy
+		}
+		transfer.Items = append(transfer.Items, item)
+	}
+
+	return transfer, rows.Err()
+}
+
+func insertTransferItems(tx *sql.Tx, transferID int, items []models.StockTransferItem) error {
+	if len(items) == 0 {
+		return errors.New("items cannot be empty")
+	}
+
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return fmt.Errorf("invalid quantity for product %d", item.ProductID)
+		}
+		unit, err := findUnit(tx, item.ProductID, item.Unit)
+		if err != nil {
+			return err
+		}
+		baseQuantity, err := item.Quantity.Mul(unit.ConversionFactor)
+		if err != nil {
+			return fmt.Errorf("product %d: %w", item.ProductID, err)
+		}
+		_, err = tx.Exec("INSERT INTO stock_transfer_items (transfer_id, product_id, quantity) VALUES ($1, $2, $3)",
+			transferID, item.ProductID, baseQuantity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"kasir-api/models"
+)
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx so lookups can run
+// inside or outside a database transaction.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// findUnit resolves a unit name for a product. An empty name or the product's
+// base unit resolves to the base unit (factor 1, product price).
+func findUnit(q queryRower, productID int, unitName string) (*models.ProductUnit, error) {
+	var productName, baseUnit string
+	var price models.Money
+	err := q.QueryRow("SELECT name, base_unit, price FROM products WHERE id = $1", productID).Scan(&productName, &baseUnit, &price)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("produk tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if unitName == "" || unitName == baseUnit {
+		return &models.ProductUnit{
+			ProductID:        productID,
+			Name:             baseUnit,
+			ConversionFactor: models.NewQuantity(1),
+			Price:            price,
+		}, nil
+	}
+
+	u := models.ProductUnit{ProductID: productID}
+	err = q.QueryRow("SELECT id, name, conversion_factor, price FROM product_units WHERE product_id = $1 AND name = $2", productID, unitName).
+		Scan(&u.ID, &u.Name, &u.ConversionFactor, &u.Price)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("unit %s not defined for product %s", unitName, productName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
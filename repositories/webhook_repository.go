@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"kasir-api/models"
+
+	"github.com/lib/pq"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+const subscriptionColumns = `id, url, events, active, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := row.Scan(&sub.ID, &sub.URL, pq.Array(&sub.Events), &sub.Active, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (repo *WebhookRepository) GetAll() ([]models.WebhookSubscription, error) {
+	rows, err := repo.db.Query("SELECT " + subscriptionColumns + " FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := make([]models.WebhookSubscription, 0)
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *sub)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (repo *WebhookRepository) GetByID(id int) (*models.WebhookSubscription, error) {
+	sub, err := scanSubscription(repo.db.QueryRow("SELECT "+subscriptionColumns+" FROM webhook_subscriptions WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("webhook tidak ditemukan")
+	}
+	return sub, err
+}
+
+func (repo *WebhookRepository) Create(sub *models.WebhookSubscription) error {
+	return repo.db.QueryRow(`INSERT INTO webhook_subscriptions (url, secret, events, active) VALUES ($1, $2, $3, $4)
+	                         RETURNING id, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`,
+		sub.URL, sub.Secret, pq.Array(sub.Events), sub.Active).Scan(&sub.ID, &sub.CreatedAt)
+}
+
+// Update changes URL, events and active flag; the secret is kept unless a
+// new one is given.
+func (repo *WebhookRepository) Update(sub *models.WebhookSubscription) error {
+	err := repo.db.QueryRow(`UPDATE webhook_subscriptions
+	                         SET url = $1, events = $2, active = $3, secret = COALESCE(NULLIF($4, ''), secret)
+	                         WHERE id = $5
+	                         RETURNING to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF')`,
+		sub.URL, pq.Array(sub.Events), sub.Active, sub.Secret, sub.ID).Scan(&sub.CreatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("webhook tidak ditemukan")
+	}
+	return err
+}
+
+func (repo *WebhookRepository) Delete(id int) error {
+	result, err := repo.db.Exec("DELETE FROM webhook_subscriptions WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return errors.New("webhook tidak ditemukan")
+	}
+
+	return nil
+}
+
+// Enqueue queues an event for every active subscription listening to its
+// type and returns how many deliveries were queued. Enqueueing the same event
+// again only queues it for subscriptions that do not have it yet.
+func (repo *WebhookRepository) Enqueue(eventID, eventType string, payload []byte) (int64, error) {
+	result, err := repo.db.Exec(`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+	                             SELECT id, $1, $2, $3 FROM webhook_subscriptions
+	                             WHERE active AND ($2 = ANY(events) OR '*' = ANY(events))
+	                             ON CONFLICT (subscription_id, event_id) WHERE replay_of IS NULL DO NOTHING`,
+		eventID, eventType, string(payload))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deliveryColumns = `d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.last_status_code, d.last_error, COALESCE(to_char(d.next_attempt_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'), ''),
+	to_char(d.created_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'), COALESCE(to_char(d.delivered_at, 'YYYY-MM-DD"T"HH24:MI:SSOF'), ''),
+	d.replay_of, s.url, s.secret`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload string
+	var statusCode, replayOf sql.NullInt64
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&statusCode, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt, &replayOf, &d.URL, &d.Secret)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	if statusCode.Valid {
+		code := int(statusCode.Int64)
+		d.LastStatusCode = &code
+	}
+	if replayOf.Valid {
+		id := int(replayOf.Int64)
+		d.ReplayOf = &id
+	}
+	if d.Status != models.DeliveryPending {
+		d.NextAttemptAt = ""
+	}
+	return &d, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetDeliveries lists the latest deliveries of a subscription, optionally
+// with one status.
+func (repo *WebhookRepository) GetDeliveries(subscriptionID int, status string, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := repo.db.Query("SELECT "+deliveryColumns+` FROM webhook_deliveries d
+	                           JOIN webhook_subscriptions s ON s.id = d.subscription_id
+	                           WHERE d.subscription_id = $1 AND ($2 = '' OR d.status = $2)
+	                           ORDER BY d.id DESC
+	                           LIMIT $3`, subscriptionID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// ClaimDue takes up to limit deliveries that are due and leases them for
+// lease, so another server sending webhooks skips them meanwhile.
+func (repo *WebhookRepository) ClaimDue(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	rows, err := repo.db.Query(`WITH due AS (
+	                                SELECT id FROM webhook_deliveries
+	                                WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+	                                ORDER BY next_attempt_at, id
+	                                LIMIT $1
+	                                FOR UPDATE SKIP LOCKED
+	                            ), claimed AS (
+	                                UPDATE webhook_deliveries d
+	                                SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+	                                FROM due WHERE d.id = due.id
+	                                RETURNING d.*
+	                            )
+	                            SELECT `+deliveryColumns+` FROM claimed d
+	                            JOIN webhook_subscriptions s ON s.id = d.subscription_id
+	                            ORDER BY d.id`, limit, int64(lease/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+// RecordAttempt stores the outcome of sending a delivery. An attempt that
+// failed is retried after retryIn; with retryIn 0 the delivery is given up.
+func (repo *WebhookRepository) RecordAttempt(id int, statusCode int, sendErr string, delivered bool, retryIn time.Duration) error {
+	status := models.DeliveryDelivered
+	if !delivered {
+		status = models.DeliveryPending
+		if retryIn <= 0 {
+			status = models.DeliveryFailed
+		}
+	}
+
+	_, err := repo.db.Exec(`UPDATE webhook_deliveries
+	                        SET status = $1, attempts = attempts + 1, last_status_code = NULLIF($2, 0), last_error = $3,
+	                            next_attempt_at = CURRENT_TIMESTAMP + $4 * INTERVAL '1 second',
+	                            delivered_at = CASE WHEN $1 = 'delivered' THEN CURRENT_TIMESTAMP END
+	                        WHERE id = $5`,
+		status, statusCode, sendErr, int64(retryIn/time.Second), id)
+	return err
+}
+
+// Replay queues a new delivery of the same event and payload to the
+// subscription, whatever happened to the original.
+func (repo *WebhookRepository) Replay(subscriptionID, deliveryID int) (*models.WebhookDelivery, error) {
+	var id int
+	err := repo.db.QueryRow(`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, replay_of)
+	                         SELECT subscription_id, event_id, event_type, payload, id FROM webhook_deliveries
+	                         WHERE id = $1 AND subscription_id = $2
+	                         RETURNING id`, deliveryID, subscriptionID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("pengiriman webhook tidak ditemukan")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDelivery(repo.db.QueryRow("SELECT "+deliveryColumns+` FROM webhook_deliveries d
+	                                      JOIN webhook_subscriptions s ON s.id = d.subscription_id
+	                                      WHERE d.id = $1`, id))
+}
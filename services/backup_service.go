@@ -0,0 +1,26 @@
+package services
+
+import (
+	"io"
+
+	"kasir-api/models"
+	"kasir-api/repositories"
+)
+
+type BackupService struct {
+	repo *repositories.BackupRepository
+}
+
+func NewBackupService(repo *repositories.BackupRepository) *BackupService {
+	return &BackupService{repo: repo}
+}
+
+// Backup streams a backup archive of the catalog, stores and sales to w.
+func (s *BackupService) Backup(w io.Writer) error {
+	return s.repo.Dump(w)
+}
+
+// Restore replays a backup archive into an empty database.
+func (s *BackupService) Restore(r io.Reader, dryRun bool) (*models.RestoreResult, error) {
+	return s.repo.Restore(r, dryRun)
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"kasir-api/models"
+)
+
+// ScaleBarcode is the decoded content of a label printed by a weighing scale.
+//
+// Layout (EAN-13, prefix 2x): 2 X IIIII VVVVV C
+//   - X 0-4: VVVVV is the net weight in grams
+//   - X 5-9: VVVVV is the price in rupiah
+//   - IIIII is the item code (PLU) stored as the product's barcode
+//   - C is the EAN-13 check digit
+type ScaleBarcode struct {
+	ItemCode string
+	Grams    int
+	Price    models.Money
+	IsPrice  bool
+}
+
+// IsScaleBarcode reports whether code is an in-store EAN-13 with a 2x prefix.
+func IsScaleBarcode(code string) bool {
+	return len(code) == 13 && code[0] == '2' && isDigits(code)
+}
+
+// ParseScaleBarcode decodes a 2x-prefixed EAN-13 printed by a scale.
+func ParseScaleBarcode(code string) (*ScaleBarcode, error) {
+	if !IsScaleBarcode(code) {
+		return nil, errors.New("bukan barcode timbangan (EAN-13 berawalan 2)")
+	}
+	if !validEAN13(code) {
+		return nil, fmt.Errorf("invalid check digit for barcode %s", code)
+	}
+
+	value, _ := strconv.Atoi(code[7:12])
+	scale := &ScaleBarcode{ItemCode: code[2:7]}
+	if code[1] >= '5' {
+		scale.IsPrice = true
+		scale.Price = models.Money(value)
+	} else {
+		scale.Grams = value
+	}
+
+	return scale, nil
+}
+
+// Quantity converts the decoded label into a quantity of the product's base
+// unit. Price labels are converted back to a quantity using the unit price.
+func (b *ScaleBarcode) Quantity(product *models.Product) (models.Quantity, error) {
+	if b.IsPrice {
+		if product.Price <= 0 {
+			return 0, fmt.Errorf("product %d has no price to derive quantity", product.ID)
+		}
+		return models.Quantity((int64(b.Price)*models.QuantityScale + int64(product.Price)/2) / int64(product.Price)), nil
+	}
+
+	switch product.BaseUnit {
+	case "g", "gr", "gram":
+		return models.NewQuantity(int64(b.Grams)), nil
+	case "kg":
+		// grams are thousandths of a kilogram
+		return models.Quantity(b.Grams), nil
+	default:
+		return 0, fmt.Errorf("product %d base unit %s cannot be weighed", product.ID, product.BaseUnit)
+	}
+}
+
+func validEAN13(code string) bool {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(code[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	check := (10 - sum%10) % 10
+	return check == int(code[12]-'0')
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
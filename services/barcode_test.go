@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+
+	"kasir-api/models"
+)
+
+func TestValidEAN13(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"8999999123451", true},
+		{"2000123012506", true},
+		{"8999999123452", false},
+		{"2000123012505", false},
+		{"0000000000000", true},
+	}
+	for _, tt := range tests {
+		if got := validEAN13(tt.code); got != tt.want {
+			t.Errorf("validEAN13(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestIsScaleBarcode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"2000123012506", true},
+		{"2900123000001", true},
+		{"8999999123451", false},
+		{"200012301250", false},
+		{"20001230125060", false},
+		{"2000123O12506", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsScaleBarcode(tt.code); got != tt.want {
+			t.Errorf("IsScaleBarcode(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestParseScaleBarcode(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    ScaleBarcode
+		wantErr bool
+	}{
+		{"2000123012506", ScaleBarcode{ItemCode: "00123", Grams: 1250}, false},
+		{"2400123015000", ScaleBarcode{ItemCode: "00123", Grams: 1500}, false},
+		{"2200001007505", ScaleBarcode{ItemCode: "00001", Grams: 750}, false},
+		{"2500123125003", ScaleBarcode{ItemCode: "00123", Price: 12500, IsPrice: true}, false},
+		{"2900123000001", ScaleBarcode{ItemCode: "00123", Price: 0, IsPrice: true}, false},
+		{"2000123012505", ScaleBarcode{}, true},
+		{"8999999123451", ScaleBarcode{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := ParseScaleBarcode(tt.code)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseScaleBarcode(%q) = %+v, want an error", tt.code, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseScaleBarcode(%q): %v", tt.code, err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseScaleBarcode(%q) = %+v, want %+v", tt.code, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleBarcodeQuantity(t *testing.T) {
+	tests := []struct {
+		name    string
+		label   ScaleBarcode
+		product models.Product
+		want    models.Quantity
+		wantErr bool
+	}{
+		{"grams in kg", ScaleBarcode{Grams: 1250}, models.Product{BaseUnit: "kg"}, 1250, false},
+		{"grams in gram", ScaleBarcode{Grams: 750}, models.Product{BaseUnit: "gram"}, models.NewQuantity(750), false},
+		{"grams in g", ScaleBarcode{Grams: 5}, models.Product{BaseUnit: "g"}, models.NewQuantity(5), false},
+		{"grams of pieces", ScaleBarcode{Grams: 500}, models.Product{BaseUnit: "pcs"}, 0, true},
+		{"price", ScaleBarcode{Price: 12500, IsPrice: true}, models.Product{Price: 10000, BaseUnit: "kg"}, 1250, false},
+		{"price rounds to grams", ScaleBarcode{Price: 10000, IsPrice: true}, models.Product{Price: 30000, BaseUnit: "kg"}, 333, false},
+		{"price without unit price", ScaleBarcode{Price: 12500, IsPrice: true}, models.Product{BaseUnit: "kg"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.label.Quantity(&tt.product)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Quantity = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Quantity = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"kasir-api/models"
+	"kasir-api/repositories"
+)
+
+type BatchService struct {
+	repo *repositories.BatchRepository
+}
+
+func NewBatchService(repo *repositories.BatchRepository) *BatchService {
+	return &BatchService{repo: repo}
+}
+
+func (s *BatchService) GetByProduct(productID int) ([]models.StockBatch, error) {
+	return s.repo.GetByProduct(productID)
+}
+
+func (s *BatchService) GetExpiring(days int) ([]models.StockBatch, error) {
+	if days < 0 {
+		days = 0
+	}
+	return s.repo.GetExpiring(days)
+}
+
+func (s *BatchService) WriteOff(batchID int, reason string) (*models.StockWriteOff, error) {
+	if reason == "" {
+		reason = "expired"
+	}
+	return s.repo.WriteOff(batchID, reason)
+}
+
+func (s *BatchService) WriteOffExpired() ([]models.StockWriteOff, error) {
+	return s.repo.WriteOffExpired("expired")
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/repositories"
+)
+
+type CartService struct {
+	repo               *repositories.CartRepository
+	transactionService *TransactionService
+	productService     *ProductService
+}
+
+func NewCartService(repo *repositories.CartRepository, transactionService *TransactionService, productService *ProductService) *CartService {
+	return &CartService{repo: repo, transactionService: transactionService, productService: productService}
+}
+
+func (s *CartService) GetAll(storeID int, status string) ([]models.Cart, error) {
+	return s.repo.GetAll(storeID, status)
+}
+
+func (s *CartService) GetByID(id int) (*models.Cart, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *CartService) Create(cart *models.Cart) error {
+	cart.Name = strings.TrimSpace(cart.Name)
+	return s.repo.Create(cart)
+}
+
+func (s *CartService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+// AddItem adds a product, by product_id or scanned barcode, to an open cart.
+// Quantity defaults to 1.
+func (s *CartService) AddItem(id int, item models.CheckoutItem) (*models.Cart, error) {
+	item.Unit = strings.TrimSpace(strings.ToLower(item.Unit))
+	if err := resolveScannedItem(s.productService, &item); err != nil {
+		return nil, err
+	}
+	if item.ProductID == 0 {
+		return nil, errors.New("product_id atau barcode wajib diisi")
+	}
+	if item.Quantity == 0 {
+		item.Quantity = models.NewQuantity(1)
+	}
+	if item.Quantity < 0 {
+		return nil, errors.New("quantity harus lebih dari 0")
+	}
+	return s.repo.AddItem(id, item)
+}
+
+func (s *CartService) UpdateItem(id, itemID int, quantity models.Quantity) (*models.Cart, error) {
+	if quantity < 0 {
+		return nil, errors.New("quantity tidak boleh negatif")
+	}
+	return s.repo.UpdateItem(id, itemID, quantity)
+}
+
+func (s *CartService) RemoveItem(id, itemID int) (*models.Cart, error) {
+	return s.repo.RemoveItem(id, itemID)
+}
+
+func (s *CartService) Hold(id int) (*models.Cart, error) {
+	return s.repo.Hold(id)
+}
+
+func (s *CartService) Resume(id int) (*models.Cart, error) {
+	return s.repo.Resume(id)
+}
+
+func (s *CartService) Recalculate(id int) (*models.Cart, error) {
+	return s.repo.Recalculate(id)
+}
+
+// Checkout finalizes an open cart through the regular checkout at the
+// store's current prices. Checking out the same cart again returns its
+// transaction; payment.IdempotencyKey makes a retry replay it like a
+// regular checkout.
+func (s *CartService) Checkout(id int, payment models.CheckoutRequest) (*models.Transaction, error) {
+	req := models.CheckoutRequest{
+		CartID:         id,
+		PaymentMethod:  payment.PaymentMethod,
+		PaidAmount:     payment.PaidAmount,
+		IdempotencyKey: payment.IdempotencyKey,
+	}
+	if err := normalizePayment(&req); err != nil {
+		return nil, err
+	}
+
+	if req.IdempotencyKey != "" {
+		hash, err := checkoutHash(req)
+		if err != nil {
+			return nil, err
+		}
+		req.RequestHash = hash
+	}
+	return s.transactionService.createTransaction(req)
+}
@@ -13,8 +13,40 @@ func NewCategoryService(repo *repositories.CategoryRepository) *CategoryService
 	return &CategoryService{repo: repo}
 }
 
-func (s *CategoryService) GetAll() ([]models.Category, error) {
-	return s.repo.GetAll()
+// GetAll lists a page of categories.
+func (s *CategoryService) GetAll(query models.CategoryQuery) ([]models.Category, *models.PageInfo, error) {
+	if err := validateListQuery(query.ListQuery); err != nil {
+		return nil, nil, err
+	}
+	return s.repo.GetAll(query)
+}
+
+// Tree returns all categories as a tree, each level sorted by name.
+func (s *CategoryService) Tree() ([]models.CategoryNode, error) {
+	categories, _, err := s.repo.GetAll(models.CategoryQuery{ListQuery: models.ListQuery{Sort: "name"}})
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]models.Category)
+	roots := make([]models.Category, 0)
+	for _, c := range categories {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+			continue
+		}
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+
+	var build func([]models.Category) []models.CategoryNode
+	build = func(level []models.Category) []models.CategoryNode {
+		nodes := make([]models.CategoryNode, len(level))
+		for i, c := range level {
+			nodes[i] = models.CategoryNode{Category: c, Children: build(children[c.ID])}
+		}
+		return nodes
+	}
+	return build(roots), nil
 }
 
 func (s *CategoryService) Create(data *models.Category) error {
@@ -32,3 +64,9 @@ func (s *CategoryService) Update(category *models.Category) error {
 func (s *CategoryService) Delete(id int) error {
 	return s.repo.Delete(id)
 }
+
+// Move puts a category with its subcategories under another category, or at
+// the top level.
+func (s *CategoryService) Move(id int, move models.CategoryMove) (*models.Category, error) {
+	return s.repo.Move(id, move.ParentID)
+}
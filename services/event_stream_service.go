@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kasir-api/models"
+	"kasir-api/outbox"
+	"kasir-api/repositories"
+)
+
+// Message kinds a stream client can filter on; exact event types such as
+// transaction.paid work as well.
+const (
+	StreamTransactions = "transaction"
+	StreamStock        = "stock"
+	StreamTotals       = "totals"
+)
+
+const (
+	streamPollEvery = time.Second
+	streamBatchSize = 500
+	// streamGapWait is how long an id missing below newer events is waited
+	// for; a checkout still committing fills it, a rolled back one never does
+	streamGapWait = 10 * time.Second
+	// streamBuffer messages may wait for a slow client before it is dropped
+	streamBuffer = 256
+)
+
+// StreamMessage is one Server-Sent Event. Events from the outbox carry their
+// outbox id, which clients send back in Last-Event-ID; totals have none.
+type StreamMessage struct {
+	ID      int64
+	Event   string
+	StoreID int
+	Data    []byte
+}
+
+// StreamFilter selects what a client gets: the kinds or event types in Types
+// (everything when empty), and only StoreID's messages unless it is 0.
+// Totals are StoreID's, or consolidated over all stores when it is 0.
+type StreamFilter struct {
+	Types   []string
+	StoreID int
+}
+
+func (f StreamFilter) wants(kind, eventType string) bool {
+	return len(f.Types) == 0 || slices.Contains(f.Types, kind) || slices.Contains(f.Types, eventType)
+}
+
+func (f StreamFilter) match(m StreamMessage) bool {
+	if m.Event == StreamTotals {
+		return f.wants(StreamTotals, StreamTotals) && m.StoreID == f.StoreID
+	}
+	return f.wants(streamKind(m.Event), m.Event) && (f.StoreID == 0 || m.StoreID == f.StoreID)
+}
+
+// streamKind is the kind of a streamed event type, "" for events not streamed.
+func streamKind(eventType string) string {
+	switch eventType {
+	case models.EventTransactionCreated, models.EventTransactionPaid:
+		return StreamTransactions
+	case models.EventStockChanged, models.EventStockLow:
+		return StreamStock
+	}
+	return ""
+}
+
+// StreamSubscription receives the messages matching its filter on C. C is
+// closed when the client fell too far behind; it should reconnect with the
+// last id it got.
+type StreamSubscription struct {
+	filter StreamFilter
+	C      chan StreamMessage
+}
+
+// EventStreamService fans the events committed to the outbox out to the
+// connected stream clients, along with the running daily totals. It reads the
+// outbox table itself, so every server streams every event, whichever server
+// made the change.
+type EventStreamService struct {
+	repo               *repositories.OutboxRepository
+	storeRepo          *repositories.StoreRepository
+	transactionService *TransactionService
+
+	mu   sync.Mutex
+	subs map[*StreamSubscription]struct{}
+
+	// Read position, only used by Run: every id up to cursor was streamed
+	// or given up; ids above it already streamed are in seen
+	cursor  int64
+	maxSeen int64
+	seen    map[int64]bool
+	gaps    map[int64]time.Time
+}
+
+func NewEventStreamService(repo *repositories.OutboxRepository, storeRepo *repositories.StoreRepository, transactionService *TransactionService) *EventStreamService {
+	return &EventStreamService{
+		repo:               repo,
+		storeRepo:          storeRepo,
+		transactionService: transactionService,
+		subs:               make(map[*StreamSubscription]struct{}),
+		seen:               make(map[int64]bool),
+		gaps:               make(map[int64]time.Time),
+	}
+}
+
+// Subscribe starts receiving the messages matching filter; call Unsubscribe
+// when the client goes away.
+func (s *EventStreamService) Subscribe(filter StreamFilter) (*StreamSubscription, error) {
+	for i, t := range filter.Types {
+		t = strings.TrimSpace(strings.ToLower(t))
+		if t != StreamTransactions && t != StreamStock && t != StreamTotals && streamKind(t) == "" {
+			return nil, fmt.Errorf("tipe event %s tidak dikenal", t)
+		}
+		filter.Types[i] = t
+	}
+	if filter.StoreID != 0 {
+		if _, err := s.storeRepo.GetByID(filter.StoreID); err != nil {
+			return nil, err
+		}
+	}
+
+	sub := &StreamSubscription{filter: filter, C: make(chan StreamMessage, streamBuffer)}
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	return sub, nil
+}
+
+func (s *EventStreamService) Unsubscribe(sub *StreamSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		close(sub.C)
+	}
+}
+
+// Replay passes the stored events after afterID that match the
+// subscription's filter to send, oldest first, for a client reconnecting
+// with Last-Event-ID.
+func (s *EventStreamService) Replay(sub *StreamSubscription, afterID int64, send func(StreamMessage) error) error {
+	for {
+		events, err := s.repo.After(afterID, streamBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			afterID = e.ID
+			m, ok := streamMessage(e)
+			if !ok || !sub.filter.match(m) {
+				continue
+			}
+			if err := send(m); err != nil {
+				return err
+			}
+		}
+		if len(events) < streamBatchSize {
+			return nil
+		}
+	}
+}
+
+// Totals returns today's totals for the subscription, or nil when it does
+// not want them.
+func (s *EventStreamService) Totals(sub *StreamSubscription) (*StreamMessage, error) {
+	if !sub.filter.wants(StreamTotals, StreamTotals) {
+		return nil, nil
+	}
+	return s.totals(sub.filter.StoreID)
+}
+
+func (s *EventStreamService) totals(storeID int) (*StreamMessage, error) {
+	summary, err := s.transactionService.GetTodaySummary(storeID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamMessage{Event: StreamTotals, StoreID: storeID, Data: data}, nil
+}
+
+// Run streams new outbox events until ctx is cancelled. Events committed
+// before it started are only sent as replays.
+func (s *EventStreamService) Run(ctx context.Context) {
+	ticker := time.NewTicker(streamPollEvery)
+	defer ticker.Stop()
+
+	started := false
+	for {
+		if !started {
+			cursor, err := s.repo.LastID()
+			if err != nil {
+				log.Printf("event stream: %v\n", err)
+			} else {
+				s.cursor, s.maxSeen, started = cursor, cursor, true
+			}
+		}
+		if started {
+			if err := s.poll(); err != nil {
+				log.Printf("event stream: %v\n", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *EventStreamService) poll() error {
+	events, err := s.repo.After(s.cursor, streamBatchSize)
+	if err != nil {
+		return err
+	}
+
+	// Stores whose totals changed; 0 is the consolidated total
+	changed := make(map[int]bool)
+	for _, e := range events {
+		if s.seen[e.ID] {
+			continue
+		}
+		s.seen[e.ID] = true
+		s.maxSeen = max(s.maxSeen, e.ID)
+
+		m, ok := streamMessage(e)
+		if !ok {
+			continue
+		}
+		s.broadcast(m)
+		if isPaidSale(e) {
+			changed[0], changed[m.StoreID] = true, true
+		}
+	}
+	s.advance()
+
+	for storeID := range changed {
+		if !s.wanted(storeID) {
+			continue
+		}
+		m, err := s.totals(storeID)
+		if err != nil {
+			return err
+		}
+		s.broadcast(*m)
+	}
+	return nil
+}
+
+// advance moves the cursor over the ids streamed in order. Outbox ids are
+// taken before commit, so a missing id below a streamed one may still show
+// up; it is waited for a while before being given up.
+func (s *EventStreamService) advance() {
+	now := time.Now()
+	for s.cursor < s.maxSeen {
+		next := s.cursor + 1
+		if s.seen[next] {
+			delete(s.seen, next)
+			s.cursor = next
+			continue
+		}
+		since, ok := s.gaps[next]
+		if !ok {
+			s.gaps[next] = now
+			return
+		}
+		if now.Sub(since) < streamGapWait {
+			return
+		}
+		delete(s.gaps, next)
+		s.cursor = next
+	}
+}
+
+// wanted reports whether any client wants the totals of a store.
+func (s *EventStreamService) wanted(storeID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if sub.filter.StoreID == storeID && sub.filter.wants(StreamTotals, StreamTotals) {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast hands a message to every matching client. A client whose buffer
+// is full is dropped rather than holding up everyone else.
+func (s *EventStreamService) broadcast(m StreamMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if !sub.filter.match(m) {
+			continue
+		}
+		select {
+		case sub.C <- m:
+		default:
+			delete(s.subs, sub)
+			close(sub.C)
+		}
+	}
+}
+
+// streamData is the part of a streamed event's payload the stream looks at.
+type streamData struct {
+	Data struct {
+		StoreID int    `json:"store_id"`
+		Status  string `json:"status"`
+	} `json:"data"`
+}
+
+// streamMessage turns an outbox event into a stream message; false for
+// events that are not streamed.
+func streamMessage(e outbox.Event) (StreamMessage, bool) {
+	if streamKind(e.Type) == "" {
+		return StreamMessage{}, false
+	}
+	var d streamData
+	if err := json.Unmarshal(e.Payload, &d); err != nil {
+		return StreamMessage{}, false
+	}
+	return StreamMessage{ID: e.ID, Event: e.Type, StoreID: d.Data.StoreID, Data: e.Payload}, true
+}
+
+// isPaidSale reports whether an event adds a sale to the daily totals.
+func isPaidSale(e outbox.Event) bool {
+	switch e.Type {
+	case models.EventTransactionPaid:
+		return true
+	case models.EventTransactionCreated:
+		var d streamData
+		return json.Unmarshal(e.Payload, &d) == nil && d.Data.Status == models.TransactionPaid
+	}
+	return false
+}
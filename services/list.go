@@ -0,0 +1,25 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"kasir-api/models"
+)
+
+// MaxPageSize is the largest page a listing returns.
+const MaxPageSize = 500
+
+// validateListQuery checks the paging of a listing.
+func validateListQuery(query models.ListQuery) error {
+	if query.Limit < 0 || query.Offset < 0 {
+		return errors.New("limit dan offset tidak valid")
+	}
+	if query.Limit > MaxPageSize {
+		return fmt.Errorf("limit tidak valid, maksimal %d", MaxPageSize)
+	}
+	if query.Offset > 0 && query.After != "" {
+		return errors.New("offset dan after tidak valid bersama, gunakan salah satu")
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/spreadsheet"
+)
+
+// MaxImportRows is the most product rows one import may have.
+const MaxImportRows = 5000
+
+// importFields are the fields an import column can hold, with the headers
+// recognized for them when no mapping is given. Headers are compared
+// case-insensitively, with underscores read as spaces.
+var importFields = []struct {
+	field   string
+	headers []string
+}{
+	{"sku", []string{"sku", "kode", "kode barang", "kode produk", "plu"}},
+	{"name", []string{"name", "nama", "nama barang", "nama produk", "produk"}},
+	{"price", []string{"price", "harga", "harga jual"}},
+	{"stock", []string{"stock", "stok", "qty", "jumlah"}},
+	{"base_unit", []string{"base unit", "unit", "satuan", "satuan dasar"}},
+	{"sold_by_weight", []string{"sold by weight", "timbang", "dijual per berat"}},
+	{"barcode", []string{"barcode", "ean", "kode barcode"}},
+	{"category", []string{"category", "kategori"}},
+}
+
+// Column length limits, as in the products table
+var importMaxLength = map[string]int{
+	"sku":       64,
+	"name":      255,
+	"base_unit": 20,
+	"barcode":   32,
+	"category":  255,
+}
+
+var (
+	// 15.000 or 1.250.000, the Indonesian way
+	dotThousands = regexp.MustCompile(`^-?\d{1,3}(\.\d{3})+$`)
+	// 15,000 or 1,250,000.00
+	commaThousands = regexp.MustCompile(`^-?\d{1,3}(,\d{3})+(\.\d+)?$`)
+	// 15000,00
+	decimalComma = regexp.MustCompile(`^-?\d+,\d+$`)
+)
+
+// Import creates and updates products from a CSV or XLSX file (format "csv"
+// or "xlsx", detected when empty). The first non-empty row holds the
+// headers; mapping maps a field to the header, or the column letter, that
+// holds it, and fields left out of it are found by their usual headers.
+// match selects whether rows are matched on sku or name; it defaults to sku
+// when the file has a SKU column.
+//
+// Rows that cannot be read are reported along with the rows the database
+// rejects, and then nothing is applied.
+func (s *ProductService) Import(data []byte, format string, mapping map[string]string, match string, dryRun bool) (*models.ImportResult, error) {
+	sheet, err := spreadsheet.Read(data, format, MaxImportRows+1)
+	if errors.Is(err, spreadsheet.ErrTooManyRows) {
+		return nil, fmt.Errorf("file import maksimal %d baris produk", MaxImportRows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file import tidak dapat dibaca: %w", err)
+	}
+
+	headerRow := 0
+	for headerRow < len(sheet) && isBlankRow(sheet[headerRow]) {
+		headerRow++
+	}
+	if headerRow == len(sheet) {
+		return nil, errors.New("file import kosong")
+	}
+
+	columns, err := importColumns(sheet[headerRow], mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	match = strings.TrimSpace(strings.ToLower(match))
+	if match == "" {
+		match = models.ImportMatchName
+		if _, ok := columns["sku"]; ok {
+			match = models.ImportMatchSKU
+		}
+	}
+	if match != models.ImportMatchSKU && match != models.ImportMatchName {
+		return nil, errors.New("match harus sku atau name")
+	}
+	if _, ok := columns[match]; !ok {
+		return nil, fmt.Errorf("kolom %s tidak ditemukan, dibutuhkan untuk mencocokkan produk", match)
+	}
+
+	rows := make([]models.ProductImportRow, 0)
+	rowErrors := make([]models.ImportError, 0)
+	total := 0
+	for i := headerRow + 1; i < len(sheet); i++ {
+		if isBlankRow(sheet[i]) {
+			continue
+		}
+		total++
+		row, errs := parseImportRow(i+1, sheet[i], columns)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, errs...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if total == 0 {
+		return nil, errors.New("file import tidak berisi data produk")
+	}
+
+	// Rows that could not be read still leave the others to be checked
+	// against the database, but nothing is applied
+	result, err := s.repo.Import(rows, match, dryRun || len(rowErrors) > 0)
+	if err != nil {
+		return nil, err
+	}
+	result.DryRun = dryRun
+	result.Rows = total
+	result.Errors = append(result.Errors, rowErrors...)
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Row < result.Errors[j].Row
+	})
+
+	return result, nil
+}
+
+// importColumns finds the column of each field present in the file.
+func importColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	byHeader := make(map[string]int)
+	for i, h := range header {
+		h = normalizeHeader(h)
+		if _, ok := byHeader[h]; !ok && h != "" {
+			byHeader[h] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	for field, column := range mapping {
+		if !isImportField(field) {
+			return nil, fmt.Errorf("mapping: field %s tidak dikenal", field)
+		}
+		if i, ok := byHeader[normalizeHeader(column)]; ok {
+			columns[field] = i
+			continue
+		}
+		if i, ok := spreadsheet.ColumnIndex(column); ok {
+			columns[field] = i
+			continue
+		}
+		return nil, fmt.Errorf("mapping: kolom %q untuk %s tidak ditemukan", column, field)
+	}
+
+	for _, f := range importFields {
+		if _, ok := mapping[f.field]; ok {
+			continue
+		}
+		for _, h := range f.headers {
+			if i, ok := byHeader[h]; ok {
+				columns[f.field] = i
+				break
+			}
+		}
+	}
+
+	if _, ok := columns["sku"]; !ok {
+		if _, ok := columns["name"]; !ok {
+			return nil, errors.New("file import harus memiliki kolom sku atau nama produk")
+		}
+	}
+	return columns, nil
+}
+
+func isImportField(field string) bool {
+	for _, f := range importFields {
+		if f.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHeader(h string) string {
+	h = strings.ReplaceAll(strings.ToLower(h), "_", " ")
+	return strings.Join(strings.Fields(h), " ")
+}
+
+func isBlankRow(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseImportRow reads the mapped cells of a row; empty cells stay nil.
+func parseImportRow(number int, cells []string, columns map[string]int) (models.ProductImportRow, []models.ImportError) {
+	row := models.ProductImportRow{Row: number}
+	errs := make([]models.ImportError, 0)
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, models.ImportError{Row: number, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Read after the loop: whether "1.000" is a thousand depends on
+	// sold_by_weight
+	stockValue := ""
+	for _, f := range importFields {
+		i, ok := columns[f.field]
+		if !ok || i >= len(cells) {
+			continue
+		}
+		value := strings.TrimSpace(cells[i])
+		if value == "" {
+			continue
+		}
+		if limit, ok := importMaxLength[f.field]; ok && len([]rune(value)) > limit {
+			fail(f.field, "%s maksimal %d karakter", f.field, limit)
+			continue
+		}
+
+		switch f.field {
+		case "sku":
+			row.SKU = &value
+		case "name":
+			row.Name = &value
+		case "price":
+			price, err := parseImportMoney(value)
+			if err != nil || price < 0 {
+				fail(f.field, "harga %q tidak valid", value)
+				continue
+			}
+			row.Price = &price
+		case "stock":
+			stockValue = value
+		case "base_unit":
+			unit := strings.ToLower(value)
+			row.BaseUnit = &unit
+		case "sold_by_weight":
+			byWeight, ok := parseImportBool(value)
+			if !ok {
+				fail(f.field, "sold_by_weight %q harus ya atau tidak", value)
+				continue
+			}
+			row.SoldByWeight = &byWeight
+		case "barcode":
+			row.Barcode = &value
+		case "category":
+			row.Category = &value
+		}
+	}
+
+	if stockValue != "" {
+		stock, err := parseImportQuantity(stockValue, row.SoldByWeight)
+		switch {
+		case errors.Is(err, errAmbiguousQuantity):
+			fail("stock", "stok %q ambigu: tulis tanpa titik ribuan atau isi kolom sold_by_weight", stockValue)
+		case err != nil || stock < 0:
+			fail("stock", "stok %q tidak valid", stockValue)
+		default:
+			row.Stock = &stock
+		}
+	}
+
+	return row, errs
+}
+
+// parseImportMoney reads a price as spreadsheets write it: "15000",
+// "Rp 15.000", "15,000" or "15000,00".
+func parseImportMoney(s string) (models.Money, error) {
+	s = strings.TrimSpace(s)
+	for _, prefix := range []string{"Rp.", "Rp", "rp.", "rp", "RP", "IDR"} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+
+	switch {
+	case dotThousands.MatchString(s):
+		s = strings.ReplaceAll(s, ".", "")
+	case commaThousands.MatchString(s):
+		s = strings.ReplaceAll(s, ",", "")
+	case decimalComma.MatchString(s):
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return models.ParseMoney(s)
+}
+
+var errAmbiguousQuantity = errors.New("ambiguous quantity")
+
+// parseImportQuantity reads a stock quantity with a decimal point or comma.
+// Dots group thousands as in prices ("1.000" is a thousand) unless the
+// product is sold by weight, where "1.250" is a kilogram and a quarter.
+// With a single dot group and soldByWeight unknown the value is ambiguous.
+func parseImportQuantity(s string, soldByWeight *bool) (models.Quantity, error) {
+	if dotThousands.MatchString(s) {
+		switch {
+		case soldByWeight != nil && *soldByWeight:
+			// a decimal point
+		case soldByWeight == nil && strings.Count(s, ".") == 1:
+			return 0, errAmbiguousQuantity
+		default:
+			s = strings.ReplaceAll(s, ".", "")
+		}
+	}
+	if decimalComma.MatchString(s) {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return models.ParseQuantity(s)
+}
+
+func parseImportBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "1", "true", "ya", "y", "yes", "benar":
+		return true, true
+	case "0", "false", "tidak", "t", "no", "n", "salah":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"kasir-api/models"
+)
+
+func TestParseImportMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    models.Money
+		wantErr bool
+	}{
+		{"15000", 15000, false},
+		{"Rp 15.000", 15000, false},
+		{"Rp.1.250.000", 1250000, false},
+		{"IDR 15,000", 15000, false},
+		{"15,000.00", 15000, false},
+		{"15000,00", 15000, false},
+		{"15.000,5", 0, true},
+		{"lima ribu", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseImportMoney(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportMoney(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseImportMoney(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportQuantity(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name         string
+		in           string
+		soldByWeight *bool
+		want         models.Quantity
+		wantErr      error
+	}{
+		{"whole", "24", nil, models.NewQuantity(24), nil},
+		{"decimal comma", "2,5", nil, 2500, nil},
+		{"thousands of pieces", "1.000", &no, models.NewQuantity(1000), nil},
+		{"millions of pieces", "1.250.000", nil, models.NewQuantity(1250000), nil},
+		{"weighed decimal point", "1.250", &yes, 1250, nil},
+		{"weighed decimal comma", "1,25", &yes, 1250, nil},
+		{"ambiguous", "1.000", nil, 0, errAmbiguousQuantity},
+		{"short decimal is not thousands", "1.5", nil, 1500, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImportQuantity(tt.in, tt.soldByWeight)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseImportQuantity(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseImportQuantity(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"kasir-api/models"
+)
+
+// DefaultSearchLimit is the page size of a search without ?limit=.
+const DefaultSearchLimit = 20
+
+// maxSearchLength bounds the search text, maxSearchTerms its words.
+const (
+	maxSearchLength = 100
+	maxSearchTerms  = 8
+)
+
+// Search finds products by name, SKU, barcode or category as the cashier
+// types: every word may be the start of a word ("indom gor"), and a word
+// with a typo ("indomei") still finds the product by similarity.
+func (s *ProductService) Search(query models.ProductQuery, text string) ([]models.ProductSearchResult, *models.PageInfo, error) {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxSearchLength {
+		return nil, nil, errors.New("kata kunci pencarian tidak valid, terlalu panjang")
+	}
+	terms := searchTerms(text)
+	if len(terms) == 0 {
+		return nil, nil, errors.New("kata kunci pencarian tidak valid, isi q")
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultSearchLimit
+	}
+	if err := validateProductQuery(query); err != nil {
+		return nil, nil, err
+	}
+
+	results, page, err := s.repo.Search(query, terms, text)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range results {
+		results[i].Highlight = highlightProduct(results[i].Product, terms)
+	}
+	return results, page, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// searchTerms splits the search text into lowercase words, as the database
+// splits what it searches.
+func searchTerms(text string) []string {
+	terms := make([]string, 0)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !isWordRune(r) }) {
+		if len(terms) == maxSearchTerms {
+			break
+		}
+		if !slices.Contains(terms, word) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// highlightProduct marks the search terms in the fields of a product they
+// start a word of. Fields found only by similarity get no highlight.
+func highlightProduct(p models.Product, terms []string) map[string]string {
+	fields := []struct{ name, value string }{
+		{"name", p.Name},
+		{"sku", p.SKU},
+		{"barcode", p.Barcode},
+		{"category_name", p.CategoryName},
+	}
+	var highlight map[string]string
+	for _, f := range fields {
+		marked, ok := highlightText(f.value, terms)
+		if !ok {
+			continue
+		}
+		if highlight == nil {
+			highlight = make(map[string]string)
+		}
+		highlight[f.name] = marked
+	}
+	return highlight
+}
+
+// highlightText HTML-escapes s, wrapping in <mark> the start of each word
+// that a term is a prefix of; false when no term was found.
+func highlightText(s string, terms []string) (string, bool) {
+	var b strings.Builder
+	found := false
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !isWordRune(r) {
+			b.WriteString(html.EscapeString(s[i : i+size]))
+			i += size
+			continue
+		}
+
+		j := i
+		for j < len(s) {
+			r, size := utf8.DecodeRuneInString(s[j:])
+			if !isWordRune(r) {
+				break
+			}
+			j += size
+		}
+		word := s[i:j]
+		i = j
+
+		n := matchedPrefix(word, terms)
+		if n == 0 {
+			b.WriteString(html.EscapeString(word))
+			continue
+		}
+		found = true
+		b.WriteString("<mark>" + html.EscapeString(word[:n]) + "</mark>" + html.EscapeString(word[n:]))
+	}
+	return b.String(), found
+}
+
+// matchedPrefix is the length in bytes of the longest start of word that is
+// one of the terms, ignoring case.
+func matchedPrefix(word string, terms []string) int {
+	runes := []rune(word)
+	longest := 0
+	for _, term := range terms {
+		n := utf8.RuneCountInString(term)
+		if n > len(runes) || n <= longest {
+			continue
+		}
+		if strings.ToLower(string(runes[:n])) == term {
+			longest = n
+		}
+	}
+	return len(string(runes[:longest]))
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"kasir-api/models"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"indom gor", []string{"indom", "gor"}},
+		{"  Indomie   GORENG ", []string{"indomie", "goreng"}},
+		{"teh-botol 350ml", []string{"teh", "botol", "350ml"}},
+		{"kopi kopi Kopi", []string{"kopi"}},
+		{"Kécap manis", []string{"kécap", "manis"}},
+		{"a's & b's", []string{"a", "s", "b"}},
+		{"1 2 3 4 5 6 7 8 9 10", []string{"1", "2", "3", "4", "5", "6", "7", "8"}},
+		{"--- ***", []string{}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := searchTerms(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("searchTerms(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHighlightText(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         string
+		terms     []string
+		want      string
+		wantFound bool
+	}{
+		{"prefixes", "Indomie Goreng", []string{"indom", "gor"}, "<mark>Indom</mark>ie <mark>Gor</mark>eng", true},
+		{"whole word", "Teh Botol", []string{"teh"}, "<mark>Teh</mark> Botol", true},
+		{"longest term wins", "Kopi Kapal Api", []string{"ka", "kapal"}, "Kopi <mark>Kapal</mark> Api", true},
+		{"only word starts", "Mie Sedaap", []string{"daap"}, "Mie Sedaap", false},
+		{"no match", "Gula Pasir", []string{"beras"}, "Gula Pasir", false},
+		{"escaped", "Roti <Tawar> & Selai", []string{"tawar"}, "Roti &lt;<mark>Tawar</mark>&gt; &amp; Selai", true},
+		{"multibyte", "Kécap Manis", []string{"kéc"}, "<mark>Kéc</mark>ap Manis", true},
+		{"codes", "SKU-00123", []string{"001"}, "SKU-<mark>001</mark>23", true},
+		{"empty", "", []string{"a"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := highlightText(tt.s, tt.terms)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("highlightText(%q, %q) = %q, %v, want %q, %v", tt.s, tt.terms, got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestHighlightProduct(t *testing.T) {
+	p := models.Product{Name: "Indomie Goreng", SKU: "IDM-01", Barcode: "8998866200301", CategoryName: "Mie Instan"}
+	tests := []struct {
+		name  string
+		terms []string
+		want  map[string]string
+	}{
+		{"category, not inside a word", []string{"mi"}, map[string]string{"category_name": "<mark>Mi</mark>e Instan"}},
+		{"name", []string{"gor"}, map[string]string{"name": "Indomie <mark>Gor</mark>eng"}},
+		{"sku", []string{"idm"}, map[string]string{"sku": "<mark>IDM</mark>-01"}},
+		{"barcode", []string{"8998"}, map[string]string{"barcode": "<mark>8998</mark>866200301"}},
+		{"similarity only", []string{"indomei"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlightProduct(p, tt.terms); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("highlightProduct(%q) = %q, want %q", tt.terms, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package services
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"kasir-api/models"
 	"kasir-api/repositories"
 )
@@ -13,11 +17,41 @@ func NewProductService(repo *repositories.ProductRepository) *ProductService {
 	return &ProductService{repo: repo}
 }
 
-func (s *ProductService) GetAll(name string) ([]models.Product, error) {
-	return s.repo.GetAll(name)
+// GetAll lists a page of products with the price and stock at the query's
+// store (0 for the default store).
+func (s *ProductService) GetAll(query models.ProductQuery) ([]models.Product, *models.PageInfo, error) {
+	if err := validateProductQuery(query); err != nil {
+		return nil, nil, err
+	}
+	return s.repo.GetAll(query)
+}
+
+// Export streams the products matching the query's filters to fn, with the
+// stock and price at its store.
+func (s *ProductService) Export(query models.ProductQuery, fn func(models.Product) error) error {
+	query.ListQuery = models.ListQuery{Sort: query.Sort}
+	if err := validateProductQuery(query); err != nil {
+		return err
+	}
+	return s.repo.Export(query, fn)
+}
+
+func validateProductQuery(query models.ProductQuery) error {
+	if err := validateListQuery(query.ListQuery); err != nil {
+		return err
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return errors.New("min_price tidak valid, lebih besar dari max_price")
+	}
+	return nil
 }
 
 func (s *ProductService) Create(data *models.Product) error {
+	normalizeBaseUnit(data)
+	data.SKU = strings.TrimSpace(data.SKU)
+	if err := validateStock(data); err != nil {
+		return err
+	}
 	return s.repo.Create(data)
 }
 
@@ -26,9 +60,127 @@ func (s *ProductService) GetByID(id int) (*models.Product, error) {
 }
 
 func (s *ProductService) Update(product *models.Product) error {
+	normalizeBaseUnit(product)
+	product.SKU = strings.TrimSpace(product.SKU)
+	if err := validateStock(product); err != nil {
+		return err
+	}
 	return s.repo.Update(product)
 }
 
 func (s *ProductService) Delete(id int) error {
 	return s.repo.Delete(id)
 }
+
+func (s *ProductService) GetUnits(productID int) ([]models.ProductUnit, error) {
+	return s.repo.GetUnits(productID)
+}
+
+func (s *ProductService) CreateUnit(unit *models.ProductUnit) error {
+	unit.Name = strings.TrimSpace(strings.ToLower(unit.Name))
+	if unit.Name == "" {
+		return errors.New("nama satuan wajib diisi")
+	}
+	if unit.ConversionFactor <= 0 {
+		return errors.New("conversion_factor harus lebih dari 0")
+	}
+	if unit.Price < 0 {
+		return errors.New("harga satuan tidak boleh negatif")
+	}
+
+	product, err := s.repo.GetByID(unit.ProductID)
+	if err != nil {
+		return err
+	}
+	if unit.Name == product.BaseUnit {
+		return errors.New("satuan sudah menjadi satuan dasar produk")
+	}
+
+	return s.repo.CreateUnit(unit)
+}
+
+func (s *ProductService) DeleteUnit(productID, unitID int) error {
+	return s.repo.DeleteUnit(productID, unitID)
+}
+
+func (s *ProductService) ReceiveStock(productID int, receipt models.StockReceipt) (*models.Product, error) {
+	if receipt.Quantity <= 0 {
+		return nil, errors.New("quantity harus lebih dari 0")
+	}
+	receipt.Unit = strings.TrimSpace(strings.ToLower(receipt.Unit))
+	if receipt.ExpiryDate != nil {
+		if _, err := time.Parse("2006-01-02", *receipt.ExpiryDate); err != nil {
+			return nil, errors.New("expiry_date harus berformat YYYY-MM-DD")
+		}
+	}
+
+	product, err := s.repo.GetByID(productID)
+	if err != nil {
+		return nil, err
+	}
+	if !product.SoldByWeight && !receipt.Quantity.IsWhole() {
+		return nil, errors.New("produk tidak dijual per berat, quantity harus bilangan bulat")
+	}
+
+	return s.repo.ReceiveStock(productID, receipt)
+}
+
+// ScanBarcode resolves a scanned code to a product. Scale labels are decoded
+// into the weighed quantity; other barcodes count as one base unit.
+func (s *ProductService) ScanBarcode(code string) (*models.BarcodeScan, error) {
+	scan := &models.BarcodeScan{Barcode: code, ItemCode: code}
+
+	if IsScaleBarcode(code) {
+		scale, err := ParseScaleBarcode(code)
+		if err != nil {
+			return nil, err
+		}
+		product, err := s.repo.GetByBarcode(scale.ItemCode)
+		if err != nil {
+			return nil, err
+		}
+		qty, err := scale.Quantity(product)
+		if err != nil {
+			return nil, err
+		}
+
+		scan.ItemCode = scale.ItemCode
+		scan.Product = product
+		scan.Quantity = qty
+		scan.Subtotal, err = product.Price.MulQuantity(qty)
+		if err != nil {
+			return nil, err
+		}
+		if scale.IsPrice {
+			scan.EmbeddedPrice = &scale.Price
+			scan.Subtotal = scale.Price
+		}
+		return scan, nil
+	}
+
+	product, err := s.repo.GetByBarcode(code)
+	if err != nil {
+		return nil, err
+	}
+	scan.Product = product
+	scan.Quantity = models.NewQuantity(1)
+	scan.Subtotal = product.Price
+
+	return scan, nil
+}
+
+// validateStock rejects fractional stock for products not sold by weight
+func validateStock(product *models.Product) error {
+	if !product.SoldByWeight && !product.Stock.IsWhole() {
+		return errors.New("produk tidak dijual per berat, stock harus bilangan bulat")
+	}
+	return nil
+}
+
+// normalizeBaseUnit defaults the base unit to "pcs" and keeps unit names lowercase
+func normalizeBaseUnit(product *models.Product) {
+	product.BaseUnit = strings.TrimSpace(strings.ToLower(product.BaseUnit))
+	if product.BaseUnit == "" {
+		product.BaseUnit = "pcs"
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"kasir-api/models"
+	"kasir-api/repositories"
+)
+
+// maxReservationTTL caps how long a pending order may hold stock.
+const maxReservationTTL = 7 * 24 * time.Hour
+
+type ReservationService struct {
+	repo *repositories.ReservationRepository
+}
+
+func NewReservationService(repo *repositories.ReservationRepository) *ReservationService {
+	return &ReservationService{repo: repo}
+}
+
+func (s *ReservationService) GetAll(storeID, productID int) ([]models.StockReservation, error) {
+	return s.repo.GetAll(storeID, productID)
+}
+
+func (s *ReservationService) GetByID(id int) (*models.StockReservation, error) {
+	return s.repo.GetByID(id)
+}
+
+// Create reserves stock for a pending order; ttl_minutes defaults to 15.
+func (s *ReservationService) Create(res *models.StockReservation) error {
+	if res.ProductID == 0 {
+		return errors.New("product_id wajib diisi")
+	}
+	if res.Quantity <= 0 {
+		return errors.New("quantity harus lebih dari 0")
+	}
+	if res.TTLMinutes < 0 {
+		return errors.New("ttl_minutes tidak boleh negatif")
+	}
+	res.Unit = strings.TrimSpace(strings.ToLower(res.Unit))
+	res.Reference = strings.TrimSpace(res.Reference)
+
+	ttl := repositories.DefaultReservationTTL
+	if res.TTLMinutes > 0 {
+		ttl = time.Duration(res.TTLMinutes) * time.Minute
+	}
+	if ttl > maxReservationTTL {
+		return errors.New("ttl_minutes terlalu lama (maksimal 7 hari)")
+	}
+
+	return s.repo.Create(res, ttl)
+}
+
+func (s *ReservationService) Release(id int) error {
+	return s.repo.Release(id)
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"kasir-api/invoice"
+	"kasir-api/models"
+	"kasir-api/repositories"
+)
+
+type StoreService struct {
+	repo          *repositories.StoreRepository
+	invoiceFormat invoice.Format
+}
+
+func NewStoreService(repo *repositories.StoreRepository, invoiceFormat invoice.Format) *StoreService {
+	return &StoreService{repo: repo, invoiceFormat: invoiceFormat}
+}
+
+func (s *StoreService) GetAll() ([]models.Store, error) {
+	return s.repo.GetAll()
+}
+
+func (s *StoreService) GetByID(id int) (*models.Store, error) {
+	return s.repo.GetByID(id)
+}
+
+// Create adds a store. There is always a default store already, so the
+// invoice format must tell the stores' numbers apart.
+func (s *StoreService) Create(store *models.Store) error {
+	if err := validateStore(store); err != nil {
+		return err
+	}
+	if !s.invoiceFormat.PerStore() {
+		return errors.New("INVOICE_FORMAT tanpa {STORE} tidak valid untuk lebih dari satu toko, nomor invoice antartoko akan sama")
+	}
+	return s.repo.Create(store)
+}
+
+func (s *StoreService) Update(store *models.Store) error {
+	if err := validateStore(store); err != nil {
+		return err
+	}
+	return s.repo.Update(store)
+}
+
+func (s *StoreService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+func (s *StoreService) GetStock(storeID int) ([]models.StoreProduct, error) {
+	return s.repo.GetStock(storeID)
+}
+
+func (s *StoreService) SetPrice(storeID int, price models.StorePrice) error {
+	if price.Price != nil && *price.Price < 0 {
+		return errors.New("harga tidak boleh negatif")
+	}
+	return s.repo.SetPrice(storeID, price)
+}
+
+func (s *StoreService) ReceiveStock(storeID int, receipt models.StoreStockReceipt) error {
+	if receipt.Quantity <= 0 {
+		return errors.New("quantity harus lebih dari 0")
+	}
+	receipt.Unit = strings.TrimSpace(strings.ToLower(receipt.Unit))
+	return s.repo.ReceiveStock(storeID, receipt)
+}
+
+func validateStore(store *models.Store) error {
+	store.Code = strings.ToUpper(strings.TrimSpace(store.Code))
+	if store.Code == "" || store.Name == "" {
+		return errors.New("kode dan nama toko wajib diisi")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"kasir-api/models"
+	"kasir-api/repositories"
+)
+
+// maxSyncSales caps the sales of one upload.
+const maxSyncSales = 200
+
+// syncClockSkew is how far ahead of the server a terminal's clock may run.
+const syncClockSkew = 5 * time.Minute
+
+var clientIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+type SyncService struct {
+	repo               *repositories.SyncRepository
+	storeRepo          *repositories.StoreRepository
+	transactionService *TransactionService
+	productService     *ProductService
+}
+
+func NewSyncService(repo *repositories.SyncRepository, storeRepo *repositories.StoreRepository, transactionService *TransactionService, productService *ProductService) *SyncService {
+	return &SyncService{repo: repo, storeRepo: storeRepo, transactionService: transactionService, productService: productService}
+}
+
+// Catalog returns what changed in a store's catalog since the token of an
+// earlier sync; an empty token downloads all of it.
+func (s *SyncService) Catalog(storeID int, since string) (*models.CatalogSync, error) {
+	var version int64
+	if since != "" {
+		v, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || v < 0 {
+			return nil, errors.New("token since tidak valid")
+		}
+		version = v
+	}
+	return s.repo.Catalog(storeID, version)
+}
+
+// UploadSales records the sales a terminal made offline in upload order,
+// each in its own database transaction, so one conflict does not hold up the
+// others.
+func (s *SyncService) UploadSales(storeID int, upload models.SyncSalesUpload) (*models.SyncSalesResult, error) {
+	if len(upload.Sales) == 0 {
+		return nil, errors.New("sales wajib diisi")
+	}
+	if len(upload.Sales) > maxSyncSales {
+		return nil, fmt.Errorf("maksimal %d penjualan per upload", maxSyncSales)
+	}
+	if storeID != 0 {
+		if _, err := s.storeRepo.GetByID(storeID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &models.SyncSalesResult{Results: make([]models.SyncSaleResult, 0, len(upload.Sales))}
+	for _, sale := range upload.Sales {
+		r := s.uploadSale(storeID, sale)
+		switch r.Status {
+		case models.SyncSaleCreated:
+			result.Created++
+		case models.SyncSaleDuplicate:
+			result.Duplicates++
+		case models.SyncSaleConflict:
+			result.Conflicts++
+		case models.SyncSaleRejected:
+			result.Rejected++
+		default:
+			result.Errors++
+		}
+		result.Results = append(result.Results, r)
+	}
+	return result, nil
+}
+
+func (s *SyncService) uploadSale(storeID int, sale models.SyncSale) models.SyncSaleResult {
+	result := models.SyncSaleResult{ClientID: sale.ClientID}
+
+	req, err := syncCheckoutRequest(storeID, sale)
+	if err == nil {
+		for i := range req.Items {
+			if err = resolveScannedItem(s.productService, &req.Items[i]); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		result.Status = models.SyncSaleRejected
+		result.Error = err.Error()
+		return result
+	}
+
+	transaction, err := s.transactionService.createOfflineTransaction(req)
+	if err == nil {
+		result.Status = models.SyncSaleCreated
+		if transaction.Replayed {
+			result.Status = models.SyncSaleDuplicate
+		}
+		result.Transaction = transaction
+		return result
+	}
+
+	result.Error = err.Error()
+	var stockErr *repositories.StockConflictError
+	var priceErr *repositories.PriceMismatchError
+	var checkoutErr *repositories.CheckoutError
+	switch {
+	case errors.As(err, &stockErr):
+		result.Status = models.SyncSaleConflict
+		result.Conflict = &models.SyncConflict{
+			Reason:    models.ConflictInsufficientStock,
+			ProductID: stockErr.ProductID,
+			Requested: &stockErr.Requested,
+			Available: &stockErr.Available,
+		}
+	case errors.As(err, &priceErr):
+		result.Status = models.SyncSaleConflict
+		result.Conflict = &models.SyncConflict{
+			Reason:        models.ConflictPriceMismatch,
+			ExpectedTotal: &priceErr.Expected,
+			ActualTotal:   &priceErr.Actual,
+		}
+	case errors.Is(err, repositories.ErrIdempotencyConflict):
+		result.Status = models.SyncSaleConflict
+		result.Conflict = &models.SyncConflict{Reason: models.ConflictClientIDReused}
+	case errors.As(err, &checkoutErr), errors.Is(err, models.ErrMoneyOverflow), errors.Is(err, models.ErrQuantityOverflow):
+		result.Status = models.SyncSaleRejected
+	default:
+		result.Status = models.SyncSaleError
+	}
+	return result
+}
+
+// syncCheckoutRequest checks an offline sale and turns it into a checkout
+// keyed by its client id.
+func syncCheckoutRequest(storeID int, sale models.SyncSale) (models.CheckoutRequest, error) {
+	clientID := strings.ToLower(strings.TrimSpace(sale.ClientID))
+	if !clientIDPattern.MatchString(clientID) {
+		return models.CheckoutRequest{}, errors.New("client_id harus berupa UUID")
+	}
+	if len(sale.Items) == 0 {
+		return models.CheckoutRequest{}, errors.New("items wajib diisi")
+	}
+
+	req := models.CheckoutRequest{
+		StoreID:        storeID,
+		IdempotencyKey: "sync:" + clientID,
+		Items:          sale.Items,
+		PaymentMethod:  sale.PaymentMethod,
+		PaidAmount:     sale.PaidAmount,
+		ExpectedTotal:  sale.TotalAmount,
+	}
+	for i := range req.Items {
+		req.Items[i].Unit = strings.TrimSpace(strings.ToLower(req.Items[i].Unit))
+	}
+	if err := normalizePayment(&req); err != nil {
+		return models.CheckoutRequest{}, err
+	}
+
+	if sale.SoldAt != "" {
+		soldAt, err := time.Parse(time.RFC3339, sale.SoldAt)
+		if err != nil {
+			return models.CheckoutRequest{}, errors.New("sold_at harus berformat RFC 3339, mis. 2024-05-01T13:45:00+07:00")
+		}
+		if soldAt.After(time.Now().Add(syncClockSkew)) {
+			return models.CheckoutRequest{}, errors.New("sold_at tidak boleh di masa depan")
+		}
+		req.SoldAt = soldAt.Format(time.RFC3339)
+	}
+
+	hash, err := syncSaleHash(req)
+	if err != nil {
+		return models.CheckoutRequest{}, err
+	}
+	req.RequestHash = hash
+	return req, nil
+}
+
+// syncSaleHash fingerprints an offline sale so a reused client id can be
+// told apart from an upload retried after a lost response.
+func syncSaleHash(req models.CheckoutRequest) (string, error) {
+	payload, err := json.Marshal(struct {
+		StoreID       int                   `json:"store_id"`
+		Items         []models.CheckoutItem `json:"items"`
+		PaymentMethod string                `json:"payment_method"`
+		PaidAmount    *models.Money         `json:"paid_amount,omitempty"`
+		TotalAmount   *models.Money         `json:"total_amount,omitempty"`
+		SoldAt        string                `json:"sold_at,omitempty"`
+	}{req.StoreID, req.Items, req.PaymentMethod, req.PaidAmount, req.ExpectedTotal, req.SoldAt})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
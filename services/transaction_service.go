@@ -1,22 +1,328 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
 	"kasir-api/models"
+	"kasir-api/payment"
+	"kasir-api/receipt"
 	"kasir-api/repositories"
 )
 
+// ErrUnknownGateway is returned for notifications of a gateway that is not
+// configured.
+var ErrUnknownGateway = errors.New("payment gateway tidak dikenal")
+
+// ErrReceiptNotPaid is returned for the receipt of a sale that is not paid:
+// a receipt says the money was received and may open the cash drawer.
+var ErrReceiptNotPaid = errors.New("struk hanya untuk transaksi yang sudah dibayar")
+
 type TransactionService struct {
-	repo *repositories.TransactionRepository
+	repo           *repositories.TransactionRepository
+	storeRepo      *repositories.StoreRepository
+	productService *ProductService
+	receiptConfig  receipt.Config
+	gateway        payment.Gateway
+	paymentTTL     time.Duration
+}
+
+// NewTransactionService creates the service. With a gateway, QRIS sales wait
+// up to paymentTTL for the gateway to confirm the payment; without one they
+// are recorded as paid right away.
+func NewTransactionService(repo *repositories.TransactionRepository, storeRepo *repositories.StoreRepository, productService *ProductService, receiptConfig receipt.Config, gateway payment.Gateway, paymentTTL time.Duration) *TransactionService {
+	return &TransactionService{repo: repo, storeRepo: storeRepo, productService: productService, receiptConfig: receiptConfig,
+		gateway: gateway, paymentTTL: paymentTTL}
+}
+
+func (s *TransactionService) GetByID(id int) (*models.Transaction, error) {
+	return s.repo.GetByID(id)
+}
+
+// maxSearchResults caps an invoice number search.
+const maxSearchResults = 100
+
+// SearchByInvoice finds transactions by (part of) their invoice number.
+func (s *TransactionService) SearchByInvoice(storeID int, number string, limit int) ([]models.Transaction, error) {
+	number = strings.TrimSpace(number)
+	if number == "" {
+		return nil, errors.New("nomor invoice wajib diisi")
+	}
+	if limit <= 0 || limit > maxSearchResults {
+		limit = maxSearchResults
+	}
+	return s.repo.SearchByInvoice(storeID, number, limit)
+}
+
+// ExportLines streams the line items of the transactions matching filter to
+// fn.
+func (s *TransactionService) ExportLines(filter models.TransactionExportFilter, fn func(models.TransactionLine) error) error {
+	for _, date := range []string{filter.From, filter.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return errors.New("tanggal harus berformat YYYY-MM-DD")
+		}
+	}
+	switch filter.Status {
+	case "", models.TransactionPaid, models.TransactionPendingPayment, models.TransactionCancelled, models.TransactionRefundRequired:
+	default:
+		return fmt.Errorf("status %s tidak dikenal", filter.Status)
+	}
+	if filter.StoreID != 0 {
+		if _, err := s.storeRepo.GetByID(filter.StoreID); err != nil {
+			return err
+		}
+	}
+	return s.repo.ExportLines(filter, fn)
+}
+
+// GetReceipt builds the receipt of a paid transaction with the header of the
+// store it was sold at.
+func (s *TransactionService) GetReceipt(id int) (*receipt.Receipt, error) {
+	transaction, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if transaction.Status != models.TransactionPaid {
+		return nil, fmt.Errorf("%w (status %s)", ErrReceiptNotPaid, transaction.Status)
+	}
+	store, err := s.storeRepo.GetByID(transaction.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	return receipt.New(s.receiptConfig, store, transaction), nil
+}
+
+func (s *TransactionService) Checkout(req models.CheckoutRequest) (*models.Transaction, error) {
+	items := req.Items
+	for i := range items {
+		items[i].Unit = strings.TrimSpace(strings.ToLower(items[i].Unit))
+	}
+	if err := normalizePayment(&req); err != nil {
+		return nil, err
+	}
+
+	if req.IdempotencyKey != "" {
+		hash, err := checkoutHash(req)
+		if err != nil {
+			return nil, err
+		}
+		req.RequestHash = hash
+	}
+
+	for i := range items {
+		if err := resolveScannedItem(s.productService, &items[i]); err != nil {
+			return nil, err
+		}
+	}
+	return s.createTransaction(req)
+}
+
+// createTransaction records a checkout. A QRIS sale through the gateway is
+// left pending payment with a QR code from the gateway to show the customer.
+func (s *TransactionService) createTransaction(req models.CheckoutRequest) (*models.Transaction, error) {
+	if s.gateway == nil || req.PaymentMethod != models.PaymentQRIS {
+		return s.repo.CreateTransaction(req)
+	}
+
+	// The gateway collects exactly the total
+	req.PaidAmount = nil
+	req.PaymentTTL = s.paymentTTL
+	transaction, err := s.repo.CreateTransaction(req)
+	if err != nil || transaction.Replayed || transaction.Status != models.TransactionPendingPayment {
+		return transaction, err
+	}
+
+	// Asked outside the checkout's database transaction so a slow gateway
+	// holds no locks
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	orderID := fmt.Sprintf("kasir-%d", transaction.ID)
+	qris, err := s.gateway.CreateQRIS(ctx, payment.Charge{OrderID: orderID, Amount: transaction.TotalAmount, Expiry: s.paymentTTL})
+	if err != nil {
+		if cancelErr := s.repo.CancelPendingPayment(transaction.ID); cancelErr != nil {
+			return nil, fmt.Errorf("gagal membuat QRIS: %v (cancelling transaction %d: %v)", err, transaction.ID, cancelErr)
+		}
+		return nil, fmt.Errorf("gagal membuat QRIS: %w", err)
+	}
+
+	gp := &models.GatewayPayment{
+		Gateway:    s.gateway.Name(),
+		OrderID:    orderID,
+		Reference:  qris.Reference,
+		QRString:   qris.QRString,
+		QRImageURL: qris.ImageURL,
+		ExpiresAt:  transaction.Gateway.ExpiresAt,
+	}
+	if err := s.repo.AttachGatewayPayment(transaction.ID, gp); err != nil {
+		return nil, err
+	}
+	transaction.Gateway = gp
+	return transaction, nil
+}
+
+// createOfflineTransaction records a sale a terminal made offline. It was
+// paid at the till already, so a QRIS sale never goes through the gateway.
+func (s *TransactionService) createOfflineTransaction(req models.CheckoutRequest) (*models.Transaction, error) {
+	return s.repo.CreateTransaction(req)
 }
 
-func NewTransactionService(repo *repositories.TransactionRepository) *TransactionService {
-	return &TransactionService{repo: repo}
+// HandlePaymentNotification applies a webhook callback of the named gateway:
+// a payment finalizes its sale, a failed or expired one cancels it. A
+// failure reported for a sale that was paid meanwhile changes nothing.
+func (s *TransactionService) HandlePaymentNotification(gateway string, body []byte, header http.Header) (*models.Transaction, error) {
+	if s.gateway == nil || s.gateway.Name() != gateway {
+		return nil, ErrUnknownGateway
+	}
+
+	notification, err := s.gateway.ParseNotification(body, header)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.repo.FindByPaymentOrder(gateway, notification.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch notification.Status {
+	case payment.StatusPaid:
+		err = s.repo.ConfirmPayment(id, notification.Amount)
+	case payment.StatusFailed:
+		err = s.repo.CancelPendingPayment(id)
+		if errors.Is(err, repositories.ErrAlreadyPaid) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(id)
+}
+
+// CancelPayment cancels a sale still awaiting payment, e.g. when the customer
+// pays another way, and releases its stock.
+func (s *TransactionService) CancelPayment(id int) (*models.Transaction, error) {
+	if err := s.repo.CancelPendingPayment(id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(id)
+}
+
+// resolveScannedItem fills in product and quantity of an item that was
+// scanned by barcode instead of sending product_id. A scale label with an
+// embedded price also fixes the line's total to that price.
+func resolveScannedItem(productService *ProductService, item *models.CheckoutItem) error {
+	if item.Barcode == "" || item.ProductID != 0 {
+		return nil
+	}
+
+	scan, err := productService.ScanBarcode(item.Barcode)
+	if err != nil {
+		return err
+	}
+	item.ProductID = scan.Product.ID
+	if IsScaleBarcode(item.Barcode) || item.Quantity == 0 {
+		item.Quantity = scan.Quantity
+	}
+	item.LineTotal = scan.EmbeddedPrice
+	return nil
 }
 
-func (s *TransactionService) Checkout(items []models.CheckoutItem) (*models.Transaction, error) {
-	return s.repo.CreateTransaction(items)
+// normalizePayment checks the payment method of a checkout; empty means cash.
+func normalizePayment(req *models.CheckoutRequest) error {
+	req.PaymentMethod = strings.TrimSpace(strings.ToLower(req.PaymentMethod))
+	switch req.PaymentMethod {
+	case "":
+		req.PaymentMethod = models.PaymentCash
+	case models.PaymentCash, models.PaymentDebit, models.PaymentCredit,
+		models.PaymentQRIS, models.PaymentTransfer, models.PaymentEWallet:
+	default:
+		return fmt.Errorf("metode pembayaran %s tidak dikenal", req.PaymentMethod)
+	}
+	if req.PaidAmount != nil && *req.PaidAmount < 0 {
+		return errors.New("paid_amount tidak boleh negatif")
+	}
+	return nil
 }
 
-func (s *TransactionService) GetTodaySummary() (*models.ReportSummary, error) {
-	return s.repo.GetTodaySummary()
+// checkoutHash fingerprints a checkout payload so a reused Idempotency-Key
+// can be told apart from a genuine retry.
+func checkoutHash(req models.CheckoutRequest) (string, error) {
+	payload, err := json.Marshal(struct {
+		StoreID        int                   `json:"store_id"`
+		CartID         int                   `json:"cart_id,omitempty"`
+		Items          []models.CheckoutItem `json:"items"`
+		ReservationIDs []int64               `json:"reservation_ids,omitempty"`
+		PaymentMethod  string                `json:"payment_method,omitempty"`
+		PaidAmount     *models.Money         `json:"paid_amount,omitempty"`
+	}{req.StoreID, req.CartID, req.Items, req.ReservationIDs, req.PaymentMethod, req.PaidAmount})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// GetTodaySummary returns today's sales of one store, or consolidated over
+// all stores when storeID is 0.
+func (s *TransactionService) GetTodaySummary(storeID int) (*models.ReportSummary, error) {
+	if storeID == 0 {
+		return s.repo.GetTodaySummary(0)
+	}
+
+	store, err := s.storeRepo.GetByID(storeID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.repo.GetTodaySummary(store.ID)
+	if err != nil {
+		return nil, err
+	}
+	summary.StoreID = &store.ID
+	summary.StoreName = store.Name
+
+	return summary, nil
+}
+
+// GetTodaySalesPerCategory returns today's sales per category of one store
+// (all stores when storeID is 0), rolled up over subcategories; with a
+// categoryID only for that category and the ones below it.
+func (s *TransactionService) GetTodaySalesPerCategory(storeID, categoryID int) ([]models.CategorySales, error) {
+	if storeID != 0 {
+		if _, err := s.storeRepo.GetByID(storeID); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.GetTodaySalesPerCategory(storeID, categoryID)
+}
+
+// GetTodaySummaryPerStore returns today's sales broken down by store.
+func (s *TransactionService) GetTodaySummaryPerStore() ([]models.ReportSummary, error) {
+	stores, err := s.storeRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]models.ReportSummary, 0, len(stores))
+	for _, store := range stores {
+		summary, err := s.repo.GetTodaySummary(store.ID)
+		if err != nil {
+			return nil, err
+		}
+		storeID := store.ID
+		summary.StoreID = &storeID
+		summary.StoreName = store.Name
+		summaries = append(summaries, *summary)
+	}
+
+	return summaries, nil
 }
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"kasir-api/models"
+)
+
+func TestCheckoutHash(t *testing.T) {
+	paid := models.Money(50000)
+	base := models.CheckoutRequest{StoreID: 1, Items: []models.CheckoutItem{{ProductID: 1, Quantity: models.NewQuantity(2)}}}
+	tests := []struct {
+		name string
+		req  models.CheckoutRequest
+		same bool
+	}{
+		{"same payload", base, true},
+		{"key is not hashed", models.CheckoutRequest{StoreID: 1, Items: base.Items, IdempotencyKey: "abc"}, true},
+		{"other store", models.CheckoutRequest{StoreID: 2, Items: base.Items}, false},
+		{"other quantity", models.CheckoutRequest{StoreID: 1, Items: []models.CheckoutItem{{ProductID: 1, Quantity: models.NewQuantity(3)}}}, false},
+		{"paid amount", models.CheckoutRequest{StoreID: 1, Items: base.Items, PaidAmount: &paid}, false},
+		{"cart", models.CheckoutRequest{CartID: 1}, false},
+	}
+
+	want, err := checkoutHash(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkoutHash(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == want) != tt.same {
+				t.Errorf("checkoutHash() equal = %v, want %v", got == want, tt.same)
+			}
+		})
+	}
+
+	cart1, _ := checkoutHash(models.CheckoutRequest{CartID: 1})
+	cart2, _ := checkoutHash(models.CheckoutRequest{CartID: 2})
+	if cart1 == cart2 {
+		t.Error("checkoutHash() is the same for the checkouts of two carts")
+	}
+}
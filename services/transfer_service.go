@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"kasir-api/models"
+	"kasir-api/repositories"
+)
+
+type TransferService struct {
+	repo *repositories.TransferRepository
+}
+
+func NewTransferService(repo *repositories.TransferRepository) *TransferService {
+	return &TransferService{repo: repo}
+}
+
+func (s *TransferService) GetAll(status string) ([]models.StockTransfer, error) {
+	return s.repo.GetAll(status)
+}
+
+func (s *TransferService) GetByID(id int) (*models.StockTransfer, error) {
+	return s.repo.GetByID(id)
+}
+
+func (s *TransferService) Create(transfer *models.StockTransfer) error {
+	if transfer.SourceStoreID == 0 || transfer.DestinationStoreID == 0 {
+		return errors.New("source_store_id dan destination_store_id wajib diisi")
+	}
+	if transfer.SourceStoreID == transfer.DestinationStoreID {
+		return errors.New("toko asal dan tujuan tidak boleh sama")
+	}
+	normalizeTransferItems(transfer.Items)
+	return s.repo.Create(transfer)
+}
+
+func (s *TransferService) UpdateItems(id int, items []models.StockTransferItem) (*models.StockTransfer, error) {
+	normalizeTransferItems(items)
+	return s.repo.UpdateItems(id, items)
+}
+
+func (s *TransferService) Send(id int) (*models.StockTransfer, error) {
+	return s.repo.Send(id)
+}
+
+func (s *TransferService) Receive(id int, receipt models.TransferReceipt) (*models.StockTransfer, error) {
+	return s.repo.Receive(id, receipt)
+}
+
+func (s *TransferService) Cancel(id int) (*models.StockTransfer, error) {
+	return s.repo.Cancel(id)
+}
+
+func (s *TransferService) GetInTransit(storeID int) ([]models.InTransitStock, error) {
+	return s.repo.GetInTransit(storeID)
+}
+
+func normalizeTransferItems(items []models.StockTransferItem) {
+	for i := range items {
+		items[i].Unit = strings.TrimSpace(strings.ToLower(items[i].Unit))
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kasir-api/models"
+	"kasir-api/outbox"
+	"kasir-api/repositories"
+)
+
+// Webhook request headers. The signature is the hex HMAC-SHA256, keyed with
+// the subscription's secret, of the timestamp, a dot and the body.
+const (
+	WebhookEventHeader     = "X-Kasir-Event"
+	WebhookEventIDHeader   = "X-Kasir-Event-ID"
+	WebhookDeliveryHeader  = "X-Kasir-Delivery"
+	WebhookTimestampHeader = "X-Kasir-Timestamp"
+	WebhookSignatureHeader = "X-Kasir-Signature"
+)
+
+// webhookBackoff is the wait before each retry of a failed delivery; after
+// the last one the delivery is given up.
+var webhookBackoff = []time.Duration{
+	30 * time.Second, 2 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour,
+}
+
+const (
+	webhookBatchSize = 20
+	// webhookLease must outlast sending a whole batch
+	webhookLease       = 5 * time.Minute
+	webhookTimeout     = 10 * time.Second
+	webhookPollEvery   = 5 * time.Second
+	maxDeliveryResults = 200
+)
+
+type WebhookService struct {
+	repo   *repositories.WebhookRepository
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewWebhookService(repo *repositories.WebhookRepository) *WebhookService {
+	return &WebhookService{
+		repo:   repo,
+		client: &http.Client{Timeout: webhookTimeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (s *WebhookService) GetAll() ([]models.WebhookSubscription, error) {
+	return s.repo.GetAll()
+}
+
+func (s *WebhookService) GetByID(id int) (*models.WebhookSubscription, error) {
+	return s.repo.GetByID(id)
+}
+
+// Create adds a subscription, generating its secret when none is given.
+func (s *WebhookService) Create(sub *models.WebhookSubscription) error {
+	if err := validateSubscription(sub); err != nil {
+		return err
+	}
+	if sub.Secret == "" {
+		secret := make([]byte, 24)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		sub.Secret = hex.EncodeToString(secret)
+	}
+	return s.repo.Create(sub)
+}
+
+func (s *WebhookService) Update(sub *models.WebhookSubscription) error {
+	if err := validateSubscription(sub); err != nil {
+		return err
+	}
+	if err := s.repo.Update(sub); err != nil {
+		return err
+	}
+	sub.Secret = ""
+	return nil
+}
+
+func (s *WebhookService) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+func validateSubscription(sub *models.WebhookSubscription) error {
+	sub.URL = strings.TrimSpace(sub.URL)
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url webhook harus berupa URL http atau https")
+	}
+	if len(sub.Secret) > 128 {
+		return errors.New("secret terlalu panjang (maks 128)")
+	}
+
+	if len(sub.Events) == 0 {
+		return errors.New("events wajib diisi")
+	}
+	for i, event := range sub.Events {
+		event = strings.TrimSpace(strings.ToLower(event))
+		if event != "*" && !slices.Contains(models.EventTypes, event) {
+			return fmt.Errorf("event %s tidak dikenal", event)
+		}
+		sub.Events[i] = event
+	}
+	slices.Sort(sub.Events)
+	sub.Events = slices.Compact(sub.Events)
+	return nil
+}
+
+func (s *WebhookService) GetDeliveries(subscriptionID int, status string, limit int) ([]models.WebhookDelivery, error) {
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryFailed:
+	default:
+		return nil, fmt.Errorf("status %s tidak dikenal", status)
+	}
+	if _, err := s.repo.GetByID(subscriptionID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxDeliveryResults {
+		limit = maxDeliveryResults
+	}
+	return s.repo.GetDeliveries(subscriptionID, status, limit)
+}
+
+// Replay sends an earlier delivery again as a new delivery.
+func (s *WebhookService) Replay(subscriptionID, deliveryID int) (*models.WebhookDelivery, error) {
+	delivery, err := s.repo.Replay(subscriptionID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	s.notify()
+	return delivery, nil
+}
+
+func (s *WebhookService) Name() string {
+	return "webhook"
+}
+
+// Send queues an outbox event for the subscriptions listening to it; Run
+// delivers it from there. It makes the service an outbox.Sink.
+func (s *WebhookService) Send(ctx context.Context, e outbox.Event) error {
+	queued, err := s.repo.Enqueue(e.EventID, e.Type, e.Payload)
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		s.notify()
+	}
+	return nil
+}
+
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends queued deliveries until ctx is cancelled: right after an event
+// is queued, and every few seconds for retries and deliveries queued by
+// other servers. A delivery already being sent is finished first.
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollEvery)
+	defer ticker.Stop()
+
+	for {
+		for {
+			deliveries, err := s.repo.ClaimDue(webhookBatchSize, webhookLease)
+			if err != nil {
+				log.Printf("webhook: claiming deliveries: %v\n", err)
+				break
+			}
+			for _, d := range deliveries {
+				s.deliver(d)
+			}
+			if len(deliveries) < webhookBatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends one delivery and records the outcome; any 2xx answer counts
+// as delivered.
+func (s *WebhookService) deliver(d models.WebhookDelivery) {
+	statusCode, err := s.send(d)
+
+	retryIn := time.Duration(0)
+	if err != nil && d.Attempts < len(webhookBackoff) {
+		retryIn = webhookBackoff[d.Attempts]
+	}
+	sendErr := ""
+	if err != nil {
+		sendErr = err.Error()
+		if len(sendErr) > 500 {
+			sendErr = sendErr[:500]
+		}
+	}
+
+	if err := s.repo.RecordAttempt(d.ID, statusCode, sendErr, err == nil, retryIn); err != nil {
+		log.Printf("webhook: recording delivery %d: %v\n", d.ID, err)
+	}
+}
+
+func (s *WebhookService) send(d models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kasir-api-webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookEventIDHeader, d.EventID)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(d.ID))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(d.Secret, timestamp, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	return resp.StatusCode, nil
+}
+
+// SignWebhook computes the signature of a webhook body sent at timestamp
+// (Unix seconds), as receivers should to verify it.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,317 @@
+// Package spreadsheet reads and writes CSV and XLSX files, using only the
+// standard library. Reading gives the first sheet as rows of cell text: row
+// i of the result is row i+1 of the sheet, so row numbers can be reported
+// back to whoever edits the file, and blank rows are kept as empty rows.
+// Writing streams one sheet row by row.
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// File formats
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// maxPartSize bounds each decompressed part of an XLSX file, so a small zip
+// cannot expand into gigabytes.
+const maxPartSize = 64 << 20
+
+// ErrTooManyRows is returned when a sheet has more rows than allowed.
+var ErrTooManyRows = errors.New("spreadsheet: too many rows")
+
+// Read reads data in the given format; an empty format is detected from the
+// content (XLSX files are zip archives, anything else is read as CSV).
+func Read(data []byte, format string, maxRows int) ([][]string, error) {
+	if format == "" {
+		format = CSV
+		if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+			format = XLSX
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case CSV:
+		return ReadCSV(bytes.NewReader(data), maxRows)
+	case XLSX:
+		return ReadXLSX(data, maxRows)
+	}
+	return nil, fmt.Errorf("spreadsheet: unknown format %q", format)
+}
+
+// ReadCSV reads comma or semicolon separated values; the separator is taken
+// from the header line, as spreadsheets set to Indonesian locale save with
+// semicolons. A UTF-8 byte order mark is skipped.
+func ReadCSV(r io.Reader, maxRows int) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectSeparator(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows := make([][]string, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// csv skips blank lines; keep them so row numbers match the file
+		line, _ := reader.FieldPos(0)
+		if line > maxRows {
+			return nil, ErrTooManyRows
+		}
+		for len(rows) < line-1 {
+			rows = append(rows, nil)
+		}
+		rows = append(rows, record)
+	}
+}
+
+func detectSeparator(data []byte) rune {
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+// ReadXLSX reads the first worksheet of an XLSX workbook. Numbers are given
+// in their shortest decimal form and booleans as TRUE or FALSE; dates stay
+// the serial numbers they are stored as.
+func ReadXLSX(data []byte, maxRows int) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("spreadsheet: not an xlsx file: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	sheetPath, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := decodePart(f, &sst); err != nil {
+			return nil, err
+		}
+		shared = make([]string, len(sst.Items))
+		for i, si := range sst.Items {
+			shared[i] = si.String()
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("spreadsheet: worksheet %s missing", sheetPath)
+	}
+	var sheet struct {
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodePart(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		// Rows and cells may leave out their position, meaning the next one
+		number := row.Number
+		if number == 0 {
+			number = len(rows) + 1
+		}
+		if number > maxRows {
+			return nil, ErrTooManyRows
+		}
+		if number <= len(rows) {
+			return nil, fmt.Errorf("spreadsheet: row %d out of order", number)
+		}
+		for len(rows) < number-1 {
+			rows = append(rows, nil)
+		}
+
+		var cells []string
+		for _, c := range row.Cells {
+			col := len(cells)
+			if c.Ref != "" {
+				col, err = columnIndex(c.Ref)
+				if err != nil {
+					return nil, err
+				}
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+
+			var value string
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(c.Value)
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, fmt.Errorf("spreadsheet: cell %s: bad shared string %q", c.Ref, c.Value)
+				}
+				value = shared[i]
+			case "inlineStr":
+				value = c.Inline.String()
+			case "b":
+				value = "FALSE"
+				if c.Value == "1" {
+					value = "TRUE"
+				}
+			case "", "n":
+				value = c.Value
+				// Excel writes 0.1 as 0.10000000000000001
+				if f, err := strconv.ParseFloat(c.Value, 64); err == nil {
+					value = strconv.FormatFloat(f, 'f', -1, 64)
+				}
+			default:
+				// str (formula text) and e (error) are kept as written
+				value = c.Value
+			}
+			if col < len(cells) {
+				cells[col] = value
+			} else {
+				cells = append(cells, value)
+			}
+		}
+		rows = append(rows, cells)
+	}
+
+	return rows, nil
+}
+
+// firstSheet finds the part holding the workbook's first sheet.
+func firstSheet(files map[string]*zip.File) (string, error) {
+	wb, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("spreadsheet: not an xlsx file: xl/workbook.xml missing")
+	}
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(wb, &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("spreadsheet: workbook has no sheets")
+	}
+
+	if rels, ok := files["xl/_rels/workbook.xml.rels"]; ok {
+		var relationships struct {
+			Items []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if err := decodePart(rels, &relationships); err != nil {
+			return "", err
+		}
+		for _, rel := range relationships.Items {
+			if rel.ID != workbook.Sheets[0].RelID {
+				continue
+			}
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func decodePart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	err = xml.NewDecoder(io.LimitReader(rc, maxPartSize)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("spreadsheet: %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// xlsxText is a shared or inline string: plain text, or rich text runs.
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	b.WriteString(t.Text)
+	for _, r := range t.Runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+// columnIndex turns a cell reference such as "AB12" into its zero-based
+// column, 27.
+func columnIndex(ref string) (int, error) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+		// XFD, the last column Excel allows
+		if col > 16384 {
+			return 0, fmt.Errorf("spreadsheet: bad cell reference %q", ref)
+		}
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("spreadsheet: bad cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// ColumnIndex turns a column letter such as "C" into its zero-based index;
+// false when s is not a column letter.
+func ColumnIndex(s string) (int, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" || len(s) > 3 || strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return 0, false
+	}
+	col, err := columnIndex(s)
+	return col, err == nil
+}
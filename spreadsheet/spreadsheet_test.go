@@ -0,0 +1,221 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    int
+		wantErr bool
+	}{
+		{"A1", 0, false},
+		{"B7", 1, false},
+		{"Z1", 25, false},
+		{"AA1", 26, false},
+		{"AB12", 27, false},
+		{"AZ3", 51, false},
+		{"XFD1", 16383, false},
+		{"D", 3, false},
+		{"XFE1", 0, true},
+		{"ZZZZ1", 0, true},
+		{"12", 0, true},
+		{"a1", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := columnIndex(tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("columnIndex(%q) = %d, want an error", tt.ref, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("columnIndex(%q): %v", tt.ref, err)
+			}
+			if got != tt.want {
+				t.Errorf("columnIndex(%q) = %d, want %d", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnIndexOfLetter(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   int
+		wantOK bool
+	}{
+		{"C", 2, true},
+		{" d ", 3, true},
+		{"ab", 27, true},
+		{"XFD", 16383, true},
+		{"XFE", 0, false},
+		{"ABCD", 0, false},
+		{"C3", 0, false},
+		{"harga", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ColumnIndex(tt.in)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("ColumnIndex(%q) = %d, %v, want %d, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// xlsx builds a workbook whose first sheet has the given sheetData, with
+// shared strings "Nama" and "Harga" and a relationship to a sheet that is
+// not called sheet1.
+func xlsx(t *testing.T, sheetData string) []byte {
+	t.Helper()
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Produk" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId7" Target="worksheets/produk.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>Nama</t></si><si><r><t>Har</t></r><r><t>ga</t></r></si></sst>`,
+		"xl/worksheets/produk.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadXLSX(t *testing.T) {
+	tests := []struct {
+		name    string
+		sheet   string
+		maxRows int
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "shared, inline, numbers and booleans",
+			sheet: `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+				`<row r="2"><c r="A2" t="inlineStr"><is><t>Beras</t></is></c><c r="B2"><v>15000</v></c>` +
+				`<c r="C2" t="n"><v>0.10000000000000001</v></c><c r="D2" t="b"><v>1</v></c></row>`,
+			maxRows: 10,
+			want:    [][]string{{"Nama", "Harga"}, {"Beras", "15000", "0.1", "TRUE"}},
+		},
+		{
+			name:    "gaps in rows and cells are kept",
+			sheet:   `<row r="1"><c r="A1"><v>1</v></c></row><row r="3"><c r="C3"><v>3</v></c></row>`,
+			maxRows: 10,
+			want:    [][]string{{"1"}, nil, {"", "", "3"}},
+		},
+		{
+			name:    "rows and cells without a position follow on",
+			sheet:   `<row><c><v>1</v></c><c><v>2</v></c></row><row><c t="b"><v>0</v></c></row>`,
+			maxRows: 10,
+			want:    [][]string{{"1", "2"}, {"FALSE"}},
+		},
+		{
+			name:    "formula text and errors as written",
+			sheet:   `<row r="1"><c r="A1" t="str"><v>Rp 1.000</v></c><c r="B1" t="e"><v>#DIV/0!</v></c></row>`,
+			maxRows: 10,
+			want:    [][]string{{"Rp 1.000", "#DIV/0!"}},
+		},
+		{
+			name:    "too many rows",
+			sheet:   `<row r="1"><c r="A1"><v>1</v></c></row><row r="3"><c r="A3"><v>3</v></c></row>`,
+			maxRows: 2,
+			wantErr: true,
+		},
+		{
+			name:    "rows out of order",
+			sheet:   `<row r="2"><c r="A2"><v>2</v></c></row><row r="1"><c r="A1"><v>1</v></c></row>`,
+			maxRows: 10,
+			wantErr: true,
+		},
+		{
+			name:    "bad shared string",
+			sheet:   `<row r="1"><c r="A1" t="s"><v>9</v></c></row>`,
+			maxRows: 10,
+			wantErr: true,
+		},
+		{
+			name:    "bad cell reference",
+			sheet:   `<row r="1"><c r="11"><v>1</v></c></row>`,
+			maxRows: 10,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadXLSX(xlsx(t, tt.sheet), tt.maxRows)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ReadXLSX = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadXLSX = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXLSXNotAWorkbook(t *testing.T) {
+	if _, err := ReadXLSX([]byte("nama,harga\n"), 10); err == nil {
+		t.Error("ReadXLSX of CSV data gave no error")
+	}
+}
+
+func TestReadDetectsFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]string
+	}{
+		{"xlsx", xlsx(t, `<row r="1"><c r="A1" t="s"><v>0</v></c></row>`), [][]string{{"Nama"}}},
+		{"csv with commas", []byte("nama,harga\nBeras,15000\n"), [][]string{{"nama", "harga"}, {"Beras", "15000"}}},
+		{"csv with semicolons and BOM", []byte("\xef\xbb\xbfnama;harga\nGula;\"15,5\"\n"), [][]string{{"nama", "harga"}, {"Gula", "15,5"}}},
+		{"blank lines kept", []byte("nama\n\nBeras\n"), [][]string{{"nama"}, nil, {"Beras"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(tt.data, "", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadTooManyRows(t *testing.T) {
+	data := []byte(strings.Repeat("x\n", 4))
+	if _, err := Read(data, CSV, 3); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("Read of 4 rows with maxRows 3: error = %v, want ErrTooManyRows", err)
+	}
+}